@@ -17,57 +17,82 @@ import (
 func Routes() http.Handler {
 	r := bastion.NewRouter()
 
-	r.Get("/", list)    // GET /todos - read a list of todos
-	r.Post("/", create) // POST /todos - create a new todo and persist it
+	r.Method(http.MethodGet, "/", bastion.HandlerFunc(list))    // GET /todos - read a list of todos
+	r.Method(http.MethodPost, "/", bastion.HandlerFunc(create)) // POST /todos - create a new todo and persist it
 	r.Route("/{id}", func(r chi.Router) {
-		r.Get("/", get)       // GET /todos/{id} - read a single todo by :id
-		r.Put("/", update)    // PUT /todos/{id} - update a single todo by :id
-		r.Delete("/", delete) // DELETE /todos/{id} - delete a single todo by :id
+		r.Method(http.MethodGet, "/", bastion.HandlerFunc(get))       // GET /todos/{id} - read a single todo by :id
+		r.Method(http.MethodPut, "/", bastion.HandlerFunc(update))    // PUT /todos/{id} - update a single todo by :id
+		r.Method(http.MethodDelete, "/", bastion.HandlerFunc(delete)) // DELETE /todos/{id} - delete a single todo by :id
 	})
 
-	r.Get("/error500", error500) // GET /panic - testing 500 error
+	r.Method(http.MethodGet, "/error500", bastion.HandlerFunc(error500)) // GET /error500 - testing 500 error
 
 	return r
 }
 
-func list(w http.ResponseWriter, r *http.Request) {
+func list(w http.ResponseWriter, r *http.Request) error {
 	todo1 := todo{Description: "do something 1"}
 	todo2 := todo{Description: "do something 2"}
 	render.JSON.Send(w, []todo{todo1, todo2})
+	return nil
 }
 
-func create(w http.ResponseWriter, r *http.Request) {
+func decode(r *http.Request) (todo, error) {
 	var todo1 todo
 	if err := json.NewDecoder(r.Body).Decode(&todo1); err != nil {
-		panic(err) // the error should be handle
+		return todo1, bastion.UnprocessableEntity("cannot decode todo").WithCode("invalid_todo").Wrap(err)
 	}
-	render.JSON.Created(w, todo1)
+	return todo1, nil
 }
 
-func get(w http.ResponseWriter, r *http.Request) {
+func todoID(r *http.Request) (int, error) {
 	id := chi.URLParam(r, "id")
-	i, _ := strconv.Atoi(id) // the error should be handle
-	todo1 := todo{ID: i, Description: fmt.Sprintf("do something %v", id)}
+	i, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, bastion.NotFound(fmt.Sprintf("todo %v not found", id)).WithCode("todo_not_found")
+	}
+	return i, nil
+}
+
+func create(w http.ResponseWriter, r *http.Request) error {
+	todo1, err := decode(r)
+	if err != nil {
+		return err
+	}
+	render.JSON.Created(w, todo1)
+	return nil
+}
+
+func get(w http.ResponseWriter, r *http.Request) error {
+	i, err := todoID(r)
+	if err != nil {
+		return err
+	}
+	todo1 := todo{ID: i, Description: fmt.Sprintf("do something %v", i)}
 	render.JSON.Send(w, todo1)
+	return nil
 }
 
-func update(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	i, _ := strconv.Atoi(id) // the error should be handle
-	var todo1 todo
-	if err := json.NewDecoder(r.Body).Decode(&todo1); err != nil {
-		panic(err) // the error should be handle
+func update(w http.ResponseWriter, r *http.Request) error {
+	i, err := todoID(r)
+	if err != nil {
+		return err
+	}
+	todo1, err := decode(r)
+	if err != nil {
+		return err
 	}
 	todo1.ID = i
 	render.JSON.Send(w, todo1)
+	return nil
 }
 
-func delete(w http.ResponseWriter, r *http.Request) {
+func delete(w http.ResponseWriter, r *http.Request) error {
 	// handle delete logic
 	render.JSON.NoContent(w)
+	return nil
 }
 
-func error500(w http.ResponseWriter, r *http.Request) {
-	err := errors.New("test")
-	render.JSON.InternalServerError(w, err)
+func error500(w http.ResponseWriter, r *http.Request) error {
+	return errors.New("test")
 }
@@ -85,3 +85,27 @@ func Test500Err(t *testing.T) {
 		JSON().
 		Object().ContainsMap(expectedRes)
 }
+
+func TestHandlerCreateBadBody(t *testing.T) {
+	app := setup()
+	e := bastion.Tester(t, app)
+
+	expectedRes := map[string]interface{}{
+		"message": "cannot decode todo",
+		"error":   "Unprocessable Entity",
+		"status":  422,
+		"code":    "invalid_todo",
+	}
+	e.POST("/todo/").WithText("{").Expect().
+		Status(http.StatusUnprocessableEntity).
+		JSON().Object().Equal(expectedRes)
+}
+
+func TestHandlerGetNotFound(t *testing.T) {
+	app := setup()
+	e := bastion.Tester(t, app)
+
+	e.GET("/todo/abc").Expect().
+		Status(http.StatusNotFound).
+		JSON().Object().ValueEqual("code", "todo_not_found").ValueEqual("message", "todo abc not found")
+}
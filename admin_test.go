@@ -0,0 +1,88 @@
+package bastion
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	res, err := client.Get(url)
+	require.Nil(t, err)
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	return res.StatusCode, string(body)
+}
+
+func TestAdminServer(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bastion-admin")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	adminSock := filepath.Join(dir, "admin.sock")
+
+	out := &syncWriter{w: &bytes.Buffer{}}
+	app := New(DisablePrettyLogging(), LoggerOutput(out), AdminAddr("unix:"+adminSock), AdminOnlyMetrics())
+	app.Get("/hello", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	ln, err := listen("127.0.0.1:0")
+	require.Nil(t, err)
+	done := make(chan error, 1)
+	go func() { done <- app.ServeListener(ln) }()
+
+	// wait until the admin listener is ready
+	admin := unixClient(adminSock)
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(adminSock); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	public := "http://" + ln.Addr().String()
+	status, body := get(t, http.DefaultClient, public+"/hello")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "hello", body)
+	for _, path := range []string{"/ping", "/health/ready", "/metrics", "/debug/routes", "/debug/pprof/"} {
+		status, _ = get(t, http.DefaultClient, public+path)
+		assert.Equal(t, http.StatusNotFound, status, path)
+	}
+
+	status, body = get(t, admin, "http://admin/ping")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "pong", body)
+	status, _ = get(t, admin, "http://admin/health/ready")
+	assert.Equal(t, http.StatusOK, status)
+	status, body = get(t, admin, "http://admin/debug/routes")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"pattern":"/hello"`)
+	status, body = get(t, admin, "http://admin/metrics")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `route="/hello"`)
+	status, _ = get(t, admin, "http://admin/hello")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	app.Shutdown()
+	assert.Equal(t, http.ErrServerClosed, <-done)
+	assert.Contains(t, out.String(), "admin starting at unix:"+adminSock)
+	_, err = os.Stat(adminSock)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAdminAddrWithEnv(t *testing.T) {
+	os.Setenv("ADMIN_ADDR", ":9090")
+	defer os.Unsetenv("ADMIN_ADDR")
+	app := New()
+	assert.Equal(t, ":9090", app.AdminAddr)
+	assert.NotNil(t, app.adminServer)
+	assert.Equal(t, ":9091", New(AdminAddr(":9091")).AdminAddr)
+}
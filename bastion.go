@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/go-chi/chi"
@@ -14,6 +16,9 @@ import (
 	"github.com/markbates/sigtx"
 	"github.com/rs/zerolog"
 
+	"github.com/ifreddyrondon/bastion/health"
+	"github.com/ifreddyrondon/bastion/logsink"
+	"github.com/ifreddyrondon/bastion/metrics"
 	"github.com/ifreddyrondon/bastion/middleware"
 	"github.com/ifreddyrondon/bastion/render"
 )
@@ -32,29 +37,86 @@ type OnShutdown func()
 // of mounting an API router, it will define the routes and middleware of the application with the app logic.
 // Without a Bastion you can't do much!
 type Bastion struct {
-	r      *chi.Mux
-	server *http.Server
-	logger zerolog.Logger
+	r             *chi.Mux
+	server        *http.Server
+	admin         *chi.Mux
+	adminServer   *http.Server
+	logger        zerolog.Logger
+	logOutput     *logOutput
+	logFile       *logsink.RotatingFile
+	logAsync      *logsink.AsyncWriter
+	logLevels     *logLevels
+	health        *health.Health
+	metrics       *metrics.Registry
+	startHooks    []StartHook
+	readyHooks    []ReadyHook
+	shutdownHooks []shutdownHook
+	quit          chan struct{}
+	quitOnce      sync.Once
+	draining      int32
+	config        interface{}
 	Options
 	*chi.Mux
 }
 
 // New returns a new instance of Bastion and adds some sane, and useful, defaults.
+// It panics when the options are invalid, use Build to get the error instead.
 func New(opts ...Opt) *Bastion {
+	app, err := Build(opts...)
+	if err != nil {
+		panic(err.Error())
+	}
+	return app
+}
+
+// Build returns a new instance of Bastion like New. The options are validated and every problem found,
+// ie. unknown mode or logger level, invalid env vars or configuration and a logger file that can't be
+// opened, is returned in a single *OptionsError.
+func Build(opts ...Opt) (*Bastion, error) {
 	app := &Bastion{
-		server: &http.Server{},
+		server:  &http.Server{},
+		health:  health.New(),
+		metrics: metrics.NewRegistry(),
+		quit:    make(chan struct{}),
 	}
 	for _, opt := range opts {
 		opt(app)
 	}
-	setDefaultsOpts(&app.Options)
-	l := getLogger(&app.Options)
-	app.r = router(app.Options, *l)
+	var p problems
+	if app.config != nil {
+		p.check(app.applyConfig())
+	}
+	setDefaultsOpts(&app.Options, &p)
+	app.server.ReadTimeout = app.ReadTimeout
+	app.server.ReadHeaderTimeout = app.ReadHeaderTimeout
+	app.server.WriteTimeout = app.WriteTimeout
+	app.server.IdleTimeout = app.IdleTimeout
+	app.server.MaxHeaderBytes = app.MaxHeaderBytes
+	if app.AdminAddr != "" {
+		// the profiler needs longer read and write timeouts than the app routes
+		app.adminServer = &http.Server{
+			ReadHeaderTimeout: app.ReadHeaderTimeout,
+			IdleTimeout:       app.IdleTimeout,
+			MaxHeaderBytes:    app.MaxHeaderBytes,
+		}
+	}
+	out := app.openLogSinks(&p)
+	if len(p) > 0 {
+		app.Close()
+		return nil, &OptionsError{Problems: p}
+	}
+	app.logOutput = newLogOutput(out)
+	logOpts := app.Options
+	logOpts.LoggerOutput = app.logOutput
+	app.logLevels = newLogLevels(app.level)
+	l := getLogger(&logOpts, app.logLevels)
 	app.Mux = chi.NewMux()
-	app.r.Mount("/", app.Mux)
+	app.Mux.NotFound(notFound(app.ErrorRenderer))
+	app.Mux.MethodNotAllowed(notAllowed(app.ErrorRenderer))
+	app.r = app.router(*l)
 	app.logger = l.With().Str("module", "bastion").Logger()
 
-	if app.IsDebug() {
+	if app.Mode == DebugMode {
 		app.logger.Debug().Msg(`Running in "debug" mode. Switch to "production" mode in production.
  - using code:  bastion.New(bastion.Mode("production"))
  - using env: export GO_ENV=production
@@ -62,18 +124,39 @@ func New(opts ...Opt) *Bastion {
 
 `)
 	}
+	if app.AdminOnlyMetrics && app.admin == nil && !app.DisableMetrics {
+		app.logger.Warn().Str("component", "metrics").
+			Msg("AdminOnlyMetrics without AdminAddr, the metrics are recorded but not served")
+	}
+	if app.config != nil && app.IsDebug() {
+		app.logger.Debug().Fields(app.configDump()).Msg("effective configuration")
+	}
 
-	return app
+	return app, nil
 }
 
-func router(opts Options, l zerolog.Logger) *chi.Mux {
+func (app *Bastion) router(l zerolog.Logger) *chi.Mux {
+	opts := app.Options
 	mux := chi.NewMux()
-	mux.NotFound(notFound)
-	mux.MethodNotAllowed(notAllowed)
+	mux.NotFound(notFound(opts.ErrorRenderer))
+	mux.MethodNotAllowed(notAllowed(opts.ErrorRenderer))
+	// operational routes are served by the app router unless an admin address is set
+	ops := chi.Router(mux)
+	if opts.AdminAddr != "" {
+		app.admin = chi.NewMux()
+		app.admin.NotFound(notFound(opts.ErrorRenderer))
+		app.admin.MethodNotAllowed(notAllowed(opts.ErrorRenderer))
+		ops = app.admin
+	}
+
 	// logger middleware
 	if !opts.DisableLoggerMiddleware {
 		logMiddleware := []middleware.LoggerOpt{
 			middleware.AttachLogger(l),
+			middleware.LoggerRedactor(opts.redactor),
+		}
+		if opts.AccessLogSampler != nil {
+			logMiddleware = append(logMiddleware, middleware.SampleAccessLog(opts.AccessLogSampler))
 		}
 		if !opts.IsDebug() {
 			logMiddleware = append(
@@ -85,62 +168,141 @@ func router(opts Options, l zerolog.Logger) *chi.Mux {
 		}
 		logger := middleware.Logger(logMiddleware...)
 		mux.Use(logger)
+		if app.admin != nil {
+			app.admin.Use(logger)
+		}
 	}
 
+	var appMiddleware, errMiddleware []func(http.Handler) http.Handler
+	// metrics middleware, first to record the final status of the response
+	if !opts.DisableMetrics {
+		appMiddleware = append(appMiddleware, middleware.Metrics(middleware.MetricsRegistry(app.metrics)))
+	}
+	// error mapper of the HandlerFunc handlers
+	appMiddleware = append(appMiddleware, UseErrorMapper(opts.ErrorMapper))
+	// tracing middleware, after the logger middleware to add the trace ids to the request logger
+	if opts.EnableTracing {
+		appMiddleware = append(appMiddleware, middleware.Tracing(middleware.TracingExporter(opts.TracingExporter)))
+	}
 	// internal error middleware
 	if !opts.DisableInternalErrorMiddleware {
 		internalErr := middleware.InternalError(
 			middleware.InternalErrMsg(errors.New(opts.InternalErrMsg)),
-			middleware.InternalErrLoggerOutput(opts.LoggerOutput),
+			middleware.InternalErrLoggerOutput(app.logLevels.writer(app.logOutput, false)),
+			middleware.InternalErrRedactor(opts.redactor),
+			middleware.InternalErrRenderer(opts.ErrorRenderer),
 		)
-		mux.Use(internalErr)
+		errMiddleware = append(errMiddleware, internalErr)
 	}
 
 	// recovery middleware
 	if !opts.DisableRecoveryMiddleware {
-		recovery := middleware.Recovery(middleware.RecoveryLoggerOutput(opts.LoggerOutput))
-		mux.Use(recovery)
+		recovery := middleware.Recovery(
+			middleware.RecoveryLoggerOutput(app.logLevels.writer(app.logOutput, false)),
+			middleware.RecoveryRedactor(opts.redactor),
+			middleware.RecoveryRenderer(opts.ErrorRenderer),
+		)
+		errMiddleware = append(errMiddleware, recovery)
 	}
+	// the internal error and recovery middleware are applied to the operational and the app routes
+	ops = ops.With(errMiddleware...)
+	appMiddleware = append(appMiddleware, errMiddleware...)
 
 	if !opts.DisablePingRouter {
-		mux.Get("/ping", pingHandler)
+		ops.Get("/ping", app.pingHandler)
+	}
+	if !opts.DisableHealthRouter {
+		ops.Mount(opts.HealthRoutePrefix, app.health.Router())
+	}
+	// the metrics aren't public when they are only served on the admin listener
+	if !opts.DisableMetrics && (app.admin != nil || !opts.AdminOnlyMetrics) {
+		ops.Method(http.MethodGet, opts.MetricsRoute, app.metrics.Handler())
+	}
+	if opts.OpenAPIRoute != "" {
+		ops.Get(opts.OpenAPIRoute, app.openAPIHandler)
+		ops.Get(opts.OpenAPIRoute+".json", app.openAPIHandler)
+		ops.Get(opts.OpenAPIRoute+".yaml", app.openAPIHandler)
+	}
+	if opts.LoggerLevelToken != "" {
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+			ops.MethodFunc(method, opts.ProfilerRoutePrefix+loggerLevelRoute, app.loggerLevelHandler)
+		}
 	}
 	if opts.EnableProfiler {
-		mux.Mount(opts.ProfilerRoutePrefix, chiMiddleware.Profiler())
+		ops.Get(opts.ProfilerRoutePrefix+"/routes", app.routesHandler)
+		ops.Mount(opts.ProfilerRoutePrefix, chiMiddleware.Profiler())
 	}
+	mux.With(appMiddleware...).Mount("/", app.Mux)
 
 	return mux
 }
 
-func notFound(w http.ResponseWriter, r *http.Request) {
-	render.JSON.NotFound(w, fmt.Errorf("resource %s not found", r.URL.Path))
+func notFound(renderer render.APIRenderer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := fmt.Errorf("resource %s not found", r.URL.Path)
+		renderer := render.ForRequest(renderer, r)
+		if problemInstance(renderer, w, r, http.StatusNotFound, err) {
+			return
+		}
+		renderer.NotFound(w, err)
+	}
 }
 
-func notAllowed(w http.ResponseWriter, r *http.Request) {
-	err := fmt.Errorf("method %s not allowed for resource %s", r.Method, r.URL.Path)
-	render.JSON.MethodNotAllowed(w, err)
+func notAllowed(renderer render.APIRenderer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := fmt.Errorf("method %s not allowed for resource %s", r.Method, r.URL.Path)
+		renderer := render.ForRequest(renderer, r)
+		if problemInstance(renderer, w, r, http.StatusMethodNotAllowed, err) {
+			return
+		}
+		renderer.MethodNotAllowed(w, err)
+	}
 }
 
-func printRoutes(mux *chi.Mux, opts Options, l *zerolog.Logger) {
-	walkFunc := func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
-		if strings.HasPrefix(route, opts.ProfilerRoutePrefix) {
-			return nil
-		}
-		route = strings.Replace(route, "/*/", "/", -1)
-		l.Debug().Str("component", "route").Msgf("%s %s", method, route)
-		return nil
+// problemInstance renders the error as a problem with the request path as instance when the renderer,
+// or the one negotiated for the request, is a *render.ProblemRenderer. It reports whether it was rendered.
+func problemInstance(renderer render.APIRenderer, w http.ResponseWriter, r *http.Request, status int, err error) bool {
+	if _, ok := render.Selected(renderer).(*render.ProblemRenderer); !ok {
+		return false
 	}
+	problem := render.NewProblem(status, err.Error())
+	problem.Instance = r.URL.Path
+	renderer.Response(w, status, problem)
+	return true
+}
 
-	if err := chi.Walk(mux, walkFunc); err != nil {
+func printRoutes(mux *chi.Mux, opts Options, l *zerolog.Logger) {
+	routes, err := walkRoutes(mux)
+	if err != nil {
 		l.Error().Err(err).Msgf("walking through the routes")
+		return
 	}
+	for _, route := range routes {
+		if strings.HasPrefix(route.Pattern, opts.ProfilerRoutePrefix) {
+			continue
+		}
+		l.Debug().Str("component", "route").Msgf("%s %s", route.Method, route.Pattern)
+	}
+}
+
+// RegisterHealthChecker registers a named checker run by the readiness probe at HealthRoutePrefix/ready.
+// The options allow to set the check timeout, the criticality, a cache for the result or to run it also
+// in the liveness probe at HealthRoutePrefix/live.
+func (app *Bastion) RegisterHealthChecker(name string, checker health.Checker, opts ...health.CheckOpt) {
+	app.health.Register(name, checker, opts...)
+}
+
+// Metrics returns the registry of the metrics served at MetricsRoute, it allows to register app metrics.
+func (app *Bastion) Metrics() *metrics.Registry {
+	return app.metrics
 }
 
 // RegisterOnShutdown registers a function to call on Shutdown.
 // This can be used to gracefully shutdown connections that have
 // undergone NPN/ALPN protocol upgrade or that have been hijacked.
 // This function should start protocol-specific graceful shutdown,
-// but should not wait for shutdown to complete.
+// but should not wait for shutdown to complete. The functions run concurrently,
+// use the OnShutdown method for ordered hooks with a deadline and error reporting.
 func (app *Bastion) RegisterOnShutdown(fs ...OnShutdown) {
 	for _, f := range fs {
 		app.server.RegisterOnShutdown(f)
@@ -148,22 +310,126 @@ func (app *Bastion) RegisterOnShutdown(fs ...OnShutdown) {
 }
 
 // Serve accepts incoming connections coming from the specified address/port.
-// It is a shortcut for http.ListenAndServe(addr, router).
+// When the AdminAddr option is set the operational routes are served on it by a second server.
+// It is a shortcut for http.ListenAndServe(addr, router), or http.ListenAndServeTLS when
+// the TLS options are set. The address can be a unix domain socket using the "unix:" prefix
+// (unix:/run/app.sock). When no address is given the sockets inherited through socket activation
+// (LISTEN_FDS and LISTEN_PID env) are used, otherwise the ADDR env or the default address.
 // Note: this method will block the calling goroutine indefinitely unless an error happens.
 func (app *Bastion) Serve(addr ...string) error {
+	ln, err := resolveListener(addr, &app.logger)
+	if err != nil {
+		app.logger.Error().Str("component", "Serve").Err(err).Msg("listen")
+		return err
+	}
+	return app.ServeListener(ln)
+}
+
+// ServeTLS is like Serve but it serves the app with TLS using the given certificate and key files.
+// The certificate is reloaded when the files change or a SIGHUP signal is received.
+func (app *Bastion) ServeTLS(certFile, keyFile string, addr ...string) error {
+	app.TLSCertFile = certFile
+	app.TLSKeyFile = keyFile
+	var p problems
+	resolveTLS(&app.Options, &p)
+	if len(p) > 0 {
+		return &OptionsError{Problems: p}
+	}
+	return app.Serve(addr...)
+}
+
+// ServeListener accepts incoming connections on the given listener. It has the same
+// behavior than Serve regarding to TLS, logging and graceful shutdown.
+// Note: this method will block the calling goroutine indefinitely unless an error happens.
+// The buffered logs are written and the logger file closed when it returns.
+func (app *Bastion) ServeListener(ln net.Listener) error {
+	defer app.Close()
 	ctx, cancel := sigtx.WithCancel(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGKILL)
 	defer cancel()
 
-	go graceful(ctx, app.server, &app.logger)
-
-	address := resolveAddress(addr, &app.logger)
-	app.logger.Info().Msgf("app starting at %v", address)
-	app.server.Addr = address
+	app.logger.Info().Msgf("app starting at %v", listenerAddr(ln))
+	app.server.Addr = ln.Addr().String()
 	app.server.Handler = app.r
+	if app.H2C {
+		h, err := h2cHandler(app.server, app.r)
+		if err != nil {
+			ln.Close()
+			app.logger.Error().Str("component", "Serve").Err(err).Msg("setting up h2c")
+			return err
+		}
+		app.server.Handler = h
+	}
+
+	if app.IsTLS() {
+		reloader, err := newCertReloader(app.TLSCertFile, app.TLSKeyFile)
+		if err != nil {
+			ln.Close()
+			app.logger.Error().Str("component", "Serve").Err(err).Msg("loading tls certificate")
+			return err
+		}
+		cfg, err := tlsConfig(app.Options, reloader)
+		if err != nil {
+			ln.Close()
+			app.logger.Error().Str("component", "Serve").Err(err).Msg("setting up tls")
+			return err
+		}
+		app.server.TLSConfig = cfg
+		go reloader.watch(ctx, defaultTLSReloadInterval, &app.logger)
+	}
+	if app.LoggerLevelSignals {
+		go app.logLevels.watchSignals(ctx, app.LoggerLevelTTL, &app.logger)
+	}
+
+	var adminLn net.Listener
+	if app.adminServer != nil {
+		var err error
+		adminLn, err = listen(app.AdminAddr)
+		if err != nil {
+			ln.Close()
+			app.logger.Error().Str("component", "Serve").Err(err).Msg("listen admin")
+			return err
+		}
+	}
+
+	if started, err := app.start(ctx); err != nil {
+		ln.Close()
+		if adminLn != nil {
+			adminLn.Close()
+		}
+		app.logger.Error().Str("component", "Serve").Err(err).Msg("starting")
+		// release what the succeeded start hooks acquired
+		logger := app.logger.With().Str("component", "graceful").Logger()
+		app.stop(&logger, started)
+		return err
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-app.quit:
+		}
+		app.graceful()
+		close(stopped)
+	}()
+
+	if adminLn != nil {
+		app.logger.Info().Msgf("admin starting at %v", listenerAddr(adminLn))
+		app.adminServer.Handler = app.admin
+		go func() {
+			if err := app.adminServer.Serve(adminLn); err != nil && err != http.ErrServerClosed {
+				app.logger.Error().Str("component", "Serve").Err(err).Msg("admin listenAndServe")
+			}
+		}()
+	}
 
 	printRoutes(app.r, app.Options, &app.logger)
-	if err := app.server.ListenAndServe(); err != nil {
+	addr := listenerAddr(ln)
+	ln = &readyListener{Listener: ln, ready: func() { app.ready(addr) }}
+	if err := app.serve(ln); err != nil {
 		if err == http.ErrServerClosed {
+			// wait until the connections are drained and the shutdown hooks are done
+			<-stopped
 			app.logger.Info().Str("component", "Serve").Msg("http: Server closed")
 			return err
 		}
@@ -173,30 +439,35 @@ func (app *Bastion) Serve(addr ...string) error {
 	return nil
 }
 
-func graceful(ctx context.Context, server *http.Server, l *zerolog.Logger) {
-	<-ctx.Done()
-	logger := l.With().Str("component", "graceful").Logger()
-	logger.Info().Msg("preparing for shutdown")
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Error().Err(err)
-		return
+func (app *Bastion) serve(ln net.Listener) error {
+	if app.IsTLS() {
+		// the certificate is given by TLSConfig.GetCertificate
+		return app.server.ServeTLS(ln, "", "")
+	}
+	return app.server.Serve(ln)
+}
+
+func listenerAddr(ln net.Listener) string {
+	addr := ln.Addr()
+	if addr.Network() == "unix" {
+		return unixAddrPrefix + addr.String()
 	}
-	logger.Info().Msg("gracefully stopped")
+	return addr.String()
 }
 
-func resolveAddress(addr []string, l *zerolog.Logger) string {
+func resolveAddress(addr []string, l *zerolog.Logger) (string, error) {
 	switch len(addr) {
 	case 0:
 		if envAddr := os.Getenv("ADDR"); envAddr != "" {
 			l.Debug().Msgf(`Environment variable ADDR="%s"`, envAddr)
-			return envAddr
+			return envAddr, nil
 		}
 		l.Debug().Msg("Environment variable ADDR is undefined. Using addr :8080 by default")
-		return defaultAddr
+		return defaultAddr, nil
 	case 1:
-		return addr[0]
+		return addr[0], nil
 	default:
-		panic("too much parameters")
+		return "", fmt.Errorf("bastion expects at most one address, got %v", len(addr))
 	}
 }
 
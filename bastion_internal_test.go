@@ -2,11 +2,11 @@ package bastion
 
 import (
 	"bytes"
-	"context"
 	"net/http"
 	"os"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/stretchr/testify/assert"
@@ -15,37 +15,28 @@ import (
 
 func handler(w http.ResponseWriter, r *http.Request) {}
 
-func isServerClosed(server *http.Server, ch chan<- bool) {
-	for {
-		if err := server.ListenAndServe(); err != nil {
-			ch <- true
-			return
-		}
-	}
-}
-
 func TestGracefulShutdown(t *testing.T) {
 	t.Parallel()
 
 	app := New()
-	visited := false
-	mu := sync.RWMutex{}
+	visited := make(chan bool, 1)
 	f := func() {
-		mu.Lock()
-		visited = true
-		mu.Unlock()
+		visited <- true
 	}
 	app.RegisterOnShutdown(f)
-	ctx, cancel := context.WithCancel(context.Background())
-	go graceful(ctx, app.server, &app.logger)
-	cancel()
-	ch := make(chan bool, 1)
-	isServerClosed(app.server, ch)
-	<-ch
-
-	mu.RLock()
-	require.True(t, visited)
-	mu.RUnlock()
+	ln, err := listen("127.0.0.1:0")
+	require.Nil(t, err)
+	done := make(chan error, 1)
+	go func() { done <- app.ServeListener(ln) }()
+	app.Shutdown()
+	assert.Equal(t, http.ErrServerClosed, <-done)
+
+	select {
+	case v := <-visited:
+		require.True(t, v)
+	case <-time.After(time.Second):
+		t.Fatal("on shutdown function was not called")
+	}
 }
 
 func TestPrintRoutes(t *testing.T) {
@@ -96,7 +87,8 @@ func TestResolveAddress(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			out := &bytes.Buffer{}
 			app := New(DisablePrettyLogging(), LoggerOutput(out))
-			addr := resolveAddress(tc.givenAddr, &app.logger)
+			addr, err := resolveAddress(tc.givenAddr, &app.logger)
+			assert.Nil(t, err)
 			assert.Equal(t, tc.expectedAddr, addr)
 			assert.Contains(t, out.String(), tc.outputLog)
 		})
@@ -108,17 +100,61 @@ func TestResolveAddressWithEnv(t *testing.T) {
 	out := &bytes.Buffer{}
 	app := New(DisablePrettyLogging(), LoggerOutput(out))
 	os.Setenv("ADDR", ":3000")
-	addr := resolveAddress(nil, &app.logger)
+	addr, err := resolveAddress(nil, &app.logger)
+	assert.Nil(t, err)
 	assert.Equal(t, ":3000", addr)
 	assert.Contains(t, out.String(), `Environment variable ADDR=\":3000\"`)
 	os.Setenv("ADDR", tempADDR)
 }
 
-func TestResolveAddressPanic(t *testing.T) {
+func TestResolveAddressTooMany(t *testing.T) {
 	t.Parallel()
 
-	f := func() {
-		resolveAddress([]string{":3000", ":8080"}, nil)
+	_, err := resolveAddress([]string{":3000", ":8080"}, nil)
+	assert.EqualError(t, err, "bastion expects at most one address, got 2")
+}
+
+// syncWriter is a goroutine safe writer used to capture the logs of a running server.
+type syncWriter struct {
+	mu sync.Mutex
+	w  *bytes.Buffer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+func (s *syncWriter) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.String()
+}
+
+func TestServerLimits(t *testing.T) {
+	t.Parallel()
+
+	app := New(Mode(ProductionMode), MaxHeaderBytes(4096))
+	assert.Equal(t, 30*time.Second, app.server.ReadTimeout)
+	assert.Equal(t, 5*time.Second, app.server.ReadHeaderTimeout)
+	assert.Equal(t, 60*time.Second, app.server.WriteTimeout)
+	assert.Equal(t, 120*time.Second, app.server.IdleTimeout)
+	assert.Equal(t, 4096, app.server.MaxHeaderBytes)
+}
+
+func TestSnakeCase(t *testing.T) {
+	t.Parallel()
+
+	tt := map[string]string{
+		"Mode":              "mode",
+		"ReadHeaderTimeout": "read_header_timeout",
+		"TLSClientCAFile":   "tls_client_ca_file",
+		"OpenAPIRoute":      "open_api_route",
+		"Workers2":          "workers2",
+		"ID":                "id",
+	}
+	for name, expected := range tt {
+		assert.Equal(t, expected, snakeCase(name))
 	}
-	assert.PanicsWithValue(t, "too much parameters", f)
 }
@@ -1,14 +1,22 @@
 package bastion_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/gavv/httpexpect.v1"
 
+	"github.com/ifreddyrondon/bastion/health"
+	"github.com/ifreddyrondon/bastion/openapi"
+	"github.com/ifreddyrondon/bastion/redact"
 	"github.com/ifreddyrondon/bastion/render"
+	"github.com/ifreddyrondon/bastion/tracing"
 
 	"github.com/ifreddyrondon/bastion"
 )
@@ -99,3 +107,369 @@ func TestNewRouter(t *testing.T) {
 	r := bastion.NewRouter()
 	assert.NotNil(t, r)
 }
+
+func TestHealthRoutes(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New()
+	app.RegisterHealthChecker("db", health.CheckerFunc(func(context.Context) error {
+		return errors.New("connection refused")
+	}))
+	e := bastion.Tester(t, app)
+	e.GET("/health/live").Expect().
+		Status(http.StatusOK).
+		JSON().Object().ValueEqual("status", "up")
+	e.GET("/health/ready").Expect().
+		Status(http.StatusServiceUnavailable).
+		JSON().Object().ValueEqual("status", "down")
+}
+
+func TestDisableHealthRouter(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New(bastion.DisableHealthRouter())
+	e := bastion.Tester(t, app)
+	e.GET("/health/ready").Expect().Status(http.StatusNotFound)
+}
+
+func TestMetricsRoute(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New(bastion.MetricsRoute("stats"))
+	app.Get("/todos/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("todo"))
+	})
+	e := bastion.Tester(t, app)
+	e.GET("/todos/1").Expect().Status(http.StatusOK)
+	body := e.GET("/stats").Expect().Status(http.StatusOK).
+		ContentType("text/plain").Body()
+	body.Contains(`http_requests_total{method="GET",route="/todos/{id}",code="200"} 1`)
+	body.NotContains("/stats")
+	e.GET("/metrics").Expect().Status(http.StatusNotFound)
+}
+
+func TestDisableMetrics(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New(bastion.DisableMetrics())
+	e := bastion.Tester(t, app)
+	e.GET("/metrics").Expect().Status(http.StatusNotFound)
+}
+
+func TestAdminOnlyMetrics(t *testing.T) {
+	t.Parallel()
+
+	logs := &bytes.Buffer{}
+	app := bastion.New(bastion.AdminOnlyMetrics(), bastion.DisablePrettyLogging(), bastion.LoggerOutput(logs))
+	app.Get("/todos", func(w http.ResponseWriter, r *http.Request) {})
+	assert.Contains(t, logs.String(), `"message":"AdminOnlyMetrics without AdminAddr, the metrics are recorded but not served"`)
+	e := bastion.Tester(t, app)
+	e.GET("/todos").Expect().Status(http.StatusOK)
+	e.GET("/metrics").Expect().Status(http.StatusNotFound)
+	// the metrics keep being recorded
+	out := &bytes.Buffer{}
+	assert.Nil(t, app.Metrics().WriteText(out))
+	assert.Contains(t, out.String(), `route="/todos"`)
+}
+
+func TestMetricsProductionMode(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New(bastion.Mode(bastion.ProductionMode), bastion.LoggerOutput(&bytes.Buffer{}))
+	e := bastion.Tester(t, app)
+	e.GET("/metrics").Expect().Status(http.StatusOK)
+}
+
+func TestTracing(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracing.NewInMemoryExporter()
+	app := bastion.New(bastion.Tracing(exporter))
+	app.Get("/todos/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("todo"))
+	})
+	e := bastion.Tester(t, app)
+	e.GET("/todos/1").Expect().Status(http.StatusOK).Header("traceparent").NotEmpty()
+	e.GET("/ping").Expect().Status(http.StatusOK).Header("traceparent").Empty()
+
+	spans := exporter.Spans()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "GET /todos/{id}", spans[0].Name)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New(bastion.OpenAPI("docs", openapi.Info{Title: "todos", Version: "1.0.0"}))
+	app.Method(http.MethodGet, "/todos/{id}", openapi.Describe(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("todo"))
+	}, openapi.Operation{Summary: "get todo"}))
+	e := bastion.Tester(t, app)
+	for _, path := range []string{"/docs", "/docs.json"} {
+		body := e.GET(path).Expect().Status(http.StatusOK).ContentType("application/json").JSON().Object()
+		body.ValueEqual("openapi", openapi.Version)
+		body.Path("$.info.title").Equal("todos")
+		paths := body.Value("paths").Object()
+		paths.Path(`$["/todos/{id}"].get.summary`).Equal("get todo")
+		paths.NotContainsKey("/docs").NotContainsKey("/ping")
+	}
+	e.GET("/docs.yaml").Expect().Status(http.StatusOK).ContentType("application/yaml").
+		Body().Contains("summary: get todo")
+}
+
+func TestOpenAPIErrorRendererSchema(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New(bastion.OpenAPI("docs", openapi.Info{Title: "todos", Version: "1.0.0"}), bastion.ErrorRenderer(render.ProblemJSON))
+	app.Method(http.MethodGet, "/todos/{id}", openapi.Describe(func(w http.ResponseWriter, r *http.Request) {},
+		openapi.Operation{Responses: map[int]interface{}{http.StatusNotFound: nil}}))
+	doc, err := app.OpenAPIDocument()
+	require.Nil(t, err)
+	res := (*doc.Paths["/todos/{id}"])["get"].Responses["404"]
+	assert.Equal(t, "#/components/schemas/Problem", res.Content["application/problem+json"].Schema.Ref)
+	assert.Contains(t, doc.Components.Schemas["Problem"].Properties, "detail")
+	assert.NotContains(t, doc.Components.Schemas, "HTTPError")
+}
+
+func TestOpenAPIDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New()
+	e := bastion.Tester(t, app)
+	e.GET("/openapi").Expect().Status(http.StatusNotFound)
+}
+
+func TestRedaction(t *testing.T) {
+	t.Parallel()
+
+	out := &bytes.Buffer{}
+	app := bastion.New(
+		bastion.Mode(bastion.ProductionMode),
+		bastion.LoggerOutput(out),
+		bastion.Redaction(redact.Policy{Fields: []string{"password"}, Query: []string{"token"}}),
+	)
+	app.Post("/login", func(w http.ResponseWriter, r *http.Request) {
+		panic("login")
+	})
+	e := bastion.Tester(t, app)
+	e.POST("/login").WithQuery("token", "abc").
+		WithHeader("Authorization", "Bearer abc").
+		WithJSON(map[string]string{"password": "abc"}).
+		Expect().Status(http.StatusInternalServerError)
+
+	assert.Contains(t, out.String(), `"authorization":"[REDACTED]"`)
+	assert.Contains(t, out.String(), `"url":"/login?token=[REDACTED]"`)
+	assert.NotContains(t, out.String(), "abc")
+}
+
+func TestRedactionBadPattern(t *testing.T) {
+	t.Parallel()
+
+	_, err := bastion.Build(bastion.Redaction(redact.Policy{Patterns: []string{"("}}))
+	assert.EqualError(t, err, "bastion redact pattern \"(\": error parsing regexp: missing closing ): `(`")
+}
+
+func TestErrorRendererProblemDetails(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New(bastion.ErrorRenderer(render.ProblemJSON), bastion.DisablePrettyLogging(), bastion.LoggerOutput(&bytes.Buffer{}))
+	app.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	app.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("connection refused"))
+	})
+	app.Method(http.MethodGet, "/todos/1", bastion.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return bastion.NotFound("todo not found").WithCode("todo_not_found")
+	}))
+	e := bastion.Tester(t, app)
+
+	tt := []struct {
+		name     string
+		req      *httpexpect.Request
+		status   int
+		expected string
+	}{
+		{
+			"not found",
+			e.GET("/abc"),
+			http.StatusNotFound,
+			`{"type":"about:blank","title":"Not Found","status":404,"detail":"resource /abc not found","instance":"/abc"}`,
+		},
+		{
+			"method not allowed",
+			e.POST("/fail"),
+			http.StatusMethodNotAllowed,
+			`{"type":"about:blank","title":"Method Not Allowed","status":405,"detail":"method POST not allowed for resource /fail","instance":"/fail"}`,
+		},
+		{
+			"recovery",
+			e.GET("/panic"),
+			http.StatusInternalServerError,
+			`{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"looks like something went wrong"}`,
+		},
+		{
+			"internal error",
+			e.GET("/fail"),
+			http.StatusInternalServerError,
+			`{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"looks like something went wrong"}`,
+		},
+		{
+			"error mapper",
+			e.GET("/todos/1"),
+			http.StatusNotFound,
+			`{"type":"about:blank","title":"Not Found","status":404,"detail":"todo not found","code":"todo_not_found"}`,
+		},
+	}
+
+	for _, tc := range tt {
+		body := tc.req.Expect().Status(tc.status).ContentType("application/problem+json").Body().Raw()
+		assert.JSONEq(t, tc.expected, body, tc.name)
+	}
+}
+
+func TestErrorRendererNegotiateProblemInstance(t *testing.T) {
+	t.Parallel()
+
+	n := render.NewNegotiator(render.Offer("application/json", render.JSON), render.Offer("application/problem+json", render.ProblemJSON))
+	app := bastion.New(bastion.ErrorRenderer(n))
+	e := bastion.Tester(t, app)
+
+	res := e.GET("/abc").WithHeader("Accept", "application/problem+json").Expect().
+		Status(http.StatusNotFound).ContentType("application/problem+json")
+	res.Header("Vary").Equal("Accept")
+	res.Body().Contains(`"instance":"/abc"`)
+	e.GET("/abc").Expect().Status(http.StatusNotFound).JSON().Object().NotContainsKey("instance")
+}
+
+func TestErrorRendererNegotiate(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New(bastion.ErrorRenderer(render.Negotiate), bastion.DisablePrettyLogging(), bastion.LoggerOutput(&bytes.Buffer{}))
+	app.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	app.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("connection refused"))
+	})
+	app.Method(http.MethodGet, "/todos/1", bastion.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return bastion.NotFound("todo not found").WithCode("todo_not_found")
+	}))
+	e := bastion.Tester(t, app)
+
+	tt := []struct {
+		name     string
+		req      *httpexpect.Request
+		status   int
+		expected string
+	}{
+		{"not found", e.GET("/abc"), http.StatusNotFound, `message="resource /abc not found"`},
+		{"method not allowed", e.POST("/fail"), http.StatusMethodNotAllowed, `message="method POST not allowed for resource /fail"`},
+		{"recovery", e.GET("/panic"), http.StatusInternalServerError, `message="looks like something went wrong"`},
+		{"internal error", e.GET("/fail"), http.StatusInternalServerError, `message="looks like something went wrong"`},
+		{"error mapper", e.GET("/todos/1"), http.StatusNotFound, `code="todo_not_found"`},
+	}
+
+	for _, tc := range tt {
+		res := tc.req.WithHeader("Accept", "application/xml").Expect()
+		res.Status(tc.status).ContentType("application/xml").Body().Contains(tc.expected)
+		res.Header("Vary").Equal("Accept")
+	}
+
+	// the errors keep their status when no offer is acceptable
+	e.GET("/abc").WithHeader("Accept", "text/csv").
+		Expect().Status(http.StatusNotFound).ContentType("application/json")
+}
+
+func TestLoggerLevelControl(t *testing.T) {
+	t.Parallel()
+
+	out := &bytes.Buffer{}
+	app := bastion.New(
+		bastion.Mode(bastion.ProductionMode),
+		bastion.LoggerOutput(out),
+		bastion.LoggerLevelControl("s3cr3t", 0),
+	)
+	app.Get("/hello", func(w http.ResponseWriter, r *http.Request) {
+		bastion.LoggerFromCtx(r.Context()).Info().Msg("hello handler")
+		w.Write([]byte("hello"))
+	})
+	e := bastion.Tester(t, app)
+
+	e.GET("/debug/loglevel").Expect().Status(http.StatusUnauthorized).Header("WWW-Authenticate").Equal(`Bearer realm="bastion"`)
+	e.PUT("/debug/loglevel").WithHeader("Authorization", "Bearer wrong").Expect().Status(http.StatusUnauthorized)
+
+	auth := e.Builder(func(req *httpexpect.Request) {
+		req.WithHeader("Authorization", "Bearer s3cr3t")
+	})
+	auth.GET("/debug/loglevel").Expect().Status(http.StatusOK).
+		JSON().Equal(map[string]interface{}{"level": "error", "components": map[string]interface{}{}})
+	e.GET("/hello").Expect().Status(http.StatusOK)
+	assert.NotContains(t, out.String(), "hello handler")
+
+	auth.PUT("/debug/loglevel").WithJSON(map[string]string{"level": "info"}).Expect().Status(http.StatusOK).
+		JSON().Object().ValueEqual("level", "info")
+	e.GET("/hello").Expect().Status(http.StatusOK)
+	assert.Contains(t, out.String(), "hello handler")
+	assert.Contains(t, out.String(), `"message":"logger level changed"`)
+
+	auth.PUT("/debug/loglevel").WithJSON(map[string]string{"level": "debug", "component": "graceful", "ttl": "1h"}).
+		Expect().Status(http.StatusOK).
+		JSON().Object().ValueEqual("components", map[string]interface{}{"graceful": "debug"})
+	auth.PUT("/debug/loglevel").WithJSON(map[string]string{"level": "verbose"}).Expect().Status(http.StatusBadRequest).
+		JSON().Object().ValueEqual("message", "bastion logger level unknown: verbose")
+	auth.PUT("/debug/loglevel").WithJSON(map[string]string{"level": "info", "ttl": "soon"}).
+		Expect().Status(http.StatusBadRequest).
+		JSON().Object().ValueEqual("message", "logger level ttl invalid: soon")
+	auth.DELETE("/debug/loglevel").Expect().Status(http.StatusOK).
+		JSON().Equal(map[string]interface{}{"level": "error", "components": map[string]interface{}{}})
+}
+
+func TestLoggerLevelControlErrorRenderer(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New(
+		bastion.Mode(bastion.ProductionMode),
+		bastion.LoggerLevelControl("s3cr3t", 0),
+		bastion.ErrorRenderer(render.ProblemJSON),
+	)
+	e := bastion.Tester(t, app)
+
+	e.GET("/debug/loglevel").Expect().Status(http.StatusUnauthorized).
+		ContentType("application/problem+json").Body().Contains(`"detail":"invalid or missing bearer token"`)
+	e.PUT("/debug/loglevel").WithHeader("Authorization", "Bearer s3cr3t").WithJSON(map[string]string{"level": "verbose"}).
+		Expect().Status(http.StatusBadRequest).
+		ContentType("application/problem+json").Body().Contains(`"detail":"bastion logger level unknown: verbose"`)
+}
+
+func TestLoggerLevelControlDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New(bastion.Mode(bastion.ProductionMode))
+	e := bastion.Tester(t, app)
+	e.GET("/debug/loglevel").Expect().Status(http.StatusNotFound)
+}
+
+func TestSetLoggerLevel(t *testing.T) {
+	t.Parallel()
+
+	out := &bytes.Buffer{}
+	app := bastion.New(bastion.Mode(bastion.ProductionMode), bastion.LoggerOutput(out))
+	app.Get("/hello", func(w http.ResponseWriter, r *http.Request) {
+		bastion.LoggerFromCtx(r.Context()).Debug().Str("component", "hello").Msg("hello handler")
+	})
+	assert.EqualError(t, app.SetLoggerLevel("", "", 0), "bastion logger level unknown: ")
+	assert.Nil(t, app.SetLoggerLevel("hello", bastion.DebugLevel, 0))
+	e := bastion.Tester(t, app)
+	e.GET("/hello").Expect().Status(http.StatusOK)
+	assert.Contains(t, out.String(), "hello handler")
+	assert.NotContains(t, out.String(), `"status":200`)
+
+	app.ResetLoggerLevels()
+	out.Reset()
+	e.GET("/hello").Expect().Status(http.StatusOK)
+	assert.NotContains(t, out.String(), "hello handler")
+}
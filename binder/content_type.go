@@ -0,0 +1,113 @@
+package binder
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ContentType default binder by the Content-Type of the request, it binds JSON, XML and YAML.
+var ContentType = NewContentType(
+	Register("application/json", JSON),
+	Register("application/xml", XML),
+	Register("text/xml", XML),
+	Register("application/yaml", YAML),
+	Register("application/x-yaml", YAML),
+	Register("text/yaml", YAML),
+)
+
+// Register binds the requests of the media type, ie. "application/json", with the binder. The binder
+// registered for "application/<suffix>" binds the structured syntax suffix types too, ie. the
+// "application/vnd.api+json" requests are bound by the "application/json" one.
+func Register(mediaType string, binder Binding) func(*ContentTypeBinder) {
+	return func(c *ContentTypeBinder) {
+		mt := strings.ToLower(mediaType)
+		if _, ok := c.binders[mt]; !ok {
+			c.mediaTypes = append(c.mediaTypes, mt)
+		}
+		c.binders[mt] = binder
+	}
+}
+
+// DefaultMediaType set the media type of the requests without Content-Type. By default they are unsupported.
+func DefaultMediaType(mediaType string) func(*ContentTypeBinder) {
+	return func(c *ContentTypeBinder) {
+		c.defaultMediaType = mediaType
+	}
+}
+
+// UnsupportedMediaTypeError is returned when there isn't a binder for the Content-Type of the request.
+// It should be answered with the 415 Unsupported Media Type status and the supported media types.
+type UnsupportedMediaTypeError struct {
+	// ContentType is the Content-Type of the request.
+	ContentType string
+	// Supported are the registered media types.
+	Supported []string
+}
+
+func (e *UnsupportedMediaTypeError) Error() string {
+	return fmt.Sprintf("unsupported media type %q, supported: %v", e.ContentType, strings.Join(e.Supported, ", "))
+}
+
+// ContentTypeBinder bind the data present in the request with the binder registered for its Content-Type,
+// the parameters like charset are ignored. It returns an *UnsupportedMediaTypeError when there isn't one.
+// It implements the Binding interface.
+type ContentTypeBinder struct {
+	binders          map[string]Binding
+	mediaTypes       []string
+	defaultMediaType string
+}
+
+// NewContentType returns a new ContentTypeBinder instance with the registered binders.
+func NewContentType(opts ...func(*ContentTypeBinder)) *ContentTypeBinder {
+	c := &ContentTypeBinder{binders: map[string]Binding{}}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// MediaTypes returns the registered media types in order.
+func (c *ContentTypeBinder) MediaTypes() []string {
+	return append([]string(nil), c.mediaTypes...)
+}
+
+// Binder returns the binder of the Content-Type header value.
+func (c *ContentTypeBinder) Binder(contentType string) (Binding, error) {
+	if contentType == "" {
+		contentType = c.defaultMediaType
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, c.unsupported(contentType)
+	}
+	if b, ok := c.binders[mediaType]; ok {
+		return b, nil
+	}
+	if i := strings.LastIndexByte(mediaType, '+'); i != -1 {
+		if b, ok := c.binders["application/"+mediaType[i+1:]]; ok {
+			return b, nil
+		}
+	}
+	return nil, c.unsupported(contentType)
+}
+
+func (c *ContentTypeBinder) unsupported(contentType string) error {
+	return &UnsupportedMediaTypeError{ContentType: contentType, Supported: c.MediaTypes()}
+}
+
+// Bind the request body to an object with the binder of its Content-Type, if the object implements Validate
+// the valid method will be called.
+func (c *ContentTypeBinder) FromReq(req *http.Request, obj interface{}) error {
+	if req == nil || req.Body == nil {
+		return errors.New(errInvalidRequest)
+	}
+	b, err := c.Binder(req.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+	return b.FromReq(req, obj)
+}
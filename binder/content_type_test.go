@@ -0,0 +1,113 @@
+package binder_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ifreddyrondon/bastion/binder"
+)
+
+func TestContentTypeFromReq(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"json", "application/json", `{"address": "la comarca", "lat": 123}`},
+		{"json with charset", "application/json; charset=UTF-8", `{"address": "la comarca", "lat": 123}`},
+		{"json suffix", "application/vnd.api+json", `{"address": "la comarca", "lat": 123}`},
+		{"case insensitive", "Application/JSON", `{"address": "la comarca", "lat": 123}`},
+		{"xml", "application/xml", `<address><address>la comarca</address><lat>123</lat></address>`},
+		{"text xml", "text/xml; charset=utf-8", `<address><address>la comarca</address><lat>123</lat></address>`},
+		{"xml suffix", "application/atom+xml", `<address><address>la comarca</address><lat>123</lat></address>`},
+		{"yaml", "application/x-yaml", "address: la comarca\nlat: 123\n"},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			req, _ := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			var a address
+			err := binder.ContentType.FromReq(req, &a)
+			require.Nil(t, err)
+			assert.Equal(t, "la comarca", a.Address)
+			assert.Equal(t, 123.0, a.Lat)
+		})
+	}
+}
+
+func TestContentTypeUnsupported(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		contentType string
+	}{
+		{"missing", ""},
+		{"unregistered", "text/plain; charset=utf-8"},
+		{"unregistered suffix", "application/vnd.api+cbor"},
+		{"malformed", "application/json; charset"},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			req, _ := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{}`))
+			req.Header.Set("Content-Type", tc.contentType)
+			var a address
+			err := binder.ContentType.FromReq(req, &a)
+			unsupported, ok := err.(*binder.UnsupportedMediaTypeError)
+			require.True(t, ok)
+			assert.Equal(t, tc.contentType, unsupported.ContentType)
+			assert.Equal(t, []string{
+				"application/json", "application/xml", "text/xml", "application/yaml", "application/x-yaml", "text/yaml",
+			}, unsupported.Supported)
+		})
+	}
+}
+
+func TestContentTypeUnsupportedError(t *testing.T) {
+	t.Parallel()
+
+	err := &binder.UnsupportedMediaTypeError{ContentType: "text/plain", Supported: []string{"application/json", "application/xml"}}
+	assert.EqualError(t, err, `unsupported media type "text/plain", supported: application/json, application/xml`)
+}
+
+func TestContentTypeCustom(t *testing.T) {
+	t.Parallel()
+
+	c := binder.NewContentType(
+		binder.Register("application/json", binder.NewJSON(binder.JSONDecodingErrMsg("invalid json"))),
+		binder.DefaultMediaType("application/json"),
+	)
+	assert.Equal(t, []string{"application/json"}, c.MediaTypes())
+
+	req, _ := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"lat": -1}`))
+	var a address
+	assert.EqualError(t, c.FromReq(req, &a), "address lat can't be lower than 0")
+
+	req, _ = http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{`))
+	req.Header.Set("Content-Type", "application/problem+json")
+	assert.EqualError(t, c.FromReq(req, &a), "invalid json")
+
+	req, _ = http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`<address/>`))
+	req.Header.Set("Content-Type", "application/xml")
+	assert.EqualError(t, c.FromReq(req, &a), `unsupported media type "application/xml", supported: application/json`)
+}
+
+func TestContentTypeMissingBody(t *testing.T) {
+	t.Parallel()
+
+	req, _ := http.NewRequest(http.MethodPost, "/", nil)
+	var a address
+	assert.EqualError(t, binder.ContentType.FromReq(req, &a), "invalid request, body not present")
+}
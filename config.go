@@ -0,0 +1,478 @@
+package bastion
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const secretMask = "******"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ConfigEnvPrefix set the prefix of the env vars, ie. "APP" reads the read timeout from APP_READ_TIMEOUT.
+// Default no prefix.
+func ConfigEnvPrefix(prefix string) ConfigOpt {
+	return func(cfg *configLoader) {
+		if prefix != "" && !strings.HasSuffix(prefix, "_") {
+			prefix += "_"
+		}
+		cfg.envPrefix = prefix
+	}
+}
+
+// ConfigFiles adds JSON or YAML files, by its .json, .yaml or .yml extension, to read the configuration from.
+// The values of the later files override the earlier ones.
+func ConfigFiles(paths ...string) ConfigOpt {
+	return func(cfg *configLoader) {
+		cfg.files = append(cfg.files, paths...)
+	}
+}
+
+// ConfigDotEnv adds .env files with KEY=VALUE lines to read the env vars from. The env vars of the process
+// override the ones in the files and the values of the later files override the earlier ones.
+func ConfigDotEnv(paths ...string) ConfigOpt {
+	return func(cfg *configLoader) {
+		cfg.dotEnvFiles = append(cfg.dotEnvFiles, paths...)
+	}
+}
+
+// ConfigOpt helper type to create functional options for LoadConfig.
+type ConfigOpt func(*configLoader)
+
+type configLoader struct {
+	envPrefix   string
+	files       []string
+	dotEnvFiles []string
+	// dotEnv holds the vars of the .env files.
+	dotEnv map[string]string
+	// values holds the decoded JSON and YAML files in order.
+	values []map[string]interface{}
+}
+
+// ConfigFieldError is a value that couldn't be converted to the type of the field.
+type ConfigFieldError struct {
+	// Key of the field, the keys of the nested structs are joined by dots, ie. "openapi_info.title".
+	Key string
+	// Source of the value, ie. "env APP_READ_TIMEOUT" or "file config.yaml".
+	Source string
+	Err    error
+}
+
+func (e *ConfigFieldError) Error() string {
+	return fmt.Sprintf("%v from %v: %v", e.Key, e.Source, e.Err)
+}
+
+// ConfigError is returned by LoadConfig with every field that couldn't be loaded.
+type ConfigError struct {
+	Fields []*ConfigFieldError
+}
+
+func (e *ConfigError) Error() string {
+	lines := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		lines[i] = "  - " + f.Error()
+	}
+	return "bastion invalid config:\n" + strings.Join(lines, "\n")
+}
+
+// configField is a configurable field of a struct.
+type configField struct {
+	key    []string
+	value  reflect.Value
+	secret bool
+}
+
+// LoadConfig populates cfg, a pointer to Options or to an app-defined struct embedding Options, from
+// JSON and YAML files, .env files and env vars. From lower to higher precedence: the values already set
+// in cfg, the files, the .env files and the env vars. The result is applied to the app with the Config option.
+//
+// The key of a field is the snake case of its name or the name in the `config` tag, ie. `config:"db_url"`,
+// a "-" skips it. The env var is the upper case key with the prefix, the keys of nested structs are joined
+// with "_" in the env vars and are nested objects in the files. A `config:",secret"` tag masks the value
+// in the configuration dump. The conversion errors are returned per field in a *ConfigError.
+func LoadConfig(cfg interface{}, opts ...ConfigOpt) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.Errorf("bastion config must be a pointer to a struct, got %T", cfg)
+	}
+	loader := &configLoader{dotEnv: make(map[string]string)}
+	for _, opt := range opts {
+		opt(loader)
+	}
+	if err := loader.read(); err != nil {
+		return err
+	}
+
+	cerr := &ConfigError{}
+	for _, f := range configFields(v.Elem(), nil, false) {
+		raw, source, ok := loader.lookup(f.key)
+		if !ok {
+			continue
+		}
+		if err := setConfigValue(f.value, raw); err != nil {
+			cerr.Fields = append(cerr.Fields, &ConfigFieldError{Key: strings.Join(f.key, "."), Source: source, Err: err})
+		}
+	}
+	if len(cerr.Fields) > 0 {
+		return cerr
+	}
+	return nil
+}
+
+func (l *configLoader) read() error {
+	for _, path := range l.files {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "reading config file")
+		}
+		var values map[string]interface{}
+		switch ext := strings.ToLower(filepath.Ext(path)); ext {
+		case ".json":
+			d := json.NewDecoder(bytes.NewReader(b))
+			d.UseNumber()
+			err = d.Decode(&values)
+		case ".yaml", ".yml":
+			var raw map[interface{}]interface{}
+			err = yaml.Unmarshal(b, &raw)
+			values = yamlMap(raw)
+		default:
+			return errors.Errorf("bastion config file %v with unknown extension %q", path, ext)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "decoding config file %v", path)
+		}
+		l.values = append(l.values, values)
+	}
+
+	for _, path := range l.dotEnvFiles {
+		if err := l.readDotEnv(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDotEnv parses the KEY=VALUE lines of the file, the empty lines and the ones starting with # are
+// ignored, the "export " prefix is allowed and the values can be quoted.
+func (l *configLoader) readDotEnv(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "reading .env file")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		i := strings.Index(line, "=")
+		if i == -1 {
+			return errors.Errorf("bastion .env file %v line %v: expected KEY=VALUE", path, n)
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			if value[0] == '"' {
+				if unquoted, err := strconv.Unquote(value); err == nil {
+					value = unquoted
+				}
+			} else {
+				value = value[1 : len(value)-1]
+			}
+		}
+		l.dotEnv[key] = value
+	}
+	return errors.Wrap(scanner.Err(), "reading .env file")
+}
+
+// lookup returns the value of the key from the source with the highest precedence.
+func (l *configLoader) lookup(key []string) (interface{}, string, bool) {
+	env := l.envPrefix + strings.ToUpper(strings.Join(key, "_"))
+	if v, ok := os.LookupEnv(env); ok {
+		return v, "env " + env, true
+	}
+	if v, ok := l.dotEnv[env]; ok {
+		return v, ".env " + env, true
+	}
+	for i := len(l.values) - 1; i >= 0; i-- {
+		if v, ok := lookupPath(l.values[i], key); ok {
+			return v, "file " + l.files[i], true
+		}
+	}
+	return nil, "", false
+}
+
+func lookupPath(values map[string]interface{}, key []string) (interface{}, bool) {
+	var current interface{} = values
+	for _, k := range key {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = lookupKey(m, k)
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, current != nil
+}
+
+func lookupKey(m map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := m[key]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(strings.Replace(k, "-", "_", -1), key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// configFields returns the configurable fields of the struct, the embedded structs are flattened.
+func configFields(v reflect.Value, prefix []string, secret bool) []configField {
+	var fields []configField
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			// unexported
+			continue
+		}
+		name, opts := parseConfigTag(f.Tag.Get("config"))
+		if name == "-" {
+			continue
+		}
+		fieldSecret := secret || strings.Contains(opts, "secret")
+		fv := v.Field(i)
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, configFields(fv, prefix, fieldSecret)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = snakeCase(f.Name)
+		}
+		key := append(append([]string{}, prefix...), name)
+		if f.Type.Kind() == reflect.Struct {
+			fields = append(fields, configFields(fv, key, fieldSecret)...)
+			continue
+		}
+		if !configurable(f.Type) {
+			continue
+		}
+		fields = append(fields, configField{key: key, value: fv, secret: fieldSecret})
+	}
+	return fields
+}
+
+func parseConfigTag(tag string) (string, string) {
+	if i := strings.Index(tag, ","); i != -1 {
+		return tag[:i], tag[i+1:]
+	}
+	return tag, ""
+}
+
+// configurable reports whether the values of the type can be converted from the config sources.
+func configurable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Slice && configurable(t.Elem())
+	}
+	return false
+}
+
+// setConfigValue converts the raw value, a string from the env vars or a decoded value from the files,
+// to the type of the field.
+func setConfigValue(v reflect.Value, raw interface{}) error {
+	if v.Kind() == reflect.Slice {
+		var items []interface{}
+		switch r := raw.(type) {
+		case []interface{}:
+			items = r
+		case string:
+			for _, item := range strings.Split(r, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		default:
+			items = []interface{}{r}
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setConfigValue(slice.Index(i), item); err != nil {
+				return errors.Wrapf(err, "item %v", i)
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+
+	s := fmt.Sprint(raw)
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return errors.Errorf("invalid %v %q", v.Type(), s)
+		}
+		v.SetInt(n)
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return errors.Errorf("invalid %v %q", v.Type(), s)
+		}
+		v.SetUint(n)
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return errors.Errorf("invalid %v %q", v.Type(), s)
+		}
+		v.SetFloat(n)
+	}
+	return nil
+}
+
+// snakeCase converts a Go field name into snake case, ie. ReadHeaderTimeout into read_header_timeout
+// and TLSClientCAFile into tls_client_ca_file.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+func yamlMap(m map[interface{}]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[fmt.Sprint(k)] = yamlValue(v)
+	}
+	return out
+}
+
+func yamlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		return yamlMap(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = yamlValue(item)
+		}
+		return out
+	}
+	return v
+}
+
+// Config applies the configuration loaded with LoadConfig, cfg is a *Options or a pointer to a struct
+// embedding Options. The Opt functions take precedence over it, the configuration only sets the options
+// left unset by them. In debug mode the effective configuration is logged with the secrets masked.
+func Config(cfg interface{}) Opt {
+	return func(app *Bastion) {
+		app.config = cfg
+	}
+}
+
+// configOptions returns the Options of the configuration.
+func configOptions(cfg interface{}) (*Options, error) {
+	if opts, ok := cfg.(*Options); ok {
+		return opts, nil
+	}
+	v := reflect.ValueOf(cfg)
+	if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
+		if f := v.Elem().FieldByName("Options"); f.IsValid() && f.Type() == reflect.TypeOf(Options{}) {
+			return f.Addr().Interface().(*Options), nil
+		}
+	}
+	return nil, errors.Errorf("bastion config must be a *Options or a pointer to a struct embedding Options, got %T", cfg)
+}
+
+// applyConfig sets the options of the configuration that aren't set yet.
+func (app *Bastion) applyConfig() error {
+	cfg, err := configOptions(app.config)
+	if err != nil {
+		return err
+	}
+	dst, src := reflect.ValueOf(&app.Options).Elem(), reflect.ValueOf(cfg).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		if dst.Type().Field(i).PkgPath != "" {
+			continue
+		}
+		if isZero(dst.Field(i)) && !isZero(src.Field(i)) {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+	return nil
+}
+
+// isZero reports whether v is the zero value of its type, like reflect.Value.IsZero of Go 1.13.
+func isZero(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// configDump returns the effective configuration, the loaded configuration with the resolved options,
+// keyed by the config keys and with the secrets masked.
+func (app *Bastion) configDump() map[string]interface{} {
+	v := reflect.New(reflect.TypeOf(app.config).Elem()).Elem()
+	v.Set(reflect.ValueOf(app.config).Elem())
+	if opts, err := configOptions(v.Addr().Interface()); err == nil {
+		*opts = app.Options
+	}
+
+	dump := make(map[string]interface{})
+	for _, f := range configFields(v, nil, false) {
+		var value interface{} = f.value.Interface()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		if f.secret && !isZero(f.value) {
+			value = secretMask
+		}
+		dump[strings.Join(f.key, ".")] = value
+	}
+	return dump
+}
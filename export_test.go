@@ -0,0 +1,4 @@
+package bastion
+
+// UnregisterMode removes a mode registered by a test.
+var UnregisterMode = unregisterMode
@@ -0,0 +1,209 @@
+package bastion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gavv/httpexpect.v1"
+)
+
+const (
+	updateGoldenEnv   = "BASTION_UPDATE_GOLDEN"
+	defaultGoldenDir  = "testdata"
+	goldenMaskedValue = "<masked>"
+)
+
+var (
+	defaultGoldenHeaders = []string{"Content-Type"}
+	defaultGoldenMask    = []string{"request_id", "req_id", "requestId", "trace_id", "span_id"}
+	unsafeFileChars      = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+)
+
+// GoldenDir set the directory of the golden files. Default "testdata".
+func GoldenDir(dir string) GoldenOpt {
+	return func(cfg *goldenCfg) {
+		cfg.dir = dir
+	}
+}
+
+// GoldenHeaders set the response headers recorded in the golden files. Default Content-Type.
+func GoldenHeaders(headers ...string) GoldenOpt {
+	return func(cfg *goldenCfg) {
+		cfg.headers = headers
+	}
+}
+
+// GoldenMask adds JSON fields, at any depth, whose values are masked because they change between runs.
+// By default the request ids, the trace ids and the RFC 3339 timestamps are masked.
+func GoldenMask(fields ...string) GoldenOpt {
+	return func(cfg *goldenCfg) {
+		for _, f := range fields {
+			cfg.mask[f] = true
+		}
+	}
+}
+
+// GoldenUpdate rewrites the golden files with the responses instead of comparing them, ie. with the value of a
+// test flag. Default the BASTION_UPDATE_GOLDEN env var value, false when it's not set.
+func GoldenUpdate(update bool) GoldenOpt {
+	return func(cfg *goldenCfg) {
+		cfg.update = update
+	}
+}
+
+// GoldenOpt helper type to create functional options for GoldenTester.
+type GoldenOpt func(*goldenCfg)
+
+type goldenCfg struct {
+	dir     string
+	headers []string
+	mask    map[string]bool
+	update  bool
+}
+
+// GoldenTester is like Tester but it also records every response (status, selected headers and normalized
+// body) into a golden file under testdata/<test name>/ and compares it with the recorded one on later runs.
+// The golden files are rewritten with the GoldenUpdate option or the BASTION_UPDATE_GOLDEN env var, ie.
+// BASTION_UPDATE_GOLDEN=true go test ./...
+func GoldenTester(t *testing.T, bastion *Bastion, opts ...GoldenOpt) *httpexpect.Expect {
+	update, _ := strconv.ParseBool(os.Getenv(updateGoldenEnv))
+	cfg := &goldenCfg{dir: defaultGoldenDir, headers: defaultGoldenHeaders, mask: make(map[string]bool), update: update}
+	for _, f := range defaultGoldenMask {
+		cfg.mask[f] = true
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	tcfg := &testerCfg{
+		reporter: httpexpect.NewAssertReporter(t),
+		printers: []httpexpect.Printer{httpexpect.NewDebugPrinter(t, true)},
+	}
+	recorder := &goldenRecorder{t: t, cfg: cfg, next: httpexpect.NewBinder(bastion.r)}
+	return newExpect(tcfg, "", &http.Client{Transport: recorder})
+}
+
+// goldenRecorder is a http.RoundTripper that compares the responses with their golden files.
+type goldenRecorder struct {
+	t    *testing.T
+	cfg  *goldenCfg
+	next http.RoundTripper
+
+	mu sync.Mutex
+	n  int
+}
+
+func (g *goldenRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := g.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	g.mu.Lock()
+	g.n++
+	n := g.n
+	g.mu.Unlock()
+	g.check(g.path(n, req), g.snapshot(req, res, body))
+	return res, nil
+}
+
+func (g *goldenRecorder) path(n int, req *http.Request) string {
+	target := strings.Trim(unsafeFileChars.ReplaceAllString(req.URL.RequestURI(), "_"), "_")
+	if target == "" {
+		target = "root"
+	}
+	name := fmt.Sprintf("%02d_%s_%s.golden", n, req.Method, target)
+	return filepath.Join(g.cfg.dir, unsafeFileChars.ReplaceAllString(g.t.Name(), "_"), name)
+}
+
+func (g *goldenRecorder) snapshot(req *http.Request, res *http.Response, body []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", req.Method, req.URL.RequestURI())
+	fmt.Fprintf(&b, "%d %s\n", res.StatusCode, http.StatusText(res.StatusCode))
+	headers := append([]string(nil), g.cfg.headers...)
+	sort.Strings(headers)
+	for _, h := range headers {
+		if v, ok := res.Header[http.CanonicalHeaderKey(h)]; ok {
+			fmt.Fprintf(&b, "%s: %s\n", http.CanonicalHeaderKey(h), strings.Join(v, ", "))
+		}
+	}
+	b.WriteString("\n")
+	b.Write(g.normalize(body))
+	return b.String()
+}
+
+// normalize indents the JSON bodies with sorted keys and masked volatile values, other bodies are kept.
+func (g *goldenRecorder) normalize(body []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	out := &bytes.Buffer{}
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(g.mask(v)); err != nil {
+		return body
+	}
+	return out.Bytes()
+}
+
+func (g *goldenRecorder) mask(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, field := range val {
+			if g.cfg.mask[k] {
+				val[k] = goldenMaskedValue
+				continue
+			}
+			val[k] = g.mask(field)
+		}
+	case []interface{}:
+		for i := range val {
+			val[i] = g.mask(val[i])
+		}
+	case string:
+		if _, err := time.Parse(time.RFC3339Nano, val); err == nil {
+			return goldenMaskedValue
+		}
+	}
+	return v
+}
+
+func (g *goldenRecorder) check(path, actual string) {
+	if g.cfg.update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			g.t.Errorf("creating golden dir: %v", err)
+			return
+		}
+		if err := ioutil.WriteFile(path, []byte(actual), 0644); err != nil {
+			g.t.Errorf("writing golden file: %v", err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		g.t.Errorf("golden file %v not found, run the tests with %v=true to create it", path, updateGoldenEnv)
+		return
+	}
+	assert.Equal(g.t, string(expected), actual, "response doesn't match the golden file %v", path)
+}
@@ -0,0 +1,73 @@
+package bastion
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+func goldenApp() *Bastion {
+	app := New(LoggerOutput(ioutil.Discard))
+	app.Get("/todos/{id}", func(w http.ResponseWriter, r *http.Request) {
+		render.JSON.Send(w, map[string]interface{}{
+			"id":          1,
+			"description": "buy milk",
+			"created_at":  time.Now(),
+			"request_id":  r.Header.Get("Request-Id"),
+			"tags":        []interface{}{"home", map[string]interface{}{"updated": time.Now().Format(time.RFC3339)}},
+		})
+	})
+	app.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Version", "1")
+		w.Write([]byte("plain text"))
+	})
+	return app
+}
+
+func TestGoldenTester(t *testing.T) {
+	e := GoldenTester(t, goldenApp(), GoldenHeaders("Content-Type", "X-Version"))
+	e.GET("/todos/1").WithHeader("Request-Id", "abc").Expect().Status(http.StatusOK)
+	e.GET("/").Expect().Status(http.StatusOK)
+}
+
+func TestGoldenTesterUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bastion-golden")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	e := GoldenTester(t, goldenApp(), GoldenDir(dir), GoldenMask("description"), GoldenUpdate(true))
+	e.GET("/todos/1").WithQuery("expand", "tags").Expect().Status(http.StatusOK)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "TestGoldenTesterUpdate", "01_GET_todos_1_expand_tags.golden"))
+	require.Nil(t, err)
+	expected := `GET /todos/1?expand=tags
+200 OK
+Content-Type: application/json; charset=utf-8
+
+{
+  "created_at": "<masked>",
+  "description": "<masked>",
+  "id": 1,
+  "request_id": "<masked>",
+  "tags": [
+    "home",
+    {
+      "updated": "<masked>"
+    }
+  ]
+}
+`
+	assert.Equal(t, expected, string(b))
+
+	// later runs compare with the recorded file
+	e = GoldenTester(t, goldenApp(), GoldenDir(dir), GoldenMask("description"), GoldenUpdate(false))
+	e.GET("/todos/1").WithQuery("expand", "tags").Expect().Status(http.StatusOK)
+}
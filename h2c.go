@@ -0,0 +1,20 @@
+package bastion
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// h2cHandler returns the handler that serves HTTP/2 over cleartext, with prior knowledge and with the
+// "Upgrade: h2c" header, along with HTTP/1.1. The server is configured to send a GOAWAY to the HTTP/2
+// connections on shutdown.
+func h2cHandler(server *http.Server, h http.Handler) (http.Handler, error) {
+	h2s := &http2.Server{}
+	if err := http2.ConfigureServer(server, h2s); err != nil {
+		return nil, errors.Wrap(err, "configuring h2c")
+	}
+	return h2c.NewHandler(h, h2s), nil
+}
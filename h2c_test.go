@@ -0,0 +1,148 @@
+package bastion
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// readHTTP2Response reads frames until the end of the stream and returns the status and the body.
+func readHTTP2Response(t *testing.T, fr *http2.Framer, streamID uint32) (string, string) {
+	var status string
+	body := &bytes.Buffer{}
+	for {
+		f, err := fr.ReadFrame()
+		require.Nil(t, err)
+		if f.Header().StreamID != streamID {
+			continue
+		}
+		switch f := f.(type) {
+		case *http2.MetaHeadersFrame:
+			status = f.PseudoValue("status")
+		case *http2.DataFrame:
+			body.Write(f.Data())
+		}
+		if f.Header().Flags.Has(http2.FlagHeadersEndStream) {
+			return status, body.String()
+		}
+	}
+}
+
+func serveH2C(t *testing.T) (*Bastion, string, chan error) {
+	out := &syncWriter{w: &bytes.Buffer{}}
+	app := New(DisablePrettyLogging(), LoggerOutput(out), H2C())
+	app.Get("/proto", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto + " " + r.Header.Get("X-Name")))
+	})
+	app.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	ln, err := listen("127.0.0.1:0")
+	require.Nil(t, err)
+	done := make(chan error, 1)
+	go func() { done <- app.ServeListener(ln) }()
+	return app, ln.Addr().String(), done
+}
+
+func TestH2CPriorKnowledge(t *testing.T) {
+	t.Parallel()
+
+	app, addr, done := serveH2C(t)
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+
+	res, err := client.Get("http://" + addr + "/proto")
+	require.Nil(t, err)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, "HTTP/2.0", res.Proto)
+	assert.Equal(t, "HTTP/2.0 ", string(body))
+
+	// the recovery and internal error middleware work unchanged
+	res, err = client.Get("http://" + addr + "/panic")
+	require.Nil(t, err)
+	body, _ = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	assert.JSONEq(t, `{"status":500,"error":"Internal Server Error","message":"looks like something went wrong"}`, string(body))
+
+	// HTTP/1.1 keeps working on the same listener
+	res, err = http.Get("http://" + addr + "/proto")
+	require.Nil(t, err)
+	body, _ = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, "HTTP/1.1 ", string(body))
+
+	app.Shutdown()
+	assert.Equal(t, http.ErrServerClosed, <-done)
+}
+
+func TestH2CUpgrade(t *testing.T) {
+	t.Parallel()
+
+	app, addr, done := serveH2C(t)
+	conn, err := net.Dial("tcp", addr)
+	require.Nil(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	conn.Write([]byte("GET /proto HTTP/1.1\r\nHost: " + addr + "\r\nX-Name: upgrade\r\n" +
+		"Connection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: \r\n\r\n"))
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+	assert.Equal(t, "h2c", res.Header.Get("Upgrade"))
+
+	conn.Write([]byte(http2.ClientPreface))
+	fr := http2.NewFramer(conn, br)
+	fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	require.Nil(t, fr.WriteSettings())
+
+	// the upgrade request is answered as the stream 1
+	status, body := readHTTP2Response(t, fr, 1)
+	assert.Equal(t, "200", status)
+	assert.Equal(t, "HTTP/2.0 upgrade", body)
+
+	// next requests use the upgraded connection
+	block := &bytes.Buffer{}
+	enc := hpack.NewEncoder(block)
+	enc.WriteField(hpack.HeaderField{Name: ":method", Value: "GET"})
+	enc.WriteField(hpack.HeaderField{Name: ":scheme", Value: "http"})
+	enc.WriteField(hpack.HeaderField{Name: ":authority", Value: addr})
+	enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/proto"})
+	enc.WriteField(hpack.HeaderField{Name: "x-name", Value: "stream 3"})
+	require.Nil(t, fr.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      3,
+		BlockFragment: block.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+	}))
+	status, body = readHTTP2Response(t, fr, 3)
+	assert.Equal(t, "200", status)
+	assert.Equal(t, "HTTP/2.0 stream 3", body)
+
+	conn.Close()
+	app.Shutdown()
+	assert.Equal(t, http.ErrServerClosed, <-done)
+}
+
+func TestH2CWithTLSPanics(t *testing.T) {
+	assert.PanicsWithValue(t, "bastion h2c can't be used with tls", func() {
+		New(H2C(), TLS("cert.pem", "key.pem"))
+	})
+}
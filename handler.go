@@ -0,0 +1,203 @@
+package bastion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/ifreddyrondon/bastion/binder"
+	"github.com/ifreddyrondon/bastion/middleware"
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+// Error is an error with the HTTP status, the public message, an optional machine readable code and
+// details to render in the response. The cause isn't rendered, only logged for the 5xx status codes.
+type Error struct {
+	// Status is the HTTP status code of the response.
+	Status int
+	// Message is the public message of the error.
+	Message string
+	// Code is an optional machine readable identifier of the error, ie. "todo_not_found".
+	Code string
+	// Details are optional data about the error, ie. the invalid fields.
+	Details interface{}
+	// Err is the optional cause of the error.
+	Err error
+}
+
+// NewError returns an *Error with the status and public message.
+func NewError(status int, message string) *Error {
+	return &Error{Status: status, Message: message}
+}
+
+// BadRequest returns a 400 *Error with the public message.
+func BadRequest(message string) *Error { return NewError(http.StatusBadRequest, message) }
+
+// Unauthorized returns a 401 *Error with the public message.
+func Unauthorized(message string) *Error { return NewError(http.StatusUnauthorized, message) }
+
+// Forbidden returns a 403 *Error with the public message.
+func Forbidden(message string) *Error { return NewError(http.StatusForbidden, message) }
+
+// NotFound returns a 404 *Error with the public message.
+func NotFound(message string) *Error { return NewError(http.StatusNotFound, message) }
+
+// Conflict returns a 409 *Error with the public message.
+func Conflict(message string) *Error { return NewError(http.StatusConflict, message) }
+
+// UnprocessableEntity returns a 422 *Error with the public message.
+func UnprocessableEntity(message string) *Error {
+	return NewError(http.StatusUnprocessableEntity, message)
+}
+
+// WithCode set the machine readable code of the error.
+func (e *Error) WithCode(code string) *Error {
+	e.Code = code
+	return e
+}
+
+// WithDetails set the details of the error.
+func (e *Error) WithDetails(details interface{}) *Error {
+	e.Details = details
+	return e
+}
+
+// Wrap set the cause of the error.
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+// Cause returns the cause of the error, it's walked by errors.Cause of github.com/pkg/errors.
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the cause of the error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// causeOf returns the cause of err set by the github.com/pkg/errors wrappers, the *Error or the
+// fmt.Errorf %w verb, nil without cause.
+func causeOf(err error) error {
+	switch e := err.(type) {
+	case interface{ Cause() error }:
+		return e.Cause()
+	case interface{ Unwrap() error }:
+		return e.Unwrap()
+	}
+	return nil
+}
+
+// ErrorMapper renders the errors returned by the HandlerFunc handlers.
+type ErrorMapper func(w http.ResponseWriter, r *http.Request, err error)
+
+// DefaultErrorMapper returns an ErrorMapper that renders with the renderer the *Error, found in the
+// chain of causes of the error, with its status, message, code and details. The *binder.UnsupportedMediaTypeError
+// is rendered as a 415 with the supported media types as details. Any other error is rendered as a
+// 500 with msg. The unexpected errors, and the 5xx *Error with their cause, are logged with the request
+// logger. A *render.Negotiator renderer is negotiated per request with render.ForRequest.
+func DefaultErrorMapper(renderer render.APIRenderer, msg string) ErrorMapper {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		renderer := render.ForRequest(renderer, r)
+		var unsupported *binder.UnsupportedMediaTypeError
+		var httpErr *Error
+		for e := err; e != nil; e = causeOf(e) {
+			switch e := e.(type) {
+			case *binder.UnsupportedMediaTypeError:
+				if unsupported == nil {
+					unsupported = e
+				}
+			case *Error:
+				if httpErr == nil {
+					httpErr = e
+				}
+			}
+		}
+		if unsupported != nil {
+			render.UnsupportedMediaType(renderer, w, unsupported, unsupported.Supported)
+			return
+		}
+		if httpErr == nil {
+			logUnexpected(r, err, http.StatusInternalServerError)
+			renderer.InternalServerError(w, errors.New(msg))
+			return
+		}
+		if httpErr.Status >= http.StatusInternalServerError {
+			logUnexpected(r, err, httpErr.Status)
+		}
+		s := httpErr.Status
+		res := render.NewHTTPError(httpErr.Message, http.StatusText(s), s)
+		res.Code = httpErr.Code
+		res.Details = httpErr.Details
+		renderer.Response(w, s, res)
+	}
+}
+
+func logUnexpected(r *http.Request, err error, status int) {
+	zerolog.Ctx(r.Context()).Error().
+		Str("component", "error mapper").
+		Int("status", status).
+		Err(err).
+		Msg("handler failed")
+}
+
+type errorMapperCtxKey struct{}
+
+// UseErrorMapper is a middleware that set the ErrorMapper of the HandlerFunc handlers of a router,
+// ie. to render the errors of a sub router in XML.
+func UseErrorMapper(mapper ErrorMapper) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), errorMapperCtxKey{}, mapper)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+var defaultErrorMapper = DefaultErrorMapper(render.JSON, defaultInternalErrMsg)
+
+// HandlerFunc is a handler that returns an error, it's rendered by the ErrorMapper of the router or the
+// app ErrorMapper option. Nothing is rendered when the error is nil, and when the handler already wrote
+// the response the error is only logged. The response of the mapper is sent
+// as is by the internal error middleware, even the 5xx ones, since the mapper renders and logs the error.
+//
+//	app.Method(http.MethodGet, "/todos/{id}", bastion.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+//		return bastion.NotFound("todo not found").WithCode("todo_not_found")
+//	}))
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// ServeHTTP implements http.Handler.
+func (h HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	collector, ww := middleware.WrapResponseWriter(w)
+	err := h(ww, r)
+	if err == nil {
+		return
+	}
+	if collector.WroteHeader() {
+		zerolog.Ctx(r.Context()).Error().
+			Str("component", "error mapper").
+			Int("status", collector.Code).
+			Err(err).
+			Msg("handler failed after writing the response")
+		return
+	}
+	mapper, ok := r.Context().Value(errorMapperCtxKey{}).(ErrorMapper)
+	if !ok {
+		mapper = defaultErrorMapper
+	}
+	middleware.SkipInternalError(r)
+	mapper(w, r, err)
+}
@@ -0,0 +1,225 @@
+package bastion_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ifreddyrondon/bastion"
+	"github.com/ifreddyrondon/bastion/binder"
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+func TestHandlerFuncTypedErrors(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name     string
+		err      error
+		status   int
+		expected map[string]interface{}
+	}{
+		{
+			"bad request",
+			bastion.BadRequest("invalid todo").WithCode("invalid_todo").
+				WithDetails(map[string]string{"description": "required"}),
+			http.StatusBadRequest,
+			map[string]interface{}{
+				"message": "invalid todo",
+				"error":   "Bad Request",
+				"status":  400,
+				"code":    "invalid_todo",
+				"details": map[string]interface{}{"description": "required"},
+			},
+		},
+		{
+			"unauthorized",
+			bastion.Unauthorized("missing token"),
+			http.StatusUnauthorized,
+			map[string]interface{}{"message": "missing token", "error": "Unauthorized", "status": 401},
+		},
+		{
+			"forbidden",
+			bastion.Forbidden("not the owner"),
+			http.StatusForbidden,
+			map[string]interface{}{"message": "not the owner", "error": "Forbidden", "status": 403},
+		},
+		{
+			"not found wrapped",
+			errors.Wrap(bastion.NotFound("todo not found").WithCode("todo_not_found"), "getting todo"),
+			http.StatusNotFound,
+			map[string]interface{}{"message": "todo not found", "error": "Not Found", "status": 404, "code": "todo_not_found"},
+		},
+		{
+			"conflict",
+			bastion.Conflict("todo already exists"),
+			http.StatusConflict,
+			map[string]interface{}{"message": "todo already exists", "error": "Conflict", "status": 409},
+		},
+		{
+			"unprocessable entity",
+			bastion.UnprocessableEntity("cannot decode todo").Wrap(errors.New("EOF")),
+			http.StatusUnprocessableEntity,
+			map[string]interface{}{"message": "cannot decode todo", "error": "Unprocessable Entity", "status": 422},
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			app := bastion.New()
+			app.Method(http.MethodGet, "/", bastion.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				return tc.err
+			}))
+			e := bastion.Tester(t, app)
+			e.GET("/").Expect().Status(tc.status).JSON().Object().Equal(tc.expected)
+		})
+	}
+}
+
+func TestHandlerFuncNoError(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New()
+	app.Method(http.MethodGet, "/", bastion.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		render.JSON.Send(w, map[string]string{"message": "hello"})
+		return nil
+	}))
+	e := bastion.Tester(t, app)
+	e.GET("/").Expect().Status(http.StatusOK).JSON().Object().Equal(map[string]interface{}{"message": "hello"})
+}
+
+func TestHandlerFuncUnexpectedError(t *testing.T) {
+	t.Parallel()
+
+	out := &bytes.Buffer{}
+	app := bastion.New(bastion.DisablePrettyLogging(), bastion.LoggerOutput(out))
+	app.Method(http.MethodGet, "/", bastion.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("connection refused")
+	}))
+	app.Method(http.MethodGet, "/unavailable", bastion.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return bastion.NewError(http.StatusServiceUnavailable, "try again later").
+			WithCode("db_down").Wrap(errors.New("db down"))
+	}))
+	e := bastion.Tester(t, app)
+
+	e.GET("/").Expect().Status(http.StatusInternalServerError).JSON().Object().Equal(map[string]interface{}{
+		"message": "looks like something went wrong",
+		"error":   "Internal Server Error",
+		"status":  500,
+	})
+	assert.Contains(t, out.String(), `"component":"error mapper"`)
+	assert.Contains(t, out.String(), `"error":"connection refused"`)
+
+	// the 5xx *Error reaches the client and it's logged once, by the mapper
+	e.GET("/unavailable").Expect().Status(http.StatusServiceUnavailable).JSON().Object().Equal(map[string]interface{}{
+		"message": "try again later",
+		"error":   "Service Unavailable",
+		"status":  503,
+		"code":    "db_down",
+	})
+	assert.Contains(t, out.String(), `"error":"try again later: db down"`)
+	assert.Equal(t, 2, strings.Count(out.String(), `"component":"error mapper"`))
+	assert.NotContains(t, out.String(), `"component":"internal error middleware"`)
+}
+
+func TestHandlerFuncErrorAfterWrite(t *testing.T) {
+	t.Parallel()
+
+	out := &bytes.Buffer{}
+	app := bastion.New(bastion.DisablePrettyLogging(), bastion.LoggerOutput(out))
+	app.Method(http.MethodGet, "/", bastion.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		render.JSON.Send(w, map[string]string{"message": "partial"})
+		return errors.New("flushing the stream")
+	}))
+	e := bastion.Tester(t, app)
+
+	e.GET("/").Expect().Status(http.StatusOK).JSON().Object().Equal(map[string]interface{}{"message": "partial"})
+	assert.Contains(t, out.String(), `"component":"error mapper"`)
+	assert.Contains(t, out.String(), `"error":"flushing the stream"`)
+	assert.Contains(t, out.String(), `"message":"handler failed after writing the response"`)
+}
+
+func TestUseErrorMapper(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New(bastion.MapErrors(func(w http.ResponseWriter, r *http.Request, err error) {
+		render.Text.Response(w, http.StatusTeapot, err.Error())
+	}))
+	failing := bastion.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return bastion.NotFound("todo not found")
+	})
+	app.Method(http.MethodGet, "/", failing)
+	app.Route("/xml", func(r chi.Router) {
+		r.Use(bastion.UseErrorMapper(bastion.DefaultErrorMapper(render.XML, "something went wrong")))
+		r.Method(http.MethodGet, "/", failing)
+	})
+	e := bastion.Tester(t, app)
+
+	e.GET("/").Expect().Status(http.StatusTeapot).Text().Equal("todo not found")
+	e.GET("/xml/").Expect().Status(http.StatusNotFound).ContentType("application/xml").
+		Body().Contains(`message="todo not found"`)
+}
+
+func TestHandlerFuncUnsupportedMediaType(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New()
+	create := bastion.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		var v map[string]interface{}
+		if err := binder.ContentType.FromReq(r, &v); err != nil {
+			return errors.Wrap(err, "binding todo")
+		}
+		render.JSON.Created(w, v)
+		return nil
+	})
+	app.Method(http.MethodPost, "/", create)
+	app.Route("/xml", func(r chi.Router) {
+		r.Use(bastion.UseErrorMapper(bastion.DefaultErrorMapper(render.XML, "something went wrong")))
+		r.Method(http.MethodPost, "/", create)
+	})
+	e := bastion.Tester(t, app)
+
+	e.POST("/").WithHeader("Content-Type", "application/merge-patch+json").WithBytes([]byte(`{"a":1}`)).
+		Expect().Status(http.StatusCreated).JSON().Object().Equal(map[string]interface{}{"a": 1})
+	e.POST("/").WithText("a=1").
+		Expect().Status(http.StatusUnsupportedMediaType).JSON().Object().Equal(map[string]interface{}{
+		"message": `unsupported media type "text/plain; charset=utf-8", supported: application/json, application/xml, text/xml, application/yaml, application/x-yaml, text/yaml`,
+		"error":   "Unsupported Media Type",
+		"status":  415,
+		"details": binder.ContentType.MediaTypes(),
+	})
+	e.POST("/xml/").WithText("a=1").
+		Expect().Status(http.StatusUnsupportedMediaType).ContentType("application/xml").
+		Body().Contains(`<details><i>application/json</i><i>application/xml</i><i>text/xml</i>` +
+		`<i>application/yaml</i><i>application/x-yaml</i><i>text/yaml</i></details>`)
+}
+
+func TestHandlerFuncWithoutApp(t *testing.T) {
+	t.Parallel()
+
+	h := bastion.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("boom")
+	})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"message":"looks like something went wrong","error":"Internal Server Error","status":500}`, w.Body.String())
+}
+
+func TestErrorChain(t *testing.T) {
+	t.Parallel()
+
+	cause := errors.New("EOF")
+	err := bastion.BadRequest("invalid todo").Wrap(cause)
+	assert.EqualError(t, err, "invalid todo: EOF")
+	assert.Equal(t, cause, errors.Cause(err))
+	assert.EqualError(t, bastion.NotFound("todo not found"), "todo not found")
+}
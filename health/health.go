@@ -0,0 +1,268 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"github.com/ifreddyrondon/bastion/middleware"
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+// DefaultTimeout defines the maximum time a check is allowed to run when no Timeout option is given.
+const DefaultTimeout = 5 * time.Second
+
+const (
+	// StatusUp is reported when the check, or all the critical checks, succeed.
+	StatusUp = "up"
+	// StatusDown is reported when the check, or any critical check, fails.
+	StatusDown = "down"
+)
+
+var errNotReady = errors.New("not ready")
+
+// Checker describes the interface which needs to be implemented to check if
+// a dependency (database, cache, downstream service) of the app works.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc is an adapter to allow the use of ordinary functions as Checker.
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Timeout set the maximum time the check is allowed to run. Default DefaultTimeout.
+func Timeout(d time.Duration) CheckOpt {
+	return func(c *check) {
+		c.timeout = d
+	}
+}
+
+// NonCritical marks the check as non critical, when it fails it's reported but
+// the app keeps being reported as up.
+func NonCritical() CheckOpt {
+	return func(c *check) {
+		c.critical = false
+	}
+}
+
+// CacheTTL set how long the result of the check is reused before checking again. Default 0, no cache.
+func CacheTTL(d time.Duration) CheckOpt {
+	return func(c *check) {
+		c.cacheTTL = d
+	}
+}
+
+// Liveness marks the check to be also run by the liveness probe. By default
+// checks are only run by the readiness probe.
+func Liveness() CheckOpt {
+	return func(c *check) {
+		c.liveness = true
+	}
+}
+
+// CheckOpt helper type to create functional options for a check.
+type CheckOpt func(*check)
+
+type check struct {
+	name     string
+	checker  Checker
+	timeout  time.Duration
+	critical bool
+	cacheTTL time.Duration
+	liveness bool
+
+	mu        sync.Mutex
+	last      CheckResult
+	checkedAt time.Time
+}
+
+// run returns the cached result or runs the checker. The lock only guards the cache, so a slow checker
+// doesn't block the concurrent probes beyond their own timeout.
+func (c *check) run(ctx context.Context) CheckResult {
+	if res, ok := c.cached(); ok {
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.checker.Check(ctx) }()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = errors.Wrap(ctx.Err(), "check timed out")
+	}
+
+	res := CheckResult{Status: StatusUp, Critical: c.critical, Duration: time.Since(start).String()}
+	if err != nil {
+		res.Status = StatusDown
+		res.Error = err.Error()
+	}
+	c.mu.Lock()
+	c.last = res
+	c.checkedAt = time.Now()
+	c.mu.Unlock()
+	return res
+}
+
+func (c *check) cached() (CheckResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cacheTTL <= 0 || c.checkedAt.IsZero() || time.Since(c.checkedAt) >= c.cacheTTL {
+		return CheckResult{}, false
+	}
+	res := c.last
+	res.Cached = true
+	return res, true
+}
+
+// CheckResult is the JSON report of a single check.
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Critical bool   `json:"critical"`
+	Duration string `json:"duration"`
+	Cached   bool   `json:"cached,omitempty"`
+}
+
+// Report is the JSON report of a probe.
+type Report struct {
+	Status string                 `json:"status"`
+	Error  string                 `json:"error,omitempty"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Health holds the registered checks and serves the liveness and readiness probes.
+type Health struct {
+	mu       sync.RWMutex
+	checks   []*check
+	notReady int32
+}
+
+// New returns a new Health instance without checks, it's ready by default.
+func New() *Health {
+	return &Health{}
+}
+
+// Register adds a named checker. Registering a name twice replaces the previous checker.
+func (h *Health) Register(name string, checker Checker, opts ...CheckOpt) {
+	c := &check{name: name, checker: checker, timeout: DefaultTimeout, critical: true}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := range h.checks {
+		if h.checks[i].name == name {
+			h.checks[i] = c
+			return
+		}
+	}
+	h.checks = append(h.checks, c)
+	sort.Slice(h.checks, func(i, j int) bool { return h.checks[i].name < h.checks[j].name })
+}
+
+// SetReady flips the readiness of the app. When it's not ready the readiness probe
+// reports down without running the checks, ie. during the graceful shutdown.
+func (h *Health) SetReady(ready bool) {
+	var v int32
+	if !ready {
+		v = 1
+	}
+	atomic.StoreInt32(&h.notReady, v)
+}
+
+// Ready reports if the app was not flipped to not ready.
+func (h *Health) Ready() bool {
+	return atomic.LoadInt32(&h.notReady) == 0
+}
+
+// Live runs the liveness checks and returns the report.
+func (h *Health) Live(ctx context.Context) Report {
+	return h.run(ctx, true)
+}
+
+// Readiness runs all the checks and returns the report.
+func (h *Health) Readiness(ctx context.Context) Report {
+	if !h.Ready() {
+		return Report{Status: StatusDown, Error: errNotReady.Error()}
+	}
+	return h.run(ctx, false)
+}
+
+func (h *Health) run(ctx context.Context, liveness bool) Report {
+	h.mu.RLock()
+	var checks []*check
+	for _, c := range h.checks {
+		if !liveness || c.liveness {
+			checks = append(checks, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp}
+	if len(checks) > 0 {
+		report.Checks = make(map[string]CheckResult, len(checks))
+	}
+	for i, c := range checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Critical && results[i].Status == StatusDown {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+// LiveHandler serves the liveness report with 200 status code when it's up or 503 when down.
+func (h *Health) LiveHandler(w http.ResponseWriter, r *http.Request) {
+	respond(w, r, h.Live(r.Context()))
+}
+
+// ReadyHandler serves the readiness report with 200 status code when it's up or 503 when down.
+func (h *Health) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	respond(w, r, h.Readiness(r.Context()))
+}
+
+func respond(w http.ResponseWriter, r *http.Request, report Report) {
+	status := http.StatusOK
+	if report.Status == StatusDown {
+		status = http.StatusServiceUnavailable
+		// the report is sent as is by the internal error middleware
+		middleware.SkipInternalError(r)
+	}
+	render.JSON.Response(w, status, report)
+}
+
+// Router returns a router with the liveness probe at /live and the readiness probe at /ready.
+func (h *Health) Router() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/live", h.LiveHandler)
+	r.Get("/ready", h.ReadyHandler)
+	return r
+}
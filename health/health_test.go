@@ -0,0 +1,181 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gavv/httpexpect.v1"
+
+	"github.com/ifreddyrondon/bastion/health"
+)
+
+func ok(context.Context) error { return nil }
+
+func fail(context.Context) error { return errors.New("connection refused") }
+
+func TestReadinessAllUp(t *testing.T) {
+	t.Parallel()
+
+	h := health.New()
+	h.Register("db", health.CheckerFunc(ok))
+	h.Register("cache", health.CheckerFunc(ok))
+
+	report := h.Readiness(context.Background())
+	assert.Equal(t, health.StatusUp, report.Status)
+	assert.Len(t, report.Checks, 2)
+	assert.Equal(t, health.StatusUp, report.Checks["db"].Status)
+	assert.True(t, report.Checks["db"].Critical)
+}
+
+func TestReadinessCriticalDown(t *testing.T) {
+	t.Parallel()
+
+	h := health.New()
+	h.Register("db", health.CheckerFunc(fail))
+	h.Register("cache", health.CheckerFunc(ok))
+
+	report := h.Readiness(context.Background())
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, health.StatusDown, report.Checks["db"].Status)
+	assert.Equal(t, "connection refused", report.Checks["db"].Error)
+	assert.Equal(t, health.StatusUp, report.Checks["cache"].Status)
+}
+
+func TestReadinessNonCriticalDown(t *testing.T) {
+	t.Parallel()
+
+	h := health.New()
+	h.Register("search", health.CheckerFunc(fail), health.NonCritical())
+
+	report := h.Readiness(context.Background())
+	assert.Equal(t, health.StatusUp, report.Status)
+	assert.Equal(t, health.StatusDown, report.Checks["search"].Status)
+	assert.False(t, report.Checks["search"].Critical)
+}
+
+func TestCheckTimeout(t *testing.T) {
+	t.Parallel()
+
+	h := health.New()
+	slow := func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}
+	h.Register("slow", health.CheckerFunc(slow), health.Timeout(10*time.Millisecond))
+
+	report := h.Readiness(context.Background())
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, "check timed out: context deadline exceeded", report.Checks["slow"].Error)
+}
+
+func TestCheckCacheTTL(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	counter := func(context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}
+	h := health.New()
+	h.Register("db", health.CheckerFunc(counter), health.CacheTTL(time.Minute))
+
+	first := h.Readiness(context.Background())
+	second := h.Readiness(context.Background())
+	assert.False(t, first.Checks["db"].Cached)
+	assert.True(t, second.Checks["db"].Cached)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestConcurrentProbesDontWaitForSlowCheck(t *testing.T) {
+	t.Parallel()
+
+	blocking := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	h := health.New()
+	h.Register("db", health.CheckerFunc(blocking), health.Timeout(200*time.Millisecond))
+
+	start := time.Now()
+	reports := make(chan health.Report, 3)
+	for i := 0; i < 3; i++ {
+		go func() { reports <- h.Readiness(context.Background()) }()
+	}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, health.StatusDown, (<-reports).Status)
+	}
+	// the probes run the check concurrently instead of one after another
+	assert.True(t, time.Since(start) < 500*time.Millisecond, "probes took %v", time.Since(start))
+}
+
+func TestRegisterReplaceByName(t *testing.T) {
+	t.Parallel()
+
+	h := health.New()
+	h.Register("db", health.CheckerFunc(fail))
+	h.Register("db", health.CheckerFunc(ok))
+
+	report := h.Readiness(context.Background())
+	assert.Equal(t, health.StatusUp, report.Status)
+	assert.Len(t, report.Checks, 1)
+}
+
+func TestLiveOnlyRunsLivenessChecks(t *testing.T) {
+	t.Parallel()
+
+	h := health.New()
+	h.Register("db", health.CheckerFunc(fail))
+	h.Register("deadlock", health.CheckerFunc(ok), health.Liveness())
+
+	report := h.Live(context.Background())
+	assert.Equal(t, health.StatusUp, report.Status)
+	assert.Len(t, report.Checks, 1)
+	assert.Contains(t, report.Checks, "deadlock")
+}
+
+func TestSetReady(t *testing.T) {
+	t.Parallel()
+
+	h := health.New()
+	h.Register("db", health.CheckerFunc(ok))
+	assert.True(t, h.Ready())
+
+	h.SetReady(false)
+	report := h.Readiness(context.Background())
+	assert.False(t, h.Ready())
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, "not ready", report.Error)
+	assert.Equal(t, health.StatusUp, h.Live(context.Background()).Status)
+
+	h.SetReady(true)
+	assert.Equal(t, health.StatusUp, h.Readiness(context.Background()).Status)
+}
+
+func TestRouter(t *testing.T) {
+	t.Parallel()
+
+	h := health.New()
+	h.Register("db", health.CheckerFunc(fail))
+	server := httptest.NewServer(h.Router())
+	defer server.Close()
+
+	e := httpexpect.New(t, server.URL)
+	e.GET("/live").Expect().
+		Status(http.StatusOK).
+		JSON().Object().Equal(map[string]interface{}{"status": "up"})
+
+	ready := e.GET("/ready").Expect().
+		Status(http.StatusServiceUnavailable).
+		JSON().Object()
+	ready.ValueEqual("status", "down")
+	ready.Value("checks").Object().Value("db").Object().
+		ValueEqual("status", "down").
+		ValueEqual("error", "connection refused").
+		ValueEqual("critical", true)
+}
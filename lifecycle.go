@@ -0,0 +1,59 @@
+package bastion
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// StartHook is a function to be implemented when is necessary to acquire resources before the app
+// starts serving, ie. open a database or warm up a cache. The ctx is canceled when a shutdown signal is received.
+type StartHook func(ctx context.Context) error
+
+// ReadyHook is a function called once the app is accepting connections. It receives the address where the
+// app is served, unix domain sockets have the "unix:" prefix.
+type ReadyHook func(addr string)
+
+// OnStart registers functions to call before the app starts serving. They run sequentially in order of
+// registration, the first error aborts the startup, the OnShutdown hooks registered after the previous ones
+// run to release what they acquired and Serve returns the error.
+func (app *Bastion) OnStart(hooks ...StartHook) {
+	app.startHooks = append(app.startHooks, hooks...)
+}
+
+// OnReady registers functions to call once the app is accepting connections, when the server starts
+// accepting from the listener. They run sequentially in order of registration without blocking the
+// serving of requests.
+func (app *Bastion) OnReady(hooks ...ReadyHook) {
+	app.readyHooks = append(app.readyHooks, hooks...)
+}
+
+// start runs the start hooks, it returns how many succeeded.
+func (app *Bastion) start(ctx context.Context) (int, error) {
+	for i, hook := range app.startHooks {
+		if err := hook(ctx); err != nil {
+			return i, errors.Wrapf(err, "start hook %v failed", i)
+		}
+	}
+	return len(app.startHooks), nil
+}
+
+func (app *Bastion) ready(addr string) {
+	for _, hook := range app.readyHooks {
+		hook(addr)
+	}
+}
+
+// readyListener runs the ready hooks once the server starts accepting connections from the listener.
+type readyListener struct {
+	net.Listener
+	once  sync.Once
+	ready func()
+}
+
+func (l *readyListener) Accept() (net.Conn, error) {
+	l.once.Do(func() { go l.ready() })
+	return l.Listener.Accept()
+}
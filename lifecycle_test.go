@@ -0,0 +1,110 @@
+package bastion
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycleHooks(t *testing.T) {
+	t.Parallel()
+
+	out := &syncWriter{w: &bytes.Buffer{}}
+	app := New(DisablePrettyLogging(), LoggerOutput(out))
+	var calls []string
+	app.OnStart(
+		func(ctx context.Context) error { calls = append(calls, "start 1"); return nil },
+		func(ctx context.Context) error { calls = append(calls, "start 2"); return nil },
+	)
+	ready := make(chan string, 1)
+	app.OnReady(func(addr string) {
+		calls = append(calls, "ready")
+		ready <- addr
+	})
+	app.OnShutdown(func(ctx context.Context) error { calls = append(calls, "shutdown"); return nil })
+
+	ln, err := listen("127.0.0.1:0")
+	require.Nil(t, err)
+	done := make(chan error, 1)
+	go func() { done <- app.ServeListener(ln) }()
+
+	select {
+	case addr := <-ready:
+		assert.Equal(t, ln.Addr().String(), addr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("ready hook not called")
+	}
+	res, err := http.Get("http://" + ln.Addr().String() + "/ping")
+	require.Nil(t, err)
+	res.Body.Close()
+
+	app.Shutdown()
+	assert.Equal(t, http.ErrServerClosed, <-done)
+	assert.Equal(t, []string{"start 1", "start 2", "ready", "shutdown"}, calls)
+}
+
+func TestStartHookAbortsStartup(t *testing.T) {
+	t.Parallel()
+
+	out := &syncWriter{w: &bytes.Buffer{}}
+	app := New(DisablePrettyLogging(), LoggerOutput(out))
+	var calls []string
+	stop := func(name string) ShutdownHook {
+		return func(ctx context.Context) error { calls = append(calls, name); return nil }
+	}
+	app.OnShutdown(stop("stop logs"))
+	app.OnStart(func(ctx context.Context) error { calls = append(calls, "start cache"); return nil })
+	app.OnShutdown(stop("stop cache"))
+	app.OnStart(func(ctx context.Context) error { return errors.New("connecting db") })
+	app.OnShutdown(stop("stop db"))
+	app.OnStart(func(ctx context.Context) error { calls = append(calls, "start queue"); return nil })
+	app.OnShutdown(stop("stop queue"))
+	app.OnReady(func(string) { calls = append(calls, "ready") })
+
+	ln, err := listen("127.0.0.1:0")
+	require.Nil(t, err)
+	err = app.ServeListener(ln)
+	assert.EqualError(t, err, "start hook 1 failed: connecting db")
+	// only the shutdown hooks of the succeeded start hooks run
+	assert.Equal(t, []string{"start cache", "stop cache", "stop logs"}, calls)
+	assert.Contains(t, out.String(), "start hook 1 failed: connecting db")
+	// the listener is closed
+	_, err = http.Get("http://" + ln.Addr().String() + "/ping")
+	assert.NotNil(t, err)
+}
+
+func TestReadyListener(t *testing.T) {
+	t.Parallel()
+
+	ln, err := listen("127.0.0.1:0")
+	require.Nil(t, err)
+	ready := make(chan struct{}, 2)
+	rl := &readyListener{Listener: ln, ready: func() { ready <- struct{}{} }}
+	select {
+	case <-ready:
+		t.Fatal("ready hook called before accepting")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ln.Close()
+	_, err = rl.Accept()
+	assert.NotNil(t, err)
+	_, err = rl.Accept()
+	assert.NotNil(t, err)
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ready hook not called")
+	}
+	select {
+	case <-ready:
+		t.Fatal("ready hook called twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,104 @@
+package bastion
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	unixAddrPrefix = "unix:"
+	// listenFDsStart is the first file descriptor passed by socket activation (SD_LISTEN_FDS_START).
+	listenFDsStart = 3
+)
+
+// resolveListener returns the listener where the app is going to be served. When no address is
+// given, sockets inherited through socket activation have priority over the ADDR env and the default address.
+func resolveListener(addr []string, l *zerolog.Logger) (net.Listener, error) {
+	if len(addr) == 0 {
+		ln, err := inheritedListener(listenFDsStart, l)
+		if err != nil || ln != nil {
+			return ln, err
+		}
+	}
+	address, err := resolveAddress(addr, l)
+	if err != nil {
+		return nil, err
+	}
+	return listen(address)
+}
+
+// listen announces on a tcp address or on a unix domain socket when the address has the "unix:" prefix.
+func listen(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, unixAddrPrefix) {
+		return net.Listen("tcp", address)
+	}
+
+	path := strings.TrimPrefix(address, unixAddrPrefix)
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := removeStaleSocket(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// removeStaleSocket removes the socket left by a previous run, it fails when the socket is still in use
+// or can't be checked.
+func removeStaleSocket(path string) error {
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return errors.Errorf("unix socket %v already in use", path)
+	}
+	if !isConnRefused(err) {
+		return errors.Wrap(err, "checking existing unix socket")
+	}
+	if err := os.Remove(path); err != nil {
+		return errors.Wrap(err, "removing stale unix socket")
+	}
+	return nil
+}
+
+func isConnRefused(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		if sysErr, ok := opErr.Err.(*os.SyscallError); ok {
+			return sysErr.Err == syscall.ECONNREFUSED
+		}
+	}
+	return false
+}
+
+// inheritedListener returns the listener passed through socket activation using
+// the LISTEN_FDS and LISTEN_PID env variables, or nil if there is none.
+func inheritedListener(fdStart int, l *zerolog.Logger) (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds < 1 {
+		return nil, nil
+	}
+	if nfds > 1 {
+		l.Warn().Msgf("socket activation passed %v file descriptors, only the first one is used", nfds)
+	}
+	// avoid the sockets being inherited again by child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(uintptr(fdStart), "LISTEN_FD_"+strconv.Itoa(fdStart))
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "inheriting socket activation listener")
+	}
+	l.Debug().Msgf("Using listener %v inherited through socket activation", ln.Addr())
+	return ln, nil
+}
@@ -0,0 +1,150 @@
+package bastion
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestListenTCP(t *testing.T) {
+	t.Parallel()
+
+	ln, err := listen("127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+	assert.Equal(t, "tcp", ln.Addr().Network())
+}
+
+func TestListenUnixRemovesStaleSocket(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bastion-unix")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.sock")
+
+	stale, err := net.Listen("unix", path)
+	require.Nil(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listen("unix:" + path)
+	require.Nil(t, err)
+	defer ln.Close()
+	assert.Equal(t, "unix", ln.Addr().Network())
+	assert.Equal(t, "unix:"+path, listenerAddr(ln))
+}
+
+func TestListenUnixSocketInUse(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bastion-unix")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.sock")
+
+	running, err := net.Listen("unix", path)
+	require.Nil(t, err)
+	defer running.Close()
+
+	ln, err := listen("unix:" + path)
+	assert.Nil(t, ln)
+	assert.EqualError(t, err, "unix socket "+path+" already in use")
+	_, err = os.Stat(path)
+	assert.Nil(t, err)
+}
+
+func TestInheritedListener(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer tcp.Close()
+	f, err := tcp.(*net.TCPListener).File()
+	require.Nil(t, err)
+	defer f.Close()
+	// inheritedListener takes the ownership of the fd, give it its own copy.
+	fd, err := syscall.Dup(int(f.Fd()))
+	require.Nil(t, err)
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+	out := &bytes.Buffer{}
+	app := New(DisablePrettyLogging(), LoggerOutput(out))
+	ln, err := inheritedListener(fd, &app.logger)
+	require.Nil(t, err)
+	require.NotNil(t, ln)
+	defer ln.Close()
+	assert.Equal(t, tcp.Addr().String(), ln.Addr().String())
+	assert.Empty(t, os.Getenv("LISTEN_PID"))
+	assert.Empty(t, os.Getenv("LISTEN_FDS"))
+	assert.Contains(t, out.String(), "inherited through socket activation")
+}
+
+func TestInheritedListenerWithoutActivation(t *testing.T) {
+	tt := []struct {
+		name string
+		pid  string
+		fds  string
+	}{
+		{"missing env", "", ""},
+		{"another process", "1", "1"},
+		{"without fds", strconv.Itoa(os.Getpid()), "0"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Setenv("LISTEN_PID", tc.pid)
+			os.Setenv("LISTEN_FDS", tc.fds)
+			defer os.Unsetenv("LISTEN_PID")
+			defer os.Unsetenv("LISTEN_FDS")
+			app := New()
+			ln, err := inheritedListener(listenFDsStart, &app.logger)
+			assert.Nil(t, err)
+			assert.Nil(t, ln)
+		})
+	}
+}
+
+func TestServeListenerUnixSocket(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bastion-unix")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.sock")
+
+	out := &bytes.Buffer{}
+	app := New(DisablePrettyLogging(), LoggerOutput(&syncWriter{w: out}))
+	ln, err := listen("unix:" + path)
+	require.Nil(t, err)
+	done := make(chan error, 1)
+	go func() { done <- app.ServeListener(ln) }()
+
+	res, err := unixClient(path).Get("http://unix/ping")
+	require.Nil(t, err)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, "pong", string(body))
+
+	app.Shutdown()
+	assert.Equal(t, http.ErrServerClosed, <-done)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -2,20 +2,22 @@ package bastion
 
 import (
 	"context"
+	"io"
 
 	"github.com/rs/zerolog"
 )
 
-func getLogger(opts *Options) *zerolog.Logger {
-	logger := zerolog.New(zerolog.ConsoleWriter{Out: opts.LoggerOutput}).
-		With().
-		Timestamp().
-		Logger()
-
-	logger = logger.Level(zerolog.Level(opts.level))
+// getLogger returns the app logger, its level is given by levels so it can be changed at runtime.
+func getLogger(opts *Options, levels *logLevels) *zerolog.Logger {
+	var out io.Writer = zerolog.ConsoleWriter{Out: opts.LoggerOutput}
 	if opts.DisablePrettyLogging {
-		logger = logger.Output(opts.LoggerOutput)
+		out = opts.LoggerOutput
 	}
+	logger := zerolog.New(levels.writer(out, true)).
+		With().
+		Timestamp().
+		Logger().
+		Sample(levels)
 
 	return &logger
 }
@@ -0,0 +1,311 @@
+package bastion
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+const loggerLevelRoute = "/loglevel"
+
+// logLevels holds the levels of the app logger, they can be changed at runtime globally or per component.
+// It samples the events below every enabled level before they are built and filters the written ones by
+// the level of their component.
+type logLevels struct {
+	mu         sync.RWMutex
+	base       zerolog.Level
+	global     zerolog.Level
+	components map[string]zerolog.Level
+	timers     map[string]*time.Timer
+	min        int32
+}
+
+func newLogLevels(base zerolog.Level) *logLevels {
+	l := &logLevels{
+		base:       base,
+		global:     base,
+		components: map[string]zerolog.Level{},
+		timers:     map[string]*time.Timer{},
+	}
+	l.updateMin()
+	return l
+}
+
+// Sample implements zerolog.Sampler, it drops the events below every enabled level.
+func (l *logLevels) Sample(lvl zerolog.Level) bool {
+	return int32(lvl) >= atomic.LoadInt32(&l.min)
+}
+
+// updateMin must be called with the lock held.
+func (l *logLevels) updateMin() {
+	min := l.global
+	for _, lvl := range l.components {
+		if lvl < min {
+			min = lvl
+		}
+	}
+	atomic.StoreInt32(&l.min, int32(min))
+}
+
+// set changes the level of the component, or the global one when it's empty. The level reverts to the
+// configured one after the ttl when it's greater than zero.
+func (l *logLevels) set(component string, lvl zerolog.Level, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if component == "" {
+		l.global = lvl
+	} else {
+		l.components[component] = lvl
+	}
+	l.stopTimer(component)
+	if ttl > 0 {
+		l.timers[component] = time.AfterFunc(ttl, func() { l.reset(component) })
+	}
+	l.updateMin()
+}
+
+// reset reverts the level of the component, or the global one when it's empty, to the configured one.
+func (l *logLevels) reset(component string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if component == "" {
+		l.global = l.base
+	} else {
+		delete(l.components, component)
+	}
+	l.stopTimer(component)
+	l.updateMin()
+}
+
+// resetAll reverts every level to the configured one.
+func (l *logLevels) resetAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for component := range l.timers {
+		l.stopTimer(component)
+	}
+	l.global = l.base
+	l.components = map[string]zerolog.Level{}
+	l.updateMin()
+}
+
+// stopTimer must be called with the lock held.
+func (l *logLevels) stopTimer(component string) {
+	if t, ok := l.timers[component]; ok {
+		t.Stop()
+		delete(l.timers, component)
+	}
+}
+
+// enabled reports whether an event of the component is written. When inherit is false the events
+// without component level aren't filtered.
+func (l *logLevels) enabled(component string, lvl zerolog.Level, inherit bool) bool {
+	if lvl == zerolog.NoLevel {
+		return true
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if min, ok := l.components[component]; ok {
+		return lvl >= min
+	}
+	return !inherit || lvl >= l.global
+}
+
+// logLevelsState is the representation of the levels served by the logger level endpoint.
+type logLevelsState struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+}
+
+func (l *logLevels) state() logLevelsState {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	s := logLevelsState{Level: l.global.String(), Components: map[string]string{}}
+	for component, lvl := range l.components {
+		s.Components[component] = lvl.String()
+	}
+	return s
+}
+
+// writer returns a writer into w that drops the events disabled for their component. When inherit is
+// false only the component levels apply, for the loggers that don't follow the app logger level.
+func (l *logLevels) writer(w io.Writer, inherit bool) zerolog.LevelWriter {
+	return &levelFilter{levels: l, w: w, inherit: inherit}
+}
+
+type levelFilter struct {
+	levels  *logLevels
+	w       io.Writer
+	inherit bool
+}
+
+func (f *levelFilter) Write(p []byte) (int, error) {
+	return f.w.Write(p)
+}
+
+func (f *levelFilter) WriteLevel(lvl zerolog.Level, p []byte) (int, error) {
+	if !f.levels.enabled(eventComponent(p), lvl, f.inherit) {
+		return len(p), nil
+	}
+	return f.w.Write(p)
+}
+
+var componentField = []byte(`"component":"`)
+
+// eventComponent returns the top level component field of a JSON event, the fields of the nested
+// objects, ie. the request headers logged by the recovery middleware, are skipped.
+func eventComponent(p []byte) string {
+	depth, inString := 0, false
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if inString {
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+		case '"':
+			if depth == 1 && (p[i-1] == '{' || p[i-1] == ',') && bytes.HasPrefix(p[i:], componentField) {
+				v := p[i+len(componentField):]
+				end := bytes.IndexByte(v, '"')
+				if end == -1 {
+					return ""
+				}
+				return string(v[:end])
+			}
+			inString = true
+		}
+	}
+	return ""
+}
+
+// watchSignals lowers the global level one step on SIGUSR1 and reverts every level on SIGUSR2 until
+// ctx is done. The changes are logged without level so they are always written.
+func (l *logLevels) watchSignals(ctx context.Context, ttl time.Duration, logger *zerolog.Logger) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(sig)
+	l.handleSignals(ctx, sig, ttl, logger)
+}
+
+func (l *logLevels) handleSignals(ctx context.Context, sig <-chan os.Signal, ttl time.Duration, logger *zerolog.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-sig:
+			if s == syscall.SIGUSR2 {
+				l.resetAll()
+				logger.Log().Str("component", "logger").Msgf("SIGUSR2 received, logger level reverted to %v", l.base)
+				continue
+			}
+			l.mu.RLock()
+			next := l.global
+			l.mu.RUnlock()
+			if next > zerolog.DebugLevel {
+				next--
+			}
+			l.set("", next, ttl)
+			logger.Log().Str("component", "logger").Msgf("SIGUSR1 received, logger level set to %v", next)
+		}
+	}
+}
+
+// SetLoggerLevel changes at runtime the level of the app logger for the component, ie. "route" or
+// "graceful", or globally when it's empty. The level reverts to the configured one after the ttl when
+// it's greater than zero. The recovery and internal error middleware logs are only filtered by their
+// component level.
+func (app *Bastion) SetLoggerLevel(component, level string, ttl time.Duration) error {
+	lvl, err := findLvl(level)
+	if err != nil {
+		return err
+	}
+	if lvl == zerolog.NoLevel {
+		return fmt.Errorf("bastion logger level unknown: %v", level)
+	}
+	app.logLevels.set(component, lvl, ttl)
+	return nil
+}
+
+// ResetLoggerLevels reverts the levels changed at runtime to the configured one.
+func (app *Bastion) ResetLoggerLevels() {
+	app.logLevels.resetAll()
+}
+
+type loggerLevelRequest struct {
+	Level     string `json:"level"`
+	Component string `json:"component"`
+	TTL       string `json:"ttl"`
+}
+
+// loggerLevelHandler serves the logger levels with GET, changes one with PUT and reverts them with DELETE.
+// The requests must carry the LoggerLevelToken as bearer token. The errors are rendered with the ErrorRenderer.
+func (app *Bastion) loggerLevelHandler(w http.ResponseWriter, r *http.Request) {
+	renderer := render.ForRequest(app.ErrorRenderer, r)
+	if !validBearer(r, app.LoggerLevelToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="bastion"`)
+		s := http.StatusUnauthorized
+		renderer.Response(w, s, render.NewHTTPError("invalid or missing bearer token", http.StatusText(s), s))
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		var req loggerLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			renderer.BadRequest(w, fmt.Errorf("decoding logger level: %v", err))
+			return
+		}
+		ttl := app.LoggerLevelTTL
+		if req.TTL != "" {
+			d, err := time.ParseDuration(req.TTL)
+			if err != nil || d < 0 {
+				renderer.BadRequest(w, fmt.Errorf("logger level ttl invalid: %v", req.TTL))
+				return
+			}
+			ttl = d
+		}
+		if err := app.SetLoggerLevel(req.Component, req.Level, ttl); err != nil {
+			renderer.BadRequest(w, err)
+			return
+		}
+		app.logger.Log().Str("component", "logger").
+			Str("level", req.Level).Str("target", defaultString(req.Component, "global")).Dur("ttl", ttl).
+			Msg("logger level changed")
+	case http.MethodDelete:
+		app.ResetLoggerLevels()
+		app.logger.Log().Str("component", "logger").Msg("logger levels reverted")
+	}
+	render.JSON.Send(w, app.logLevels.state())
+}
+
+func validBearer(r *http.Request, token string) bool {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if token == "" || !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, prefix)), []byte(token)) == 1
+}
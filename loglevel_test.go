@@ -0,0 +1,117 @@
+package bastion
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevels(t *testing.T) {
+	t.Parallel()
+
+	levels := newLogLevels(zerolog.ErrorLevel)
+	assert.False(t, levels.Sample(zerolog.InfoLevel))
+	assert.True(t, levels.Sample(zerolog.ErrorLevel))
+
+	levels.set("route", zerolog.DebugLevel, 0)
+	assert.True(t, levels.Sample(zerolog.DebugLevel))
+	assert.True(t, levels.enabled("route", zerolog.DebugLevel, true))
+	assert.False(t, levels.enabled("graceful", zerolog.WarnLevel, true))
+	assert.True(t, levels.enabled("graceful", zerolog.WarnLevel, false))
+	assert.True(t, levels.enabled("graceful", zerolog.NoLevel, true))
+
+	levels.set("", zerolog.WarnLevel, 0)
+	assert.True(t, levels.enabled("graceful", zerolog.WarnLevel, true))
+	assert.Equal(t, logLevelsState{Level: "warn", Components: map[string]string{"route": "debug"}}, levels.state())
+
+	levels.reset("route")
+	assert.False(t, levels.Sample(zerolog.InfoLevel))
+	levels.resetAll()
+	assert.Equal(t, logLevelsState{Level: "error", Components: map[string]string{}}, levels.state())
+	assert.False(t, levels.Sample(zerolog.WarnLevel))
+}
+
+func TestLogLevelsTTL(t *testing.T) {
+	t.Parallel()
+
+	levels := newLogLevels(zerolog.ErrorLevel)
+	levels.set("", zerolog.DebugLevel, 20*time.Millisecond)
+	levels.set("route", zerolog.InfoLevel, time.Hour)
+	levels.set("route", zerolog.DebugLevel, 0)
+
+	for i := 0; i < 100 && levels.state().Level != "error"; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, "error", levels.state().Level)
+	assert.Equal(t, map[string]string{"route": "debug"}, levels.state().Components)
+	assert.Empty(t, levels.timers)
+}
+
+func TestLevelFilter(t *testing.T) {
+	t.Parallel()
+
+	out := &bytes.Buffer{}
+	levels := newLogLevels(zerolog.ErrorLevel)
+	levels.set("route", zerolog.DebugLevel, 0)
+	l := zerolog.New(levels.writer(out, true)).Sample(levels)
+	l.Info().Msg("dropped")
+	l.Debug().Str("component", "route").Msg("GET /")
+	l.Debug().Str("component", "graceful").Msg("dropped")
+	l.Error().Str("component", "graceful").Msg("failed")
+	l.Log().Msg("always")
+
+	assert.Equal(t, `{"level":"debug","component":"route","message":"GET /"}
+{"level":"error","component":"graceful","message":"failed"}
+{"message":"always"}
+`, out.String())
+}
+
+func TestEventComponent(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "route", eventComponent([]byte(`{"level":"info","component":"route"}`)))
+	assert.Equal(t, "", eventComponent([]byte(`{"level":"info"}`)))
+	assert.Equal(t, "", eventComponent([]byte(`{"component":"rou`)))
+	// only the top level field
+	assert.Equal(t, "", eventComponent([]byte(`{"level":"error","req":{"headers":{"component":"route"}}}`)))
+	assert.Equal(t, "", eventComponent([]byte(`{"ids":[{"component":"route"}]}`)))
+	assert.Equal(t, "", eventComponent([]byte(`{"message":"\"component\":\"route\""}`)))
+	assert.Equal(t, "recovery middleware", eventComponent([]byte(
+		`{"req":{"headers":{"component":"route"},"url":"/{\"}"},"component":"recovery middleware"}`)))
+}
+
+func TestLogLevelsSignals(t *testing.T) {
+	t.Parallel()
+
+	out := &syncWriter{w: &bytes.Buffer{}}
+	logger := zerolog.New(out)
+	levels := newLogLevels(zerolog.ErrorLevel)
+	sig := make(chan os.Signal)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		levels.handleSignals(ctx, sig, 0, &logger)
+		close(done)
+	}()
+
+	sig <- syscall.SIGUSR1
+	sig <- syscall.SIGUSR1
+	sig <- syscall.SIGUSR1
+	// the level doesn't go below debug, once received the previous signal was handled
+	sig <- syscall.SIGUSR1
+	assert.Equal(t, "debug", levels.state().Level)
+	sig <- syscall.SIGUSR2
+	cancel()
+	<-done
+
+	assert.Equal(t, "error", levels.state().Level)
+	assert.Contains(t, out.String(), "SIGUSR1 received, logger level set to warn")
+	assert.Contains(t, out.String(), "SIGUSR1 received, logger level set to debug")
+	assert.Contains(t, out.String(), "SIGUSR2 received, logger level reverted to error")
+}
@@ -0,0 +1,100 @@
+package bastion
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ifreddyrondon/bastion/logsink"
+)
+
+// logOutput is the writer of the app logs, it allows to copy them into other writers while the app runs.
+type logOutput struct {
+	mu   sync.Mutex
+	w    io.Writer
+	taps []*logTap
+}
+
+type logTap struct {
+	w io.Writer
+}
+
+func newLogOutput(w io.Writer) *logOutput {
+	return &logOutput{w: w}
+}
+
+func (o *logOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, tap := range o.taps {
+		tap.w.Write(p)
+	}
+	return o.w.Write(p)
+}
+
+// tap copies the logs into w until the returned func is called.
+func (o *logOutput) tap(w io.Writer) func() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	t := &logTap{w: w}
+	o.taps = append(o.taps, t)
+	return func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		for i := range o.taps {
+			if o.taps[i] == t {
+				o.taps = append(o.taps[:i], o.taps[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// openLogSinks returns the writer of the logs, the rotating file replaces the LoggerOutput and the async
+// writer wraps any of them. The problems are collected into p, the async writer is only started when
+// there are none.
+func (app *Bastion) openLogSinks(p *problems) io.Writer {
+	out := app.LoggerOutput
+	if app.LoggerFile != "" {
+		f, err := logsink.NewRotatingFile(app.LoggerFile,
+			logsink.RotateMaxSize(app.LoggerFileMaxSize),
+			logsink.RotateEvery(app.LoggerFileRotateEvery),
+			logsink.RotateMaxBackups(app.LoggerFileMaxBackups),
+			logsink.RotateMaxAge(app.LoggerFileMaxAge),
+			logsink.RotateReportRemoveError(func(err error) {
+				app.logger.Warn().Err(err).Msg("removing the expired logger files")
+			}),
+		)
+		if err != nil {
+			p.check(fmt.Errorf("bastion logger file: %v", err))
+			return out
+		}
+		app.logFile = f
+		out = f
+	}
+	if app.LoggerAsync && len(*p) == 0 {
+		dropped := app.metrics.NewCounter("log_entries_dropped_total", "Total number of log entries dropped by the async logger.")
+		app.logAsync = logsink.NewAsyncWriter(out,
+			logsink.AsyncBufferSize(app.LoggerAsyncBufferSize),
+			logsink.AsyncDropPolicy(app.LoggerAsyncDropPolicy),
+			logsink.AsyncReportDropped(func(n uint64) {
+				dropped.Add(float64(n))
+				app.logger.Warn().Uint64("dropped", n).Msg("log entries dropped by the async logger")
+			}),
+		)
+		out = app.logAsync
+	}
+	return out
+}
+
+// Close writes the buffered logs of the async logger and closes the logger file. Serve calls it when it
+// returns, it's only needed when the app is used without Serve, ie. as a http.Handler.
+func (app *Bastion) Close() error {
+	if app.logAsync != nil {
+		app.logAsync.Close()
+	}
+	if app.logFile != nil {
+		return app.logFile.Close()
+	}
+	return nil
+}
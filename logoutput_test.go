@@ -0,0 +1,178 @@
+package bastion
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ifreddyrondon/bastion/logsink"
+)
+
+func TestLogOutputTap(t *testing.T) {
+	t.Parallel()
+
+	out, tap1, tap2 := &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}
+	o := newLogOutput(out)
+	untap1 := o.tap(tap1)
+	untap2 := o.tap(tap2)
+	o.Write([]byte("a"))
+	untap1()
+	o.Write([]byte("b"))
+	untap2()
+	o.Write([]byte("c"))
+
+	assert.Equal(t, "abc", out.String())
+	assert.Equal(t, "a", tap1.String())
+	assert.Equal(t, "ab", tap2.String())
+}
+
+func TestLoggerFile(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bastion-logfile")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	app := New(LoggerFile(path, 0, 0), LoggerFileRetention(3, 0))
+	assert.True(t, app.DisablePrettyLogging)
+	assert.Equal(t, int64(100<<20), app.LoggerFileMaxSize)
+	app.logger.Info().Msg("hello")
+	require.Nil(t, app.Close())
+
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Contains(t, string(b), `"message":"hello"`)
+}
+
+func TestLoggerFileClosedAfterServe(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bastion-logfile")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	app := New(LoggerFile(path, 0, 0), LoggerAsync(0, ""))
+	ln, err := listen("127.0.0.1:0")
+	require.Nil(t, err)
+	done := make(chan error, 1)
+	go func() { done <- app.ServeListener(ln) }()
+	app.Shutdown()
+	assert.Equal(t, http.ErrServerClosed, <-done)
+
+	// the last log of Serve is written before the file is closed
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Contains(t, string(b), `"message":"http: Server closed"`)
+}
+
+func TestLoggerFileFailure(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bastion-logfile")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	app, err := Build(LoggerFile(dir, 0, 0))
+	assert.Nil(t, app)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bastion logger file: opening log file")
+}
+
+func TestLoggerFileFailureAggregated(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bastion-logfile")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	app, err := Build(Config(struct{}{}), LoggerLevel("verbose"), LoggerFile(dir, 0, 0))
+	assert.Nil(t, app)
+	require.IsType(t, &OptionsError{}, err)
+	problems := err.(*OptionsError).Problems
+	require.Len(t, problems, 3)
+	assert.Equal(t, "bastion config must be a *Options or a pointer to a struct embedding Options, got struct {}", problems[0])
+	assert.Equal(t, "bastion logger level unknown: verbose", problems[1])
+	assert.Contains(t, problems[2], "bastion logger file: opening log file")
+}
+
+// blockingWriter blocks the writes until it's released.
+type blockingWriter struct {
+	syncWriter
+	started chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+	<-w.release
+	return w.syncWriter.Write(p)
+}
+
+func TestLoggerAsync(t *testing.T) {
+	t.Parallel()
+
+	out := &blockingWriter{
+		syncWriter: syncWriter{w: &bytes.Buffer{}},
+		started:    make(chan struct{}, 1),
+		release:    make(chan struct{}),
+	}
+	app := New(DisablePrettyLogging(), LoggerOutput(out), LoggerAsync(2, logsink.DropNewest))
+	// the debug mode message blocks the output
+	<-out.started
+	for _, msg := range []string{"1", "2", "3"} {
+		app.logger.Info().Msg(msg)
+	}
+	close(out.release)
+	app.Close()
+
+	logs := out.String()
+	assert.Contains(t, logs, `"message":"2"`)
+	assert.NotContains(t, logs, `"message":"3"`)
+	assert.Contains(t, logs, `"dropped":1`)
+	assert.Contains(t, logs, `"message":"log entries dropped by the async logger"`)
+	metrics := &bytes.Buffer{}
+	require.Nil(t, app.metrics.WriteText(metrics))
+	assert.Contains(t, metrics.String(), "log_entries_dropped_total 1")
+}
+
+func TestLoggerAsyncDefaults(t *testing.T) {
+	t.Parallel()
+
+	app := New(LoggerOutput(ioutil.Discard), LoggerAsync(0, ""))
+	defer app.Close()
+	assert.Equal(t, 1024, app.LoggerAsyncBufferSize)
+	assert.Equal(t, logsink.DropNewest, app.LoggerAsyncDropPolicy)
+}
+
+func TestLoggerAsyncBadDropPolicy(t *testing.T) {
+	t.Parallel()
+
+	_, err := Build(LoggerAsync(10, "middle"))
+	assert.EqualError(t, err, "bastion logger async drop policy unknown: middle")
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	t.Parallel()
+
+	out := &syncWriter{w: &bytes.Buffer{}}
+	sampler := zerolog.LevelSampler{InfoSampler: &zerolog.BasicSampler{N: 2}}
+	app := New(DisablePrettyLogging(), LoggerOutput(out), AccessLogSampling(sampler))
+	app.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	e := Tester(t, app)
+	for i := 0; i < 4; i++ {
+		e.GET("/").Expect().Status(200)
+	}
+	assert.Equal(t, 2, strings.Count(out.String(), `"status":200`))
+}
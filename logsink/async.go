@@ -0,0 +1,161 @@
+package logsink
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// DropPolicy decides which entry is dropped when the buffer of an AsyncWriter is full.
+type DropPolicy string
+
+const (
+	// DropNewest drops the entry being written.
+	DropNewest DropPolicy = "newest"
+	// DropOldest drops the oldest buffered entry to make room for the one being written.
+	DropOldest DropPolicy = "oldest"
+)
+
+const defaultBufferSize = 1024
+
+// AsyncBufferSize set the number of entries buffered before applying the drop policy. Default 1024.
+func AsyncBufferSize(n int) AsyncOpt {
+	return func(cfg *asyncCfg) {
+		cfg.bufferSize = n
+	}
+}
+
+// AsyncDropPolicy set the entry dropped when the buffer is full. Default DropNewest.
+func AsyncDropPolicy(policy DropPolicy) AsyncOpt {
+	return func(cfg *asyncCfg) {
+		cfg.policy = policy
+	}
+}
+
+// AsyncReportDropped set a function called from the writing goroutine with the number of entries
+// dropped since the last report. It's called before writing an entry when some were dropped.
+func AsyncReportDropped(fn func(dropped uint64)) AsyncOpt {
+	return func(cfg *asyncCfg) {
+		cfg.report = fn
+	}
+}
+
+// AsyncOpt helper type to create functional options for NewAsyncWriter.
+type AsyncOpt func(*asyncCfg)
+
+type asyncCfg struct {
+	bufferSize int
+	policy     DropPolicy
+	report     func(dropped uint64)
+}
+
+// AsyncWriter writes the entries into the underlying writer from a goroutine, so the callers never
+// block on a slow writer. The entries are buffered and dropped following the DropPolicy when the
+// buffer is full. It's safe for concurrent use.
+type AsyncWriter struct {
+	w        io.Writer
+	wmu      sync.Mutex
+	cfg      *asyncCfg
+	entries  chan []byte
+	mu       sync.RWMutex
+	closed   bool
+	done     chan struct{}
+	dropped  uint64
+	reported uint64
+}
+
+// NewAsyncWriter returns an AsyncWriter into w and starts its writing goroutine. It panics with an
+// unknown drop policy.
+func NewAsyncWriter(w io.Writer, opts ...AsyncOpt) *AsyncWriter {
+	cfg := &asyncCfg{bufferSize: defaultBufferSize, policy: DropNewest}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.bufferSize <= 0 {
+		cfg.bufferSize = defaultBufferSize
+	}
+	if cfg.policy != DropNewest && cfg.policy != DropOldest {
+		panic("logsink unknown drop policy: " + string(cfg.policy))
+	}
+	a := &AsyncWriter{
+		w:       w,
+		cfg:     cfg,
+		entries: make(chan []byte, cfg.bufferSize),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Write buffers a copy of p without blocking and reports len(p) written. Once the writer is closed p
+// is written synchronously.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return a.write(p)
+	}
+
+	entry := make([]byte, len(p))
+	copy(entry, p)
+	select {
+	case a.entries <- entry:
+		return len(p), nil
+	default:
+	}
+
+	if a.cfg.policy == DropOldest {
+		select {
+		case <-a.entries:
+			atomic.AddUint64(&a.dropped, 1)
+		default:
+		}
+		select {
+		case a.entries <- entry:
+			return len(p), nil
+		default:
+		}
+	}
+	atomic.AddUint64(&a.dropped, 1)
+	return len(p), nil
+}
+
+// Dropped returns the total number of entries dropped.
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	for entry := range a.entries {
+		// report before writing, so the buffer has room for the entries logged by the report.
+		if a.cfg.report != nil {
+			if dropped := atomic.LoadUint64(&a.dropped); dropped > a.reported {
+				a.cfg.report(dropped - a.reported)
+				a.reported = dropped
+			}
+		}
+		a.write(entry)
+	}
+}
+
+func (a *AsyncWriter) write(p []byte) (int, error) {
+	a.wmu.Lock()
+	defer a.wmu.Unlock()
+	return a.w.Write(p)
+}
+
+// Close stops buffering the entries and waits until the buffered ones are written, the later writes
+// are synchronous. The underlying writer isn't closed.
+func (a *AsyncWriter) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.entries)
+	a.mu.Unlock()
+	<-a.done
+	return nil
+}
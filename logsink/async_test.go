@@ -0,0 +1,133 @@
+package logsink_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ifreddyrondon/bastion/logsink"
+)
+
+// blockingWriter blocks every write until it's released.
+type blockingWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{started: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *blockingWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestAsyncWriter(t *testing.T) {
+	t.Parallel()
+
+	out := &bytes.Buffer{}
+	w := logsink.NewAsyncWriter(out)
+	p := []byte("a\n")
+	n, err := w.Write(p)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	p[0] = 'b'
+	w.Write([]byte("c\n"))
+	assert.Nil(t, w.Close())
+
+	assert.Equal(t, "a\nc\n", out.String())
+	assert.Equal(t, uint64(0), w.Dropped())
+	n, err = w.Write([]byte("d\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "a\nc\nd\n", out.String())
+	assert.Nil(t, w.Close())
+}
+
+func TestAsyncWriterDropPolicy(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name     string
+		policy   logsink.DropPolicy
+		expected string
+	}{
+		{"newest", logsink.DropNewest, "1\n2\n3\n"},
+		{"oldest", logsink.DropOldest, "1\n4\n5\n"},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			out := newBlockingWriter()
+			var reported []uint64
+			w := logsink.NewAsyncWriter(out,
+				logsink.AsyncBufferSize(2),
+				logsink.AsyncDropPolicy(tc.policy),
+				logsink.AsyncReportDropped(func(n uint64) { reported = append(reported, n) }),
+			)
+
+			w.Write([]byte("1\n"))
+			<-out.started
+			for _, entry := range []string{"2\n", "3\n", "4\n", "5\n"} {
+				n, err := w.Write([]byte(entry))
+				assert.Nil(t, err)
+				assert.Equal(t, 2, n)
+			}
+			close(out.release)
+			w.Close()
+
+			assert.Equal(t, tc.expected, out.String())
+			assert.Equal(t, uint64(2), w.Dropped())
+			assert.Equal(t, []uint64{2}, reported)
+		})
+	}
+}
+
+func TestAsyncWriterConcurrentWrites(t *testing.T) {
+	t.Parallel()
+
+	out := &bytes.Buffer{}
+	w := logsink.NewAsyncWriter(out, logsink.AsyncBufferSize(1000))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				w.Write([]byte("a\n"))
+			}
+		}()
+	}
+	wg.Wait()
+	w.Close()
+
+	assert.Equal(t, 100, strings.Count(out.String(), "a\n"))
+}
+
+func TestNewAsyncWriterPanicsWithUnknownDropPolicy(t *testing.T) {
+	t.Parallel()
+
+	assert.PanicsWithValue(t, "logsink unknown drop policy: middle", func() {
+		logsink.NewAsyncWriter(&bytes.Buffer{}, logsink.AsyncDropPolicy("middle"))
+	})
+}
@@ -0,0 +1,274 @@
+package logsink
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateMaxSize set the size in bytes after which the file is rotated. Default 0, no size based rotation.
+func RotateMaxSize(bytes int64) RotateOpt {
+	return func(cfg *rotateCfg) {
+		cfg.maxSize = bytes
+	}
+}
+
+// RotateEvery set the time after which the file is rotated. Default 0, no time based rotation.
+func RotateEvery(d time.Duration) RotateOpt {
+	return func(cfg *rotateCfg) {
+		cfg.every = d
+	}
+}
+
+// RotateMaxBackups set the number of rotated files to keep, the oldest ones are removed. Default 0, all are kept.
+func RotateMaxBackups(n int) RotateOpt {
+	return func(cfg *rotateCfg) {
+		cfg.maxBackups = n
+	}
+}
+
+// RotateMaxAge set the time to keep the rotated files, the older ones are removed. Default 0, all are kept.
+func RotateMaxAge(d time.Duration) RotateOpt {
+	return func(cfg *rotateCfg) {
+		cfg.maxAge = d
+	}
+}
+
+// RotateReportRemoveError set a function called with the error of removing the expired rotated files. The
+// rotation and the entry being written are kept, it's called after the file is unlocked so it can log into it.
+func RotateReportRemoveError(fn func(err error)) RotateOpt {
+	return func(cfg *rotateCfg) {
+		cfg.report = fn
+	}
+}
+
+// RotateOpt helper type to create functional options for NewRotatingFile.
+type RotateOpt func(*rotateCfg)
+
+type rotateCfg struct {
+	maxSize    int64
+	every      time.Duration
+	maxBackups int
+	maxAge     time.Duration
+	now        func() time.Time
+	remove     func(name string) error
+	report     func(err error)
+}
+
+// RotatingFile is a file writer rotated by size or time. The rotated files are renamed with the rotation
+// time, ie. app.log is rotated into app-2019-05-01T10-00-00.000.log, and removed after the retention.
+// It's safe for concurrent use.
+type RotatingFile struct {
+	mu        sync.Mutex
+	path      string
+	cfg       *rotateCfg
+	file      *os.File
+	size      int64
+	openedAt  time.Time
+	removeErr error
+}
+
+// NewRotatingFile opens or creates the file at path in append mode.
+func NewRotatingFile(path string, opts ...RotateOpt) (*RotatingFile, error) {
+	cfg := &rotateCfg{now: time.Now, remove: os.Remove}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	f := &RotatingFile{path: path, cfg: cfg}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return errors.Wrap(err, "creating log dir")
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "opening log file")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrap(err, "opening log file")
+	}
+	f.file, f.size, f.openedAt = file, info.Size(), f.cfg.now()
+	return nil
+}
+
+// Write writes p into the file, it's rotated before when the write would exceed the max size or
+// the rotation time elapsed.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	n, err := f.write(p)
+	removeErr := f.takeRemoveErr()
+	f.mu.Unlock()
+	f.reportRemoveError(removeErr)
+	return n, err
+}
+
+func (f *RotatingFile) write(p []byte) (int, error) {
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) shouldRotate(n int64) bool {
+	if f.cfg.maxSize > 0 && f.size > 0 && f.size+n > f.cfg.maxSize {
+		return true
+	}
+	return f.cfg.every > 0 && f.cfg.now().Sub(f.openedAt) >= f.cfg.every
+}
+
+// Rotate closes the current file, renames it with the rotation time and opens a new one. The error of
+// removing the expired rotated files is reported as in Write.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	if f.file == nil {
+		f.mu.Unlock()
+		return os.ErrClosed
+	}
+	err := f.rotate()
+	removeErr := f.takeRemoveErr()
+	f.mu.Unlock()
+	f.reportRemoveError(removeErr)
+	return err
+}
+
+// rotate keeps the error of removing the expired rotated files apart in removeErr, the rotation succeeded.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return errors.Wrap(err, "closing log file")
+	}
+	f.file = nil
+	if err := os.Rename(f.path, f.backupName(f.cfg.now().UTC())); err != nil {
+		// keep writing into the current file
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return errors.Wrap(err, "renaming log file")
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.removeErr = f.removeExpired()
+	return nil
+}
+
+func (f *RotatingFile) takeRemoveErr() error {
+	err := f.removeErr
+	f.removeErr = nil
+	return err
+}
+
+func (f *RotatingFile) reportRemoveError(err error) {
+	if err != nil && f.cfg.report != nil {
+		f.cfg.report(err)
+	}
+}
+
+// backupName returns the name of the rotated file, a counter is added if the name is taken.
+func (f *RotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(f.path)
+	base := strings.TrimSuffix(f.path, ext)
+	name := fmt.Sprintf("%s-%s%s", base, t.Format(backupTimeFormat), ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%s.%d%s", base, t.Format(backupTimeFormat), i, ext)
+	}
+}
+
+type backup struct {
+	path string
+	time time.Time
+}
+
+// backups returns the rotated files from the newest to the oldest.
+func (f *RotatingFile) backups() ([]backup, error) {
+	dir := filepath.Dir(f.path)
+	ext := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(filepath.Base(f.path), ext) + "-"
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing log files")
+	}
+	var backups []backup
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		if len(stamp) < len(backupTimeFormat) {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, stamp[:len(backupTimeFormat)])
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(dir, name), time: t})
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		if backups[i].time.Equal(backups[j].time) {
+			return backups[i].path > backups[j].path
+		}
+		return backups[i].time.After(backups[j].time)
+	})
+	return backups, nil
+}
+
+// removeExpired removes the rotated files beyond the max backups or older than the max age.
+func (f *RotatingFile) removeExpired() error {
+	if f.cfg.maxBackups <= 0 && f.cfg.maxAge <= 0 {
+		return nil
+	}
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	now := f.cfg.now()
+	for i, b := range backups {
+		expired := f.cfg.maxBackups > 0 && i >= f.cfg.maxBackups
+		expired = expired || (f.cfg.maxAge > 0 && now.Sub(b.time) > f.cfg.maxAge)
+		if !expired {
+			continue
+		}
+		if err := f.cfg.remove(b.path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "removing expired log file")
+		}
+	}
+	return nil
+}
+
+// Close closes the file, the later writes fail.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,266 @@
+package logsink
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) add(d time.Duration) { c.t = c.t.Add(d) }
+
+func newClock() *fakeClock {
+	return &fakeClock{t: time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)}
+}
+
+func withClock(c *fakeClock) RotateOpt {
+	return func(cfg *rotateCfg) {
+		cfg.now = c.now
+	}
+}
+
+func dirFiles(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	return string(b)
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "bastion-logsink")
+	require.Nil(t, err)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	t.Parallel()
+
+	dir, clean := tempDir(t)
+	defer clean()
+	path := filepath.Join(dir, "logs", "app.log")
+	f, err := NewRotatingFile(path)
+	require.Nil(t, err)
+	f.Write([]byte("a\n"))
+	require.Nil(t, f.Close())
+
+	f, err = NewRotatingFile(path)
+	require.Nil(t, err)
+	f.Write([]byte("b\n"))
+	require.Nil(t, f.Close())
+
+	assert.Equal(t, "a\nb\n", readFile(t, path))
+	_, err = f.Write([]byte("c\n"))
+	assert.Equal(t, os.ErrClosed, err)
+}
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	t.Parallel()
+
+	dir, clean := tempDir(t)
+	defer clean()
+	clock := newClock()
+	f, err := NewRotatingFile(filepath.Join(dir, "app.log"), RotateMaxSize(10), withClock(clock))
+	require.Nil(t, err)
+	defer f.Close()
+
+	f.Write([]byte("12345\n"))
+	f.Write([]byte("678\n"))
+	clock.add(time.Second)
+	f.Write([]byte("abc\n"))
+
+	assert.Equal(t, []string{"app-2019-05-01T10-00-01.000.log", "app.log"}, dirFiles(t, dir))
+	assert.Equal(t, "12345\n678\n", readFile(t, filepath.Join(dir, "app-2019-05-01T10-00-01.000.log")))
+	assert.Equal(t, "abc\n", readFile(t, filepath.Join(dir, "app.log")))
+}
+
+func TestRotatingFileWritesEntryBiggerThanMaxSize(t *testing.T) {
+	t.Parallel()
+
+	dir, clean := tempDir(t)
+	defer clean()
+	f, err := NewRotatingFile(filepath.Join(dir, "app.log"), RotateMaxSize(2))
+	require.Nil(t, err)
+	defer f.Close()
+
+	n, err := f.Write([]byte("12345\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+	assert.Equal(t, []string{"app.log"}, dirFiles(t, dir))
+}
+
+func TestRotatingFileRotatesByTime(t *testing.T) {
+	t.Parallel()
+
+	dir, clean := tempDir(t)
+	defer clean()
+	clock := newClock()
+	f, err := NewRotatingFile(filepath.Join(dir, "app.log"), RotateEvery(time.Hour), withClock(clock))
+	require.Nil(t, err)
+	defer f.Close()
+
+	f.Write([]byte("a\n"))
+	clock.add(59 * time.Minute)
+	f.Write([]byte("b\n"))
+	clock.add(time.Minute)
+	f.Write([]byte("c\n"))
+
+	assert.Equal(t, []string{"app-2019-05-01T11-00-00.000.log", "app.log"}, dirFiles(t, dir))
+	assert.Equal(t, "a\nb\n", readFile(t, filepath.Join(dir, "app-2019-05-01T11-00-00.000.log")))
+	assert.Equal(t, "c\n", readFile(t, filepath.Join(dir, "app.log")))
+}
+
+func TestRotatingFileAddsCounterToTakenBackupName(t *testing.T) {
+	t.Parallel()
+
+	dir, clean := tempDir(t)
+	defer clean()
+	f, err := NewRotatingFile(filepath.Join(dir, "app.log"), withClock(newClock()))
+	require.Nil(t, err)
+	defer f.Close()
+
+	f.Write([]byte("a\n"))
+	require.Nil(t, f.Rotate())
+	f.Write([]byte("b\n"))
+	require.Nil(t, f.Rotate())
+
+	assert.Equal(t, []string{
+		"app-2019-05-01T10-00-00.000.1.log",
+		"app-2019-05-01T10-00-00.000.log",
+		"app.log",
+	}, dirFiles(t, dir))
+	assert.Equal(t, "b\n", readFile(t, filepath.Join(dir, "app-2019-05-01T10-00-00.000.1.log")))
+}
+
+func TestRotatingFileRetention(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name     string
+		opts     []RotateOpt
+		expected []string
+	}{
+		{
+			"keep all by default",
+			nil,
+			[]string{
+				"app-2019-05-01T10-00-00.000.log",
+				"app-2019-05-01T11-00-00.000.log",
+				"app-2019-05-01T12-00-00.000.log",
+				"app.log",
+				"other.log",
+			},
+		},
+		{
+			"max backups",
+			[]RotateOpt{RotateMaxBackups(2)},
+			[]string{
+				"app-2019-05-01T11-00-00.000.log",
+				"app-2019-05-01T12-00-00.000.log",
+				"app.log",
+				"other.log",
+			},
+		},
+		{
+			"max age",
+			[]RotateOpt{RotateMaxAge(90 * time.Minute)},
+			[]string{
+				"app-2019-05-01T11-00-00.000.log",
+				"app-2019-05-01T12-00-00.000.log",
+				"app.log",
+				"other.log",
+			},
+		},
+		{
+			"max backups and max age",
+			[]RotateOpt{RotateMaxBackups(2), RotateMaxAge(30 * time.Minute)},
+			[]string{
+				"app-2019-05-01T12-00-00.000.log",
+				"app.log",
+				"other.log",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			dir, clean := tempDir(t)
+			defer clean()
+			require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "other.log"), nil, 0644))
+			clock := newClock()
+			opts := append([]RotateOpt{withClock(clock)}, tc.opts...)
+			f, err := NewRotatingFile(filepath.Join(dir, "app.log"), opts...)
+			require.Nil(t, err)
+			defer f.Close()
+
+			for i := 0; i < 3; i++ {
+				f.Write([]byte("a\n"))
+				require.Nil(t, f.Rotate())
+				clock.add(time.Hour)
+			}
+			assert.Equal(t, tc.expected, dirFiles(t, dir))
+		})
+	}
+}
+
+func TestRotatingFileReportsRemoveError(t *testing.T) {
+	t.Parallel()
+
+	dir, clean := tempDir(t)
+	defer clean()
+	clock := newClock()
+	failRemove := func(cfg *rotateCfg) {
+		cfg.remove = func(string) error { return errors.New("permission denied") }
+	}
+	var reported []error
+	f, err := NewRotatingFile(filepath.Join(dir, "app.log"), withClock(clock), failRemove,
+		RotateMaxSize(10), RotateMaxBackups(1), RotateReportRemoveError(func(err error) {
+			reported = append(reported, err)
+		}))
+	require.Nil(t, err)
+	defer f.Close()
+
+	for _, entry := range []string{"first\n", "second\n", "third\n"} {
+		n, err := f.Write([]byte(entry))
+		require.Nil(t, err)
+		assert.Equal(t, len(entry), n)
+		clock.add(time.Hour)
+	}
+	assert.Equal(t, "third\n", readFile(t, filepath.Join(dir, "app.log")))
+	require.Len(t, reported, 1)
+	assert.Contains(t, reported[0].Error(), "removing expired log file: permission denied")
+}
+
+func TestNewRotatingFileFailure(t *testing.T) {
+	t.Parallel()
+
+	dir, clean := tempDir(t)
+	defer clean()
+	require.Nil(t, os.Mkdir(filepath.Join(dir, "app.log"), 0755))
+	_, err := NewRotatingFile(filepath.Join(dir, "app.log"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "opening log file")
+}
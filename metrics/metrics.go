@@ -0,0 +1,321 @@
+// Package metrics provides counters, gauges and histograms with labels exposed in the
+// Prometheus text exposition format without requiring an external client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default histogram buckets, tailored to measure the latency in seconds of a request.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var nameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// ExponentialBuckets returns count buckets, the lowest one is start and each one is factor times the previous.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds the collectors and writes them in the Prometheus text exposition format.
+type Registry struct {
+	mu         sync.RWMutex
+	names      map[string]bool
+	collectors []collector
+}
+
+// NewRegistry returns a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// NewCounter registers and returns a counter. It panics if the name or the labels are invalid or
+// if the name is already registered.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: newVec(name, help, "counter", labels)}
+	r.register(name, c)
+	return c
+}
+
+// NewGauge registers and returns a gauge. It panics if the name or the labels are invalid or
+// if the name is already registered.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vec: newVec(name, help, "gauge", labels)}
+	r.register(name, g)
+	return g
+}
+
+// NewHistogram registers and returns a histogram, nil buckets means DefBuckets. It panics if the name,
+// the labels or the buckets are invalid or if the name is already registered.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			panic(fmt.Sprintf("metrics histogram %v buckets must be in increasing order", name))
+		}
+	}
+	for _, l := range labels {
+		if l == "le" {
+			panic(fmt.Sprintf("metrics histogram %v can't use the reserved label le", name))
+		}
+	}
+	h := &Histogram{vec: newVec(name, help, "histogram", labels), buckets: buckets}
+	r.register(name, h)
+	return h
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics %v already registered", name))
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText writes all the collectors in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler returns an http.Handler serving the collectors in the Prometheus text exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteText(w)
+	})
+}
+
+// vec holds the series of a metric identified by their label values.
+type vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// histogram only
+	counts []uint64
+	count  uint64
+}
+
+func newVec(name, help, typ string, labels []string) vec {
+	if !nameRE.MatchString(name) {
+		panic(fmt.Sprintf("metrics invalid name %q", name))
+	}
+	for _, l := range labels {
+		if !nameRE.MatchString(l) || strings.HasPrefix(l, "__") {
+			panic(fmt.Sprintf("metrics %v invalid label %q", name, l))
+		}
+	}
+	return vec{name: name, help: help, typ: typ, labels: labels, series: make(map[string]*series)}
+}
+
+// with returns the series of the label values, it must be called holding the lock.
+func (v *vec) with(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics %v expected %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *vec) sorted() []*series {
+	all := make([]*series, 0, len(v.series))
+	for _, s := range v.series {
+		all = append(all, s)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].labelValues, "\xff") < strings.Join(all[j].labelValues, "\xff")
+	})
+	return all
+}
+
+func (v *vec) writeHeader(w *bufio.Writer) {
+	if v.help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+}
+
+func (v *vec) writeSimple(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.writeHeader(w)
+	for _, s := range v.sorted() {
+		writeSample(w, v.name, v.labels, s.labelValues, "", "", s.value)
+	}
+}
+
+// Counter is a metric that only goes up, ie. the number of requests served.
+type Counter struct {
+	vec
+}
+
+// Inc increments by one the series of the label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds the given value to the series of the label values. It panics if the value is negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("metrics counter %v can't decrease", c.name))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.with(labelValues).value += v
+}
+
+func (c *Counter) write(w *bufio.Writer) { c.writeSimple(w) }
+
+// Gauge is a metric that can go up and down, ie. the number of in-flight requests.
+type Gauge struct {
+	vec
+}
+
+// Set sets the series of the label values to the given value.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.with(labelValues).value = v
+}
+
+// Add adds the given value, it can be negative, to the series of the label values.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.with(labelValues).value += v
+}
+
+// Inc increments by one the series of the label values.
+func (g *Gauge) Inc(labelValues ...string) { g.Add(1, labelValues...) }
+
+// Dec decrements by one the series of the label values.
+func (g *Gauge) Dec(labelValues ...string) { g.Add(-1, labelValues...) }
+
+func (g *Gauge) write(w *bufio.Writer) { g.writeSimple(w) }
+
+// Histogram samples observations in configurable buckets, ie. the latency of the requests.
+type Histogram struct {
+	vec
+	buckets []float64
+}
+
+// Observe adds an observation to the series of the label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.with(labelValues)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.value += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w)
+	for _, s := range h.sorted() {
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			writeSample(w, h.name+"_bucket", h.labels, s.labelValues, "le", formatFloat(upper), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, s.labelValues, "le", "+Inf", float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.labelValues, "", "", s.value)
+		writeSample(w, h.name+"_count", h.labels, s.labelValues, "", "", float64(s.count))
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, l, escapeLabelValue(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string { return helpEscaper.Replace(s) }
+
+func escapeLabelValue(s string) string { return labelEscaper.Replace(s) }
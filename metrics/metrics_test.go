@@ -0,0 +1,86 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ifreddyrondon/bastion/metrics"
+)
+
+func TestWriteText(t *testing.T) {
+	t.Parallel()
+
+	reg := metrics.NewRegistry()
+	c := reg.NewCounter("requests_total", "Total requests.", "method", "path")
+	c.Inc("GET", "/b")
+	c.Add(2, "GET", "/a")
+	g := reg.NewGauge("in_flight", "In flight\nrequests.")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	h := reg.NewHistogram("latency_seconds", "", []float64{0.1, 1}, "route")
+	h.Observe(0.05, `/"q"`)
+	h.Observe(0.1, `/"q"`)
+	h.Observe(3, `/"q"`)
+
+	out := &bytes.Buffer{}
+	assert.Nil(t, reg.WriteText(out))
+	expected := `# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total{method="GET",path="/a"} 2
+requests_total{method="GET",path="/b"} 1
+# HELP in_flight In flight\nrequests.
+# TYPE in_flight gauge
+in_flight 1
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/\"q\"",le="0.1"} 2
+latency_seconds_bucket{route="/\"q\"",le="1"} 2
+latency_seconds_bucket{route="/\"q\"",le="+Inf"} 3
+latency_seconds_sum{route="/\"q\""} 3.15
+latency_seconds_count{route="/\"q\""} 3
+`
+	assert.Equal(t, expected, out.String())
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	reg := metrics.NewRegistry()
+	reg.NewCounter("up", "").Inc()
+	w := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, metrics.ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "# TYPE up counter\nup 1\n", w.Body.String())
+}
+
+func TestRegistryPanics(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name string
+		fn   func(reg *metrics.Registry)
+	}{
+		{"duplicated name", func(reg *metrics.Registry) { reg.NewCounter("a", ""); reg.NewGauge("a", "") }},
+		{"invalid name", func(reg *metrics.Registry) { reg.NewCounter("a-b", "") }},
+		{"invalid label", func(reg *metrics.Registry) { reg.NewCounter("a", "", "__name") }},
+		{"reserved le label", func(reg *metrics.Registry) { reg.NewHistogram("a", "", nil, "le") }},
+		{"unsorted buckets", func(reg *metrics.Registry) { reg.NewHistogram("a", "", []float64{1, 1}) }},
+		{"wrong label values", func(reg *metrics.Registry) { reg.NewCounter("a", "", "method").Inc() }},
+		{"decreasing counter", func(reg *metrics.Registry) { reg.NewCounter("a", "").Add(-1) }},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Panics(t, func() { tc.fn(metrics.NewRegistry()) })
+		})
+	}
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, []float64{100, 1000, 10000}, metrics.ExponentialBuckets(100, 10, 3))
+}
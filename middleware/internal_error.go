@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
+	"github.com/ifreddyrondon/bastion/redact"
 	"github.com/ifreddyrondon/bastion/render"
 )
 
@@ -28,11 +30,27 @@ func InternalErrMsg(err error) func(*internalErr) {
 	}
 }
 
+// InternalErrRedactor set the redactor of the logged response body.
+func InternalErrRedactor(redactor *redact.Redactor) func(*internalErr) {
+	return func(a *internalErr) {
+		a.redactor = redactor
+	}
+}
+
+// InternalErrRenderer set the renderer of the 500 response, ie. render.ProblemJSON. Default render.JSON.
+// A *render.Negotiator is negotiated by the Accept header of the request.
+func InternalErrRenderer(renderer render.ServerErrRenderer) func(*internalErr) {
+	return func(a *internalErr) {
+		a.render = renderer
+	}
+}
+
 type internalErr struct {
 	defaultErr   error
 	render       render.ServerErrRenderer
 	loggerWriter io.Writer
 	logger       zerolog.Logger
+	redactor     *redact.Redactor
 }
 
 func internalErrCfg(opts ...func(*internalErr)) *internalErr {
@@ -50,25 +68,52 @@ func internalErrCfg(opts ...func(*internalErr)) *internalErr {
 	return cfg
 }
 
+// resetContentHeaders removes the headers that describe the body set by the handler, the error response
+// replaces it.
+func resetContentHeaders(w http.ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+}
+
+type internalErrCtxKey struct{}
+
+// SkipInternalError marks the response of the request as already handled, the InternalError middleware
+// sends it as is, even with a status >= 500, and doesn't log it. It's used by the handlers that render
+// and log their own errors, ie. the bastion error mappers.
+func SkipInternalError(r *http.Request) {
+	if skip, ok := r.Context().Value(internalErrCtxKey{}).(*bool); ok {
+		*skip = true
+	}
+}
+
 // InternalError intercept responses to verify their status and handle the error.
 // It gets the response code and if it's >= 500 handles the error with a
 // default error message without disclosure internal information.
-// The real error keeps logged.
+// The real error keeps logged. The responses marked with SkipInternalError are sent as is.
 func InternalError(opts ...func(*internalErr)) func(http.Handler) http.Handler {
 	cfg := internalErrCfg(opts...)
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
+			skip := new(bool)
+			r = r.WithContext(context.WithValue(r.Context(), internalErrCtxKey{}, skip))
 			buf := &bytes.Buffer{}
 			writeHeaderHook := WriteHeaderHook(HijackWriteHeaderHook)
 			writeHook := WriteHook(HijackWriteHook(buf))
 			m, snoop := WrapResponseWriter(w, writeHeaderHook, writeHook)
 			defer func() {
-				if m.Code >= 500 {
+				if m.Code >= 500 && !*skip {
 					cfg.logger.Info().
 						Str("component", "internal error middleware").
 						Int("status", m.Code).
-						Msg(buf.String())
-					cfg.render.InternalServerError(w, cfg.defaultErr)
+						Msg(string(cfg.redactor.Body(buf.Bytes())))
+					renderer := cfg.render
+					if api, ok := renderer.(render.APIRenderer); ok {
+						renderer = render.ForRequest(api, r)
+					}
+					resetContentHeaders(w)
+					renderer.InternalServerError(w, cfg.defaultErr)
 					return
 				}
 				w.WriteHeader(m.Code)
@@ -8,8 +8,11 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ifreddyrondon/bastion/middleware"
+	"github.com/ifreddyrondon/bastion/redact"
+	"github.com/ifreddyrondon/bastion/render"
 
 	"gopkg.in/gavv/httpexpect.v1"
 )
@@ -90,3 +93,111 @@ func TestInternalErrNot500(t *testing.T) {
 
 	assert.NotContains(t, out.String(), `"component":"internal error middleware`)
 }
+
+func TestInternalErrSkip(t *testing.T) {
+	t.Parallel()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middleware.SkipInternalError(r)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("try again later"))
+	})
+
+	out := &bytes.Buffer{}
+	m := middleware.InternalError(middleware.InternalErrLoggerOutput(out))
+	server := httptest.NewServer(m(h))
+	defer server.Close()
+
+	e := httpexpect.New(t, server.URL)
+	e.GET("/").Expect().Status(http.StatusServiceUnavailable).Body().Equal("try again later")
+
+	assert.NotContains(t, out.String(), `"component":"internal error middleware`)
+}
+
+func TestInternalErrRedactor(t *testing.T) {
+	t.Parallel()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+		w.Write([]byte(`{"error": "connecting to postgres://admin:hunter2@db", "token": "abc"}`))
+	})
+
+	out := &bytes.Buffer{}
+	redactor, err := redact.New(redact.Policy{Fields: []string{"token"}, Patterns: []string{`://[^@]+@`}})
+	require.Nil(t, err)
+	m := middleware.InternalError(middleware.InternalErrLoggerOutput(out), middleware.InternalErrRedactor(redactor))
+	server := httptest.NewServer(m(h))
+	defer server.Close()
+
+	e := httpexpect.New(t, server.URL)
+	e.GET("/").Expect().Status(500)
+	assert.Contains(t, out.String(), `postgres[REDACTED]db`)
+	assert.Contains(t, out.String(), `\"token\":\"[REDACTED]\"`)
+	assert.NotContains(t, out.String(), "hunter2")
+}
+
+func TestInternalErrRenderer(t *testing.T) {
+	t.Parallel()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+		w.Write([]byte("this should be logged"))
+	})
+
+	out := &bytes.Buffer{}
+	m := middleware.InternalError(middleware.InternalErrLoggerOutput(out), middleware.InternalErrRenderer(render.ProblemJSON))
+	server := httptest.NewServer(m(h))
+	defer server.Close()
+
+	e := httpexpect.New(t, server.URL)
+	body := e.GET("/").Expect().Status(500).ContentType("application/problem+json").Body().Raw()
+	assert.JSONEq(t, `{
+		"type": "about:blank",
+		"title": "Internal Server Error",
+		"status": 500,
+		"detail": "looks like something went wrong"
+	}`, body)
+}
+
+func TestInternalErrResetsHandlerHeaders(t *testing.T) {
+	t.Parallel()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(500)
+		w.Write([]byte(`{"error":"db down"}`))
+	})
+
+	out := &bytes.Buffer{}
+	m := middleware.InternalError(middleware.InternalErrLoggerOutput(out), middleware.InternalErrRenderer(render.ProblemJSON))
+	rr := httptest.NewRecorder()
+	m(h).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	httpexpect.NewResponse(t, rr.Result()).
+		Status(500).
+		ContentType("application/problem+json").
+		Header("Content-Encoding").Empty()
+	assert.Contains(t, rr.Body.String(), `"detail":"looks like something went wrong"`)
+}
+
+func TestInternalErrNegotiatedAfterHandlerHeaders(t *testing.T) {
+	t.Parallel()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(500)
+	})
+
+	out := &bytes.Buffer{}
+	m := middleware.InternalError(middleware.InternalErrLoggerOutput(out), middleware.InternalErrRenderer(render.Negotiate))
+	for _, accept := range []string{"application/xml", "application/yaml"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		m(h).ServeHTTP(rr, req)
+		httpexpect.NewResponse(t, rr.Result()).
+			Status(500).
+			ContentType(accept, "utf-8").
+			Body().Contains("looks like something went wrong")
+	}
+}
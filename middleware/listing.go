@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"net/url"
 
 	"github.com/pkg/errors"
 
@@ -110,17 +111,31 @@ func Listing(opts ...func(*listingConfig)) func(http.Handler) http.Handler {
 	cfg := getListingCfg(opts...)
 
 	return func(next http.Handler) http.Handler {
-		fn := func(w http.ResponseWriter, r *http.Request) {
-			var l listing.Listing
-
-			if err := listing.NewDecoder(r.URL.Query(), cfg.optionsDecoder...).Decode(&l); err != nil {
-				cfg.render.BadRequest(w, err)
-				return
-			}
-
-			ctx := withParams(r.Context(), &l)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		}
-		return http.HandlerFunc(fn)
+		return &listingHandler{cfg: cfg, next: next}
 	}
 }
+
+type listingHandler struct {
+	cfg  *listingConfig
+	next http.Handler
+}
+
+func (h *listingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var l listing.Listing
+
+	if err := listing.NewDecoder(r.URL.Query(), h.cfg.optionsDecoder...).Decode(&l); err != nil {
+		h.cfg.render.BadRequest(w, err)
+		return
+	}
+
+	ctx := withParams(r.Context(), &l)
+	h.next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ListingDefaults returns the listing decoded without url params, with the default paging and the available
+// sort and filter criteria. It allows to describe the middleware, ie. in the OpenAPI document.
+func (h *listingHandler) ListingDefaults() (listing.Listing, error) {
+	var l listing.Listing
+	err := listing.NewDecoder(url.Values{}, h.cfg.optionsDecoder...).Decode(&l)
+	return l, err
+}
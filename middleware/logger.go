@@ -7,6 +7,8 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
+
+	"github.com/ifreddyrondon/bastion/redact"
 )
 
 // AttachLogger chain the logger with the middleware.
@@ -79,6 +81,22 @@ func DisableLogRequestID() LoggerOpt {
 	}
 }
 
+// SampleAccessLog sample the access log entries, ie. zerolog.LevelSampler to keep 1 of 10 info entries
+// and every error entry. The entries are logged at error level for 5xx status codes and info otherwise.
+// The logs of the handlers aren't sampled.
+func SampleAccessLog(sampler zerolog.Sampler) LoggerOpt {
+	return func(r *loggerCfg) {
+		r.sampler = sampler
+	}
+}
+
+// LoggerRedactor set the redactor of the logged url, user agent and referer.
+func LoggerRedactor(redactor *redact.Redactor) LoggerOpt {
+	return func(r *loggerCfg) {
+		r.redactor = redactor
+	}
+}
+
 type LoggerOpt func(*loggerCfg)
 
 type loggerCfg struct {
@@ -92,6 +110,8 @@ type loggerCfg struct {
 	enableLogReqIP      bool
 	enableLogUserAgent  bool
 	enableLogReferer    bool
+	sampler             zerolog.Sampler
+	redactor            *redact.Redactor
 }
 
 func getLoggerCfg(opts ...LoggerOpt) *loggerCfg {
@@ -105,10 +125,14 @@ func getLoggerCfg(opts ...LoggerOpt) *loggerCfg {
 }
 
 func getLoggerWithLevel(r *http.Request, status int) *zerolog.Event {
+	return hlog.FromRequest(r).WithLevel(accessLogLevel(status))
+}
+
+func accessLogLevel(status int) zerolog.Level {
 	if status >= 500 {
-		return hlog.FromRequest(r).Error()
+		return zerolog.ErrorLevel
 	}
-	return hlog.FromRequest(r).Info()
+	return zerolog.InfoLevel
 }
 
 // Logger is a middleware that logs the start and end of each request, along
@@ -121,12 +145,19 @@ func Logger(opts ...LoggerOpt) func(http.Handler) http.Handler {
 	loggers := []func(http.Handler) http.Handler{
 		hlog.NewHandler(cfg.logger),
 		hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
+			if cfg.sampler != nil && !cfg.sampler.Sample(accessLogLevel(status)) {
+				return
+			}
 			l := getLoggerWithLevel(r, status)
 			if !cfg.disableLogMethod {
 				l.Str("method", r.Method)
 			}
 			if !cfg.disableLogURL {
-				l.Str("URL", r.URL.String())
+				if cfg.redactor != nil {
+					l.Str("URL", cfg.redactor.URL(r.URL))
+				} else {
+					l.Str("URL", r.URL.String())
+				}
 			}
 			if !cfg.disableLogStatus {
 				l.Int("status", status)
@@ -147,10 +178,10 @@ func Logger(opts ...LoggerOpt) func(http.Handler) http.Handler {
 		loggers = append(loggers, hlog.RemoteAddrHandler("ip"))
 	}
 	if cfg.enableLogUserAgent {
-		loggers = append(loggers, hlog.UserAgentHandler("user_agent"))
+		loggers = append(loggers, headerHandler("user_agent", "User-Agent", cfg.redactor))
 	}
 	if cfg.enableLogReferer {
-		loggers = append(loggers, hlog.RefererHandler("referer"))
+		loggers = append(loggers, headerHandler("referer", "Referer", cfg.redactor))
 	}
 
 	return func(next http.Handler) http.Handler {
@@ -161,3 +192,18 @@ func Logger(opts ...LoggerOpt) func(http.Handler) http.Handler {
 		return h
 	}
 }
+
+// headerHandler adds the redacted value of the request header to the request logger with fieldKey.
+func headerHandler(fieldKey, header string, redactor *redact.Redactor) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if value := r.Header.Get(header); value != "" {
+				log := zerolog.Ctx(r.Context())
+				log.UpdateContext(func(c zerolog.Context) zerolog.Context {
+					return c.Str(fieldKey, redactor.Header(header, value))
+				})
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -4,13 +4,16 @@ import (
 	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/gavv/httpexpect.v1"
 
 	"github.com/ifreddyrondon/bastion/middleware"
+	"github.com/ifreddyrondon/bastion/redact"
 )
 
 func TestLoggerDefaults(t *testing.T) {
@@ -111,3 +114,62 @@ func TestLoggerRequestErrorLvl(t *testing.T) {
 	e.GET("/").Expect().Status(200).Body().Equal("ok")
 	assert.NotContains(t, out.String(), `"status":200`)
 }
+
+func TestLoggerSampleAccessLog(t *testing.T) {
+	t.Parallel()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(500)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+
+	out := &bytes.Buffer{}
+	l := zerolog.New(out)
+	sampler := zerolog.LevelSampler{InfoSampler: &zerolog.BasicSampler{N: 3}}
+	m := middleware.Logger(middleware.AttachLogger(l), middleware.SampleAccessLog(sampler))
+	server := httptest.NewServer(m(h))
+	defer server.Close()
+
+	e := httpexpect.New(t, server.URL)
+	for i := 0; i < 6; i++ {
+		e.GET("/").Expect().Status(200)
+	}
+	e.GET("/fail").Expect().Status(500)
+	e.GET("/fail").Expect().Status(500)
+	assert.Equal(t, 2, strings.Count(out.String(), `"status":200`))
+	assert.Equal(t, 2, strings.Count(out.String(), `"status":500`))
+}
+
+func TestLoggerRedactor(t *testing.T) {
+	t.Parallel()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	out := &bytes.Buffer{}
+	l := zerolog.New(out)
+	redactor, err := redact.New(redact.Policy{Query: []string{"token"}, Patterns: []string{`key=\w+`}})
+	require.Nil(t, err)
+	m := middleware.Logger(
+		middleware.AttachLogger(l),
+		middleware.EnableLogReferer(),
+		middleware.EnableLogUserAgent(),
+		middleware.LoggerRedactor(redactor),
+	)
+	server := httptest.NewServer(m(h))
+	defer server.Close()
+
+	e := httpexpect.New(t, server.URL)
+	e.GET("/").WithQuery("token", "abc").WithQuery("page", "1").
+		WithHeader("Referer", "http://example.com/?key=abc").
+		WithHeader("User-Agent", "test").
+		Expect().Status(200)
+	assert.Contains(t, out.String(), `"URL":"/?page=1&token=[REDACTED]"`)
+	assert.Contains(t, out.String(), `"referer":"http://example.com/?[REDACTED]"`)
+	assert.Contains(t, out.String(), `"user_agent":"test"`)
+	assert.NotContains(t, out.String(), "abc")
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/ifreddyrondon/bastion/metrics"
+)
+
+// unmatchedRoute is the route label of the requests that didn't match a chi route.
+const unmatchedRoute = "unmatched"
+
+// MetricsRegistry set the registry where the metrics are registered. Default a new registry.
+func MetricsRegistry(reg *metrics.Registry) MetricsOpt {
+	return func(cfg *metricsCfg) {
+		cfg.registry = reg
+	}
+}
+
+// MetricsDurationBuckets set the buckets in seconds of the request duration histogram. Default metrics.DefBuckets.
+func MetricsDurationBuckets(buckets []float64) MetricsOpt {
+	return func(cfg *metricsCfg) {
+		cfg.durationBuckets = buckets
+	}
+}
+
+// MetricsSizeBuckets set the buckets in bytes of the response size histogram. Default from 100B to 100MB.
+func MetricsSizeBuckets(buckets []float64) MetricsOpt {
+	return func(cfg *metricsCfg) {
+		cfg.sizeBuckets = buckets
+	}
+}
+
+// MetricsOpt helper type to create functional options for the metrics middleware.
+type MetricsOpt func(*metricsCfg)
+
+type metricsCfg struct {
+	registry        *metrics.Registry
+	durationBuckets []float64
+	sizeBuckets     []float64
+}
+
+func getMetricsCfg(opts ...MetricsOpt) *metricsCfg {
+	cfg := &metricsCfg{
+		durationBuckets: metrics.DefBuckets,
+		sizeBuckets:     metrics.ExponentialBuckets(100, 10, 7),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.registry == nil {
+		cfg.registry = metrics.NewRegistry()
+	}
+	return cfg
+}
+
+// Metrics is a middleware that records the requests count, duration, response size and in-flight requests.
+// The series are labelled by method and chi route pattern, not by raw URL, to keep a bounded cardinality.
+// Requests without a route pattern are labelled as "unmatched", the ones not found in a mounted router keep
+// the mount pattern, ie. "/*". The metrics are registered in the registry
+// so the middleware must be created only once per registry.
+func Metrics(opts ...MetricsOpt) func(http.Handler) http.Handler {
+	cfg := getMetricsCfg(opts...)
+	requests := cfg.registry.NewCounter("http_requests_total",
+		"Total number of HTTP requests.", "method", "route", "code")
+	duration := cfg.registry.NewHistogram("http_request_duration_seconds",
+		"Duration of the HTTP requests in seconds.", cfg.durationBuckets, "method", "route")
+	size := cfg.registry.NewHistogram("http_response_size_bytes",
+		"Size of the HTTP responses in bytes.", cfg.sizeBuckets, "method", "route")
+	inFlight := cfg.registry.NewGauge("http_requests_in_flight",
+		"Number of HTTP requests being served.")
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			inFlight.Inc()
+			defer inFlight.Dec()
+			start := time.Now()
+			collector, ww := WrapResponseWriter(w)
+			next.ServeHTTP(ww, r)
+
+			route := routePattern(r)
+			requests.Inc(r.Method, route, strconv.Itoa(collector.Code))
+			duration.Observe(time.Since(start).Seconds(), r.Method, route)
+			size.Observe(float64(collector.Bytes), r.Method, route)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func routePattern(r *http.Request) string {
+	rctx, ok := r.Context().Value(chi.RouteCtxKey).(*chi.Context)
+	if !ok {
+		return unmatchedRoute
+	}
+	if pattern := rctx.RoutePattern(); pattern != "" {
+		return pattern
+	}
+	return unmatchedRoute
+}
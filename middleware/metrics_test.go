@@ -0,0 +1,47 @@
+package middleware_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gavv/httpexpect.v1"
+
+	"github.com/ifreddyrondon/bastion/metrics"
+	"github.com/ifreddyrondon/bastion/middleware"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	reg := metrics.NewRegistry()
+	r := chi.NewRouter()
+	r.Use(middleware.Metrics(middleware.MetricsRegistry(reg), middleware.MetricsDurationBuckets([]float64{1})))
+	r.Get("/todos/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("todo"))
+	})
+	r.Post("/todos", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	e := httpexpect.New(t, server.URL)
+	e.GET("/todos/1").Expect().Status(http.StatusOK)
+	e.GET("/todos/2").Expect().Status(http.StatusOK)
+	e.POST("/todos").Expect().Status(http.StatusCreated)
+	e.GET("/missing").Expect().Status(http.StatusNotFound)
+
+	out := &bytes.Buffer{}
+	reg.WriteText(out)
+	assert.Contains(t, out.String(), `http_requests_total{method="GET",route="/todos/{id}",code="200"} 2`)
+	assert.Contains(t, out.String(), `http_requests_total{method="POST",route="/todos",code="201"} 1`)
+	assert.Contains(t, out.String(), `http_requests_total{method="GET",route="unmatched",code="404"} 1`)
+	assert.Contains(t, out.String(), `http_request_duration_seconds_bucket{method="GET",route="/todos/{id}",le="1"} 2`)
+	assert.Contains(t, out.String(), `http_response_size_bytes_sum{method="GET",route="/todos/{id}"} 8`)
+	assert.Contains(t, out.String(), "http_requests_in_flight 0")
+	assert.NotContains(t, out.String(), "/todos/1")
+}
@@ -11,12 +11,13 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
+	"github.com/ifreddyrondon/bastion/redact"
 	"github.com/ifreddyrondon/bastion/render"
 )
 
-func logreq(r *http.Request) *zerolog.Event {
+func logreq(r *http.Request, redactor *redact.Redactor) *zerolog.Event {
 	evt := zerolog.Dict()
-	evt.Str("url", r.URL.RequestURI()).
+	evt.Str("url", redactor.URL(r.URL)).
 		Str("method", r.Method).
 		Str("proto", r.Proto).
 		Str("host", r.Host)
@@ -24,13 +25,13 @@ func logreq(r *http.Request) *zerolog.Event {
 	headers := zerolog.Dict()
 	for name, values := range r.Header {
 		name = strings.ToLower(name)
-		headers.Str(name, strings.Join(values, ","))
+		headers.Str(name, redactor.Header(name, strings.Join(values, ",")))
 	}
 	evt.Dict("headers", headers)
 
 	if r.Body != nil {
 		body, _ := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
-		evt.Bytes("body", body)
+		evt.Bytes("body", redactor.Body(body))
 	}
 
 	return evt
@@ -40,6 +41,7 @@ type recoveryCfg struct {
 	render       render.ServerErrRenderer
 	loggerWriter io.Writer
 	logger       zerolog.Logger
+	redactor     *redact.Redactor
 }
 
 // RecoveryLoggerOutput set the output for the logger
@@ -49,6 +51,21 @@ func RecoveryLoggerOutput(w io.Writer) func(*recoveryCfg) {
 	}
 }
 
+// RecoveryRedactor set the redactor of the url, headers and body of the logged request.
+func RecoveryRedactor(redactor *redact.Redactor) func(*recoveryCfg) {
+	return func(r *recoveryCfg) {
+		r.redactor = redactor
+	}
+}
+
+// RecoveryRenderer set the renderer of the 500 response, ie. render.ProblemJSON. Default render.JSON.
+// A *render.Negotiator is negotiated by the Accept header of the request.
+func RecoveryRenderer(renderer render.ServerErrRenderer) func(*recoveryCfg) {
+	return func(r *recoveryCfg) {
+		r.render = renderer
+	}
+}
+
 func getRecoveryCfg(opts ...func(*recoveryCfg)) *recoveryCfg {
 	r := &recoveryCfg{
 		render:       render.JSON,
@@ -84,9 +101,14 @@ func Recovery(opts ...func(*recoveryCfg)) func(http.Handler) http.Handler {
 					}
 					cfg.logger.Error().
 						Str("component", "recovery middleware").
-						Err(err).Dict("req", logreq(req)).
+						Err(err).Dict("req", logreq(req, cfg.redactor)).
 						Msg("Recovery middleware catch an error")
-					cfg.render.InternalServerError(w, err)
+					renderer := cfg.render
+					if api, ok := renderer.(render.APIRenderer); ok {
+						renderer = render.ForRequest(api, req)
+					}
+					resetContentHeaders(w)
+					renderer.InternalServerError(w, err)
 					return
 				}
 			}()
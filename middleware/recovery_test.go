@@ -9,9 +9,12 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/gavv/httpexpect.v1"
 
 	"github.com/ifreddyrondon/bastion/middleware"
+	"github.com/ifreddyrondon/bastion/redact"
+	"github.com/ifreddyrondon/bastion/render"
 )
 
 func TestRecovery(t *testing.T) {
@@ -129,3 +132,91 @@ func TestRecoveryLogRequestPOST(t *testing.T) {
 	assert.Contains(t, out.String(), `"req":{"url":"/","method":"POST","proto":"HTTP/1.1","host":"`)
 	assert.Contains(t, out.String(), `"body":"{\"hello\":\"world\"}"`)
 }
+
+func TestRecoveryRedactor(t *testing.T) {
+	t.Parallel()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("test")
+	})
+
+	out := &bytes.Buffer{}
+	redactor, err := redact.New(redact.Policy{
+		Headers: redact.DefaultHeaders,
+		Fields:  []string{"password"},
+		Query:   []string{"token"},
+	})
+	require.Nil(t, err)
+	m := middleware.Recovery(middleware.RecoveryLoggerOutput(out), middleware.RecoveryRedactor(redactor))
+	server := httptest.NewServer(m(h))
+	defer server.Close()
+
+	e := httpexpect.New(t, server.URL)
+	e.POST("/login").WithQuery("token", "abc").
+		WithHeader("Authorization", "Bearer abc").
+		WithHeader("Cookie", "session=abc").
+		WithJSON(map[string]string{"user": "bob", "password": "abc"}).
+		Expect().Status(500)
+	output := out.String()
+	assert.Contains(t, output, `"url":"/login?token=[REDACTED]"`)
+	assert.Contains(t, output, `"authorization":"[REDACTED]"`)
+	assert.Contains(t, output, `"cookie":"[REDACTED]"`)
+	assert.Contains(t, output, `"body":"{\"password\":\"[REDACTED]\",\"user\":\"bob\"}"`)
+	assert.NotContains(t, output, "abc")
+}
+
+func TestRecoveryRenderer(t *testing.T) {
+	t.Parallel()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("testing recovery")
+	})
+
+	out := &bytes.Buffer{}
+	m := middleware.Recovery(middleware.RecoveryLoggerOutput(out), middleware.RecoveryRenderer(render.ProblemXML))
+	server := httptest.NewServer(m(h))
+	defer server.Close()
+
+	e := httpexpect.New(t, server.URL)
+	e.GET("/").Expect().Status(500).ContentType("application/problem+xml").
+		Body().Contains(`<problem xmlns="urn:ietf:rfc:7807"><type>about:blank</type><title>Internal Server Error</title><status>500</status><detail>testing recovery</detail></problem>`)
+}
+
+func TestRecoveryResetsHandlerHeaders(t *testing.T) {
+	t.Parallel()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", "42")
+		panic("testing recovery")
+	})
+
+	out := &bytes.Buffer{}
+	m := middleware.Recovery(middleware.RecoveryLoggerOutput(out), middleware.RecoveryRenderer(render.ProblemJSON))
+	server := httptest.NewServer(m(h))
+	defer server.Close()
+
+	e := httpexpect.New(t, server.URL)
+	e.GET("/").Expect().Status(500).ContentType("application/problem+json").
+		Body().Contains(`"detail":"testing recovery"`)
+}
+
+func TestRecoveryNegotiatedAfterHandlerHeaders(t *testing.T) {
+	t.Parallel()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		panic("testing recovery")
+	})
+
+	out := &bytes.Buffer{}
+	m := middleware.Recovery(middleware.RecoveryLoggerOutput(out), middleware.RecoveryRenderer(render.Negotiate))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/xml")
+	rr := httptest.NewRecorder()
+	m(h).ServeHTTP(rr, req)
+	httpexpect.NewResponse(t, rr.Result()).
+		Status(500).
+		ContentType("application/xml", "utf-8").
+		Body().Contains(`message="testing recovery"`)
+}
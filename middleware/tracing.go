@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ifreddyrondon/bastion/tracing"
+)
+
+// TracingExporter set the exporter of the request spans. Default nil, the trace context is only propagated.
+func TracingExporter(exporter tracing.Exporter) TracingOpt {
+	return func(cfg *tracingCfg) {
+		cfg.exporter = exporter
+	}
+}
+
+// TracingOpt helper type to create functional options for the tracing middleware.
+type TracingOpt func(*tracingCfg)
+
+type tracingCfg struct {
+	exporter tracing.Exporter
+}
+
+// Tracing is a middleware that creates a server span per request, child of the span propagated in the
+// traceparent and tracestate headers, and stores it in the request context. The span is named after the
+// chi route pattern and the trace context is sent back in the response headers. When it runs after the
+// Logger middleware, the trace_id and span_id are added to the request logger.
+func Tracing(opts ...TracingOpt) func(http.Handler) http.Handler {
+	cfg := &tracingCfg{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	tracer := tracing.NewTracer(cfg.exporter)
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			remote, _ := tracing.Extract(r.Header)
+			ctx, span := tracer.Start(r.Context(), r.Method+" "+r.URL.Path, tracing.KindServer, remote)
+			defer span.End()
+
+			sc := span.Context()
+			zerolog.Ctx(ctx).UpdateContext(func(c zerolog.Context) zerolog.Context {
+				return c.Str("trace_id", sc.TraceID.String()).Str("span_id", sc.SpanID.String())
+			})
+			tracing.Inject(ctx, w.Header())
+
+			collector, ww := WrapResponseWriter(w)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			route := routePattern(r)
+			span.SetName(r.Method + " " + route)
+			span.SetAttribute("http.method", r.Method)
+			span.SetAttribute("http.route", route)
+			span.SetAttribute("http.target", r.URL.RequestURI())
+			span.SetAttribute("http.status_code", strconv.Itoa(collector.Code))
+			if collector.Code >= http.StatusInternalServerError {
+				span.SetError(fmt.Errorf("%d %s", collector.Code, http.StatusText(collector.Code)))
+			}
+		}
+		return http.HandlerFunc(fn)
+	}
+}
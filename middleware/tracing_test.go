@@ -0,0 +1,62 @@
+package middleware_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/gavv/httpexpect.v1"
+
+	"github.com/ifreddyrondon/bastion/middleware"
+	"github.com/ifreddyrondon/bastion/tracing"
+)
+
+func TestTracing(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracing.NewInMemoryExporter()
+	out := &bytes.Buffer{}
+	r := chi.NewRouter()
+	r.Use(middleware.Logger(middleware.AttachLogger(zerolog.New(out))))
+	r.Use(middleware.Tracing(middleware.TracingExporter(exporter)))
+	r.Get("/todos/{id}", func(w http.ResponseWriter, r *http.Request) {
+		hlog.FromRequest(r).Info().Msg("handling")
+		w.Write([]byte("todo"))
+	})
+	r.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	e := httpexpect.New(t, server.URL)
+	res := e.GET("/todos/1").
+		WithHeader("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01").
+		WithHeader("tracestate", "vendor=1").
+		Expect().Status(http.StatusOK)
+	res.Header("tracestate").Equal("vendor=1")
+	e.GET("/fail").Expect().Status(http.StatusInternalServerError)
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 2)
+	span := spans[0]
+	assert.Equal(t, "GET /todos/{id}", span.Name)
+	assert.Equal(t, tracing.KindServer, span.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", span.ParentSpanID)
+	assert.Equal(t, "200", span.Attributes["http.status_code"])
+	assert.Equal(t, "/todos/1", span.Attributes["http.target"])
+	res.Header("traceparent").Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.SpanID + "-01")
+	assert.Contains(t, out.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"`+span.SpanID+`","message":"handling"`)
+
+	assert.Equal(t, "GET /fail", spans[1].Name)
+	assert.Empty(t, spans[1].ParentSpanID)
+	assert.NotEqual(t, span.TraceID, spans[1].TraceID)
+	assert.Equal(t, "500 Internal Server Error", spans[1].Error)
+}
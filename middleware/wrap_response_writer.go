@@ -107,6 +107,13 @@ type WriterMetricsCollector struct {
 	locker      sync.Mutex
 }
 
+// WroteHeader reports whether the response header was written, by WriteHeader or Write.
+func (c *WriterMetricsCollector) WroteHeader() bool {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.wroteHeader
+}
+
 // WriteHeaderHook define the method interceptor when WriteHeader is called.
 func WriteHeaderHook(hook func(*WriterMetricsCollector) func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc) func(*wrapWriterOpts) {
 	return func(opts *wrapWriterOpts) {
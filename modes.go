@@ -0,0 +1,105 @@
+package bastion
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	DebugMode      = "debug"
+	ProductionMode = "production"
+	TestMode       = "test"
+)
+
+// ModeConfig holds the defaults of a mode. The LoggerLevel is applied when the LoggerLevel option isn't
+// set. The flags are combined with the matching options, so a feature turned on or off by the mode can't be
+// turned back by the options.
+type ModeConfig struct {
+	// Debug marks a development mode. IsDebug reports true, the request logger doesn't record the IP,
+	// user agent and referer and the server timeouts and limits are the debug mode ones.
+	Debug bool
+	// LoggerLevel default level of the logger. Default "debug" for debug modes, "error" otherwise.
+	LoggerLevel string
+	// DisablePrettyLogging turn off the colored human readable logs. Always on for non debug modes.
+	DisablePrettyLogging bool
+	// EnableProfiler turn on the profiler router.
+	EnableProfiler bool
+	// DisablePingRouter turn off the ping router.
+	DisablePingRouter bool
+	// DisableLoggerMiddleware turn off the logger middleware.
+	DisableLoggerMiddleware bool
+	// DisableRecoveryMiddleware turn off the recovery middleware.
+	DisableRecoveryMiddleware bool
+	// DisableInternalErrorMiddleware turn off the internal error middleware.
+	DisableInternalErrorMiddleware bool
+	// AdminOnlyMetrics serve the metrics route only on the admin listener, they aren't served without it.
+	AdminOnlyMetrics bool
+}
+
+var modes = struct {
+	sync.RWMutex
+	configs map[string]ModeConfig
+}{
+	configs: map[string]ModeConfig{
+		DebugMode: {
+			Debug:          true,
+			LoggerLevel:    DebugLevel,
+			EnableProfiler: true,
+		},
+		ProductionMode: {
+			LoggerLevel:          ErrorLevel,
+			DisablePrettyLogging: true,
+		},
+		TestMode: {
+			Debug:       true,
+			LoggerLevel: ErrorLevel,
+		},
+	},
+}
+
+// RegisterMode defines a mode with its defaults, it can be selected with the Mode option or the GO_ENV
+// and GO_ENVIRONMENT env vars like the built-in "debug", "production" and "test" modes. It panics if the
+// name is empty or already registered, or the logger level is unknown.
+func RegisterMode(name string, cfg ModeConfig) {
+	if name == "" {
+		panic("bastion mode name can't be empty")
+	}
+	if cfg.LoggerLevel != "" {
+		if _, err := findLvl(cfg.LoggerLevel); err != nil {
+			panic(err.Error())
+		}
+	}
+	modes.Lock()
+	defer modes.Unlock()
+	if _, ok := modes.configs[name]; ok {
+		panic("bastion mode already registered: " + name)
+	}
+	modes.configs[name] = cfg
+}
+
+// unregisterMode removes the mode, the built-in ones included.
+func unregisterMode(name string) {
+	modes.Lock()
+	defer modes.Unlock()
+	delete(modes.configs, name)
+}
+
+func resolveMode(opts *Options) string {
+	modeEnv := defaultString(os.Getenv("GO_ENV"), "")
+	if modeEnv == "" {
+		modeEnv = defaultString(os.Getenv("GO_ENVIRONMENT"), "")
+	}
+	return defaultString(defaultString(opts.Mode, modeEnv), DebugMode)
+}
+
+// findMode returns the config of the mode, or the debug one along with an error when it's unknown.
+func findMode(value string) (ModeConfig, error) {
+	modes.RLock()
+	defer modes.RUnlock()
+	cfg, ok := modes.configs[value]
+	if !ok {
+		return modes.configs[DebugMode], fmt.Errorf("bastion mode unknown: %v", value)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,47 @@
+package bastion
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ifreddyrondon/bastion/openapi"
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+// OpenAPIDocument returns the OpenAPI document of the app routes, the operational routes are not included.
+// The handlers are annotated with openapi.Describe. The error responses are documented with the body of
+// the ErrorRenderer.
+func (app *Bastion) OpenAPIDocument() (*openapi.Document, error) {
+	return openapi.Generate(app.Mux, app.OpenAPIInfo, errorBody(app.ErrorRenderer))
+}
+
+// errorBody returns the media type and body of the errors rendered by the renderer.
+func errorBody(renderer render.APIRenderer) openapi.GenerateOpt {
+	switch r := renderer.(type) {
+	case *render.ProblemRenderer:
+		return openapi.ErrorBody(r.MediaType(), render.Problem{})
+	case *render.XMLRenderer:
+		return openapi.ErrorBody("application/xml", render.HTTPError{})
+	}
+	return openapi.ErrorBody("application/json", render.HTTPError{})
+}
+
+func (app *Bastion) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	doc, err := app.OpenAPIDocument()
+	if err != nil {
+		render.JSON.InternalServerError(w, err)
+		return
+	}
+
+	contentType, encode := "application/json", doc.JSON
+	if strings.HasSuffix(r.URL.Path, ".yaml") {
+		contentType, encode = "application/yaml", doc.YAML
+	}
+	b, err := encode()
+	if err != nil {
+		render.JSON.InternalServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(b)
+}
@@ -0,0 +1,587 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	componentsPrefix  = "#/components/schemas/"
+	definitionsPrefix = "#/definitions/"
+)
+
+var httpMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Mismatch is a difference between an exchanged request or response and the document.
+type Mismatch struct {
+	// In is where the mismatch was found: "route", "path", "query", "header", "request body",
+	// "response status" or "response body".
+	In string
+	// Pointer locates the mismatch, the parameter name or the JSON pointer of the offending value in
+	// the body, ie. "/items/0/id". Empty for the whole body.
+	Pointer string
+	// Message describes the mismatch.
+	Message string
+}
+
+func (m Mismatch) String() string {
+	if m.Pointer == "" {
+		return fmt.Sprintf("%v: %v", m.In, m.Message)
+	}
+	return fmt.Sprintf("%v %v: %v", m.In, m.Pointer, m.Message)
+}
+
+// ContractError is returned when a request or response doesn't honor the document.
+type ContractError struct {
+	// Method of the request.
+	Method string
+	// Path of the document matched by the request, or the request path when there is none.
+	Path string
+	// Mismatches found.
+	Mismatches []Mismatch
+}
+
+func (e *ContractError) Error() string {
+	lines := make([]string, len(e.Mismatches))
+	for i, m := range e.Mismatches {
+		lines[i] = "  - " + m.String()
+	}
+	return fmt.Sprintf("%v %v doesn't honor the openapi document:\n%v", e.Method, e.Path, strings.Join(lines, "\n"))
+}
+
+// Contract validates requests and responses against an OpenAPI 3 document. The bodies are validated
+// with their JSON schemas, the schemas of the components can be referenced with "#/components/schemas/".
+type Contract struct {
+	routes []*contractRoute
+}
+
+type contractRoute struct {
+	path       string
+	re         *regexp.Regexp
+	params     []string
+	operations map[string]*contractOperation
+}
+
+type contractOperation struct {
+	params      []*contractParam
+	requestBody *contractBody
+	responses   map[string]*contractBody
+}
+
+type contractParam struct {
+	name     string
+	in       string
+	required bool
+	schema   *contractSchema
+}
+
+type contractBody struct {
+	required bool
+	content  map[string]*contractSchema
+}
+
+type contractSchema struct {
+	// def is the JSON schema, used to coerce the params to the expected type.
+	def    map[string]interface{}
+	schema *gojsonschema.Schema
+}
+
+// raw types of the document, the schemas are kept as generic values to be compiled with gojsonschema.
+type (
+	rawDocument struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	rawOperation struct {
+		Parameters  []rawParameter         `json:"parameters"`
+		RequestBody *rawBody               `json:"requestBody"`
+		Responses   map[string]rawResponse `json:"responses"`
+	}
+	rawParameter struct {
+		Name     string      `json:"name"`
+		In       string      `json:"in"`
+		Required bool        `json:"required"`
+		Schema   interface{} `json:"schema"`
+	}
+	rawBody struct {
+		Required bool                    `json:"required"`
+		Content  map[string]rawMediaType `json:"content"`
+	}
+	rawResponse struct {
+		Content map[string]rawMediaType `json:"content"`
+	}
+	rawMediaType struct {
+		Schema interface{} `json:"schema"`
+	}
+)
+
+// LoadContract reads the OpenAPI document in JSON or YAML from the file and returns its contract.
+func LoadContract(path string) (*Contract, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading openapi document")
+	}
+	return NewContract(b)
+}
+
+// NewContract returns the contract of the OpenAPI document in JSON or YAML.
+func NewContract(doc []byte) (*Contract, error) {
+	// JSON is valid YAML, both are decoded with the YAML decoder and converted to JSON values
+	var v interface{}
+	if err := yaml.Unmarshal(doc, &v); err != nil {
+		return nil, errors.Wrap(err, "decoding openapi document")
+	}
+	b, err := json.Marshal(jsonValue(v))
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding openapi document")
+	}
+	var raw rawDocument
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, errors.Wrap(err, "decoding openapi document")
+	}
+
+	c := &contractCompiler{definitions: make(map[string]interface{})}
+	for name, s := range raw.Components.Schemas {
+		c.definitions[name] = convertSchema(s)
+	}
+
+	contract := &Contract{}
+	for path, item := range raw.Paths {
+		route, err := c.route(path, item)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compiling path %v", path)
+		}
+		contract.routes = append(contract.routes, route)
+	}
+	// the literal segments take precedence over the params, ie. /todos/new over /todos/{id}
+	sort.Slice(contract.routes, func(i, j int) bool {
+		pi, pj := strings.Count(contract.routes[i].path, "{"), strings.Count(contract.routes[j].path, "{")
+		if pi != pj {
+			return pi < pj
+		}
+		return contract.routes[i].path < contract.routes[j].path
+	})
+	return contract, nil
+}
+
+type contractCompiler struct {
+	definitions map[string]interface{}
+}
+
+func (c *contractCompiler) route(path string, item map[string]json.RawMessage) (*contractRoute, error) {
+	re, params := pathRegexp(path)
+	route := &contractRoute{path: path, re: re, params: params, operations: make(map[string]*contractOperation)}
+	var common []rawParameter
+	if b, ok := item["parameters"]; ok {
+		if err := json.Unmarshal(b, &common); err != nil {
+			return nil, errors.Wrap(err, "decoding parameters")
+		}
+	}
+	for _, method := range httpMethods {
+		b, ok := item[method]
+		if !ok {
+			continue
+		}
+		var raw rawOperation
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return nil, errors.Wrapf(err, "decoding %v operation", method)
+		}
+		op, err := c.operation(common, raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compiling %v operation", method)
+		}
+		route.operations[strings.ToUpper(method)] = op
+	}
+	return route, nil
+}
+
+func (c *contractCompiler) operation(common []rawParameter, raw rawOperation) (*contractOperation, error) {
+	op := &contractOperation{responses: make(map[string]*contractBody)}
+	// the operation params override the path item params with the same name and location
+	params := make(map[string]rawParameter)
+	var keys []string
+	for _, p := range append(common, raw.Parameters...) {
+		key := p.In + " " + p.Name
+		if _, ok := params[key]; !ok {
+			keys = append(keys, key)
+		}
+		params[key] = p
+	}
+	for _, key := range keys {
+		p := params[key]
+		schema, err := c.schema(p.Schema)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compiling param %v", p.Name)
+		}
+		op.params = append(op.params, &contractParam{name: p.Name, in: p.In, required: p.Required, schema: schema})
+	}
+
+	if raw.RequestBody != nil {
+		body, err := c.body(raw.RequestBody.Content)
+		if err != nil {
+			return nil, errors.Wrap(err, "compiling request body")
+		}
+		body.required = raw.RequestBody.Required
+		op.requestBody = body
+	}
+	for status, res := range raw.Responses {
+		body, err := c.body(res.Content)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compiling response %v", status)
+		}
+		op.responses[strings.ToUpper(status)] = body
+	}
+	return op, nil
+}
+
+func (c *contractCompiler) body(content map[string]rawMediaType) (*contractBody, error) {
+	body := &contractBody{content: make(map[string]*contractSchema)}
+	for mediaType, m := range content {
+		schema, err := c.schema(m.Schema)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compiling %v schema", mediaType)
+		}
+		body.content[mediaType] = schema
+	}
+	return body, nil
+}
+
+// schema compiles the schema along with the components, nil schemas accept any value.
+func (c *contractCompiler) schema(s interface{}) (*contractSchema, error) {
+	if s == nil {
+		return nil, nil
+	}
+	def, _ := convertSchema(s).(map[string]interface{})
+	root := map[string]interface{}{"definitions": c.definitions, "allOf": []interface{}{def}}
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(root))
+	if err != nil {
+		return nil, err
+	}
+	return &contractSchema{def: c.resolve(def), schema: schema}, nil
+}
+
+// resolve follows the references of the schema.
+func (c *contractCompiler) resolve(def map[string]interface{}) map[string]interface{} {
+	for i := 0; def != nil && i < 8; i++ {
+		ref, ok := def["$ref"].(string)
+		if !ok {
+			break
+		}
+		def, _ = c.definitions[strings.TrimPrefix(ref, definitionsPrefix)].(map[string]interface{})
+	}
+	return def
+}
+
+// convertSchema converts an OpenAPI schema into a JSON schema. The component references are pointed to the
+// definitions, nullable is converted into a null type and the formats unknown by gojsonschema are removed.
+func convertSchema(s interface{}) interface{} {
+	switch v := s.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[key] = convertSchema(value)
+		}
+		if ref, ok := out["$ref"].(string); ok && strings.HasPrefix(ref, componentsPrefix) {
+			out["$ref"] = definitionsPrefix + strings.TrimPrefix(ref, componentsPrefix)
+		}
+		if format, ok := out["format"].(string); ok && !gojsonschema.FormatCheckers.Has(format) {
+			delete(out, "format")
+		}
+		nullable, _ := out["nullable"].(bool)
+		delete(out, "nullable")
+		if !nullable {
+			return out
+		}
+		if t, ok := out["type"].(string); ok {
+			out["type"] = []interface{}{t, "null"}
+			return out
+		}
+		if len(out) == 0 {
+			return out
+		}
+		// the schemas without type, ie. allOf a reference, accept null as an alternative
+		return map[string]interface{}{"anyOf": []interface{}{out, map[string]interface{}{"type": "null"}}}
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = convertSchema(value)
+		}
+		return out
+	}
+	return s
+}
+
+// jsonValue converts the maps decoded by the YAML decoder into JSON objects.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = jsonValue(value)
+		}
+		return out
+	}
+	return v
+}
+
+// pathRegexp returns the regexp matching the path template and the names of the params in the order
+// they are captured. A trailing slash is optional like in the chi sub routers.
+func pathRegexp(path string) (*regexp.Regexp, []string) {
+	var params []string
+	var expr strings.Builder
+	expr.WriteString("^")
+	rest := strings.TrimSuffix(path, "/")
+	for {
+		start := strings.Index(rest, "{")
+		end := strings.Index(rest, "}")
+		if start == -1 || end < start {
+			break
+		}
+		expr.WriteString(regexp.QuoteMeta(rest[:start]))
+		expr.WriteString("([^/]+)")
+		params = append(params, rest[start+1:end])
+		rest = rest[end+1:]
+	}
+	expr.WriteString(regexp.QuoteMeta(rest))
+	expr.WriteString("/?$")
+	return regexp.MustCompile(expr.String()), params
+}
+
+// Validate checks that the request and its response honor the document. The route, path, query and header
+// params, request body and response status and body are validated. The bodies are read and restored.
+// It returns a *ContractError with the mismatches found.
+func (c *Contract) Validate(r *http.Request, res *http.Response) error {
+	cerr := &ContractError{Method: r.Method, Path: r.URL.Path}
+	route, values := c.match(r.URL.Path)
+	if route == nil {
+		cerr.Mismatches = append(cerr.Mismatches, Mismatch{In: "route", Message: "path not found in the document"})
+		return cerr
+	}
+	cerr.Path = route.path
+	op, ok := route.operations[r.Method]
+	if !ok {
+		cerr.Mismatches = append(cerr.Mismatches, Mismatch{In: "route", Message: "method not found in the document"})
+		return cerr
+	}
+
+	reqBody, err := readBody(&r.Body)
+	if err != nil {
+		return errors.Wrap(err, "reading request body")
+	}
+	resBody, err := readBody(&res.Body)
+	if err != nil {
+		return errors.Wrap(err, "reading response body")
+	}
+
+	cerr.Mismatches = append(cerr.Mismatches, op.validateParams(r, values)...)
+	cerr.Mismatches = append(cerr.Mismatches, op.validateRequestBody(r.Header.Get("Content-Type"), reqBody)...)
+	cerr.Mismatches = append(cerr.Mismatches, op.validateResponse(res, resBody)...)
+	if len(cerr.Mismatches) > 0 {
+		return cerr
+	}
+	return nil
+}
+
+// match returns the route matching the path and the values of its params.
+func (c *Contract) match(path string) (*contractRoute, map[string]string) {
+	for _, route := range c.routes {
+		m := route.re.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		values := make(map[string]string, len(route.params))
+		for i, name := range route.params {
+			values[name] = m[i+1]
+			if unescaped, err := url.PathUnescape(m[i+1]); err == nil {
+				values[name] = unescaped
+			}
+		}
+		return route, values
+	}
+	return nil, nil
+}
+
+func (op *contractOperation) validateParams(r *http.Request, values map[string]string) []Mismatch {
+	var mismatches []Mismatch
+	for _, p := range op.params {
+		var value string
+		var present bool
+		switch p.in {
+		case "path":
+			value, present = values[p.name]
+		case "query":
+			var vs []string
+			vs, present = r.URL.Query()[p.name]
+			value = strings.Join(vs, ",")
+		case "header":
+			value = r.Header.Get(p.name)
+			present = value != ""
+		default:
+			continue
+		}
+
+		if !present {
+			if p.required {
+				mismatches = append(mismatches, Mismatch{In: p.in, Pointer: p.name, Message: "required param is missing"})
+			}
+			continue
+		}
+		if p.schema == nil {
+			continue
+		}
+		for _, msg := range p.schema.validate(gojsonschema.NewGoLoader(coerce(value, p.schema.def))) {
+			msg.In, msg.Pointer = p.in, p.name
+			msg.Message = strings.Replace(msg.Message, gojsonschema.STRING_CONTEXT_ROOT, p.name, 1)
+			mismatches = append(mismatches, msg)
+		}
+	}
+	return mismatches
+}
+
+func (op *contractOperation) validateRequestBody(contentType string, body []byte) []Mismatch {
+	if op.requestBody == nil {
+		if len(body) > 0 {
+			return []Mismatch{{In: "request body", Message: "body not found in the document"}}
+		}
+		return nil
+	}
+	if len(body) == 0 {
+		if op.requestBody.required {
+			return []Mismatch{{In: "request body", Message: "required body is missing"}}
+		}
+		return nil
+	}
+	return validateBody("request body", op.requestBody, contentType, body)
+}
+
+func (op *contractOperation) validateResponse(res *http.Response, body []byte) []Mismatch {
+	status := strconv.Itoa(res.StatusCode)
+	expected, ok := op.responses[status]
+	if !ok {
+		expected, ok = op.responses[status[:1]+"XX"]
+	}
+	if !ok {
+		expected, ok = op.responses["DEFAULT"]
+	}
+	if !ok {
+		return []Mismatch{{In: "response status", Message: fmt.Sprintf("status %v not found in the document", status)}}
+	}
+	if len(expected.content) == 0 {
+		if len(body) > 0 {
+			return []Mismatch{{In: "response body", Message: "body not found in the document"}}
+		}
+		return nil
+	}
+	return validateBody("response body", expected, res.Header.Get("Content-Type"), body)
+}
+
+func validateBody(in string, expected *contractBody, contentType string, body []byte) []Mismatch {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return []Mismatch{{In: in, Message: fmt.Sprintf("invalid content type %q", contentType)}}
+	}
+	schema, ok := expected.content[mediaType]
+	if !ok {
+		schema, ok = expected.content[strings.SplitN(mediaType, "/", 2)[0]+"/*"]
+	}
+	if !ok {
+		schema, ok = expected.content["*/*"]
+	}
+	if !ok {
+		return []Mismatch{{In: in, Message: fmt.Sprintf("content type %v not found in the document", mediaType)}}
+	}
+	if schema == nil || !isJSON(mediaType) {
+		return nil
+	}
+	mismatches := schema.validate(gojsonschema.NewBytesLoader(body))
+	for i := range mismatches {
+		mismatches[i].In = in
+	}
+	return mismatches
+}
+
+// validate returns a mismatch for each error with the JSON pointer of the offending value.
+func (s *contractSchema) validate(value gojsonschema.JSONLoader) []Mismatch {
+	result, err := s.schema.Validate(value)
+	if err != nil {
+		return []Mismatch{{Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	var mismatches []Mismatch
+	for _, e := range result.Errors() {
+		// the errors of the allOf wrapping the schema are already reported by its members
+		if e.Type() == "number_all_of" {
+			continue
+		}
+		pointer := strings.TrimPrefix(e.Context().String("/"), gojsonschema.STRING_CONTEXT_ROOT)
+		mismatches = append(mismatches, Mismatch{Pointer: pointer, Message: e.Description()})
+	}
+	return mismatches
+}
+
+// coerce converts the string value of a param to the type of its schema, the values that can't be
+// converted are kept as strings to be reported by the schema validation.
+func coerce(value string, def map[string]interface{}) interface{} {
+	t, _ := def["type"].(string)
+	if types, ok := def["type"].([]interface{}); ok && len(types) > 0 {
+		t, _ = types[0].(string)
+	}
+	switch t {
+	case "integer":
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case "array":
+		items, _ := def["items"].(map[string]interface{})
+		var out []interface{}
+		for _, v := range strings.Split(value, ",") {
+			out = append(out, coerce(v, items))
+		}
+		return out
+	}
+	return value
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == jsonContentType || strings.HasSuffix(mediaType, "+json")
+}
+
+// readBody reads the body and replaces it with a copy to be read again.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	b, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	*body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, err
+}
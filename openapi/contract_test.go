@@ -0,0 +1,265 @@
+package openapi_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ifreddyrondon/bastion/openapi"
+)
+
+const contractDoc = `
+openapi: 3.0.3
+info:
+  title: todos
+  version: 1.0.0
+paths:
+  /todos:
+    get:
+      parameters:
+        - name: limit
+          in: query
+          schema: {type: integer, minimum: 0, maximum: 50}
+        - name: X-Tenant
+          in: header
+          required: true
+          schema: {type: string}
+      responses:
+        200:
+          description: OK
+          content:
+            application/json:
+              schema:
+                type: array
+                items: {$ref: '#/components/schemas/todo'}
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/todo'}
+      responses:
+        201:
+          description: Created
+          content:
+            application/json:
+              schema: {$ref: '#/components/schemas/todo'}
+        4XX:
+          description: Error
+          content:
+            application/json:
+              schema: {type: object}
+  /todos/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema: {type: integer, format: int64}
+    delete:
+      responses:
+        204: {description: No Content}
+  /todos/done:
+    delete:
+      responses:
+        204: {description: No Content}
+components:
+  schemas:
+    todo:
+      type: object
+      required: [id, description]
+      properties:
+        id: {type: integer, format: int64}
+        description: {type: string}
+        due: {type: string, format: date-time, nullable: true}
+`
+
+func validate(c *openapi.Contract, method, target, reqBody string, status int, resBody string) error {
+	req := httptest.NewRequest(method, target, strings.NewReader(reqBody))
+	if reqBody != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Tenant", "acme")
+	res := &http.Response{StatusCode: status, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(resBody))}
+	if resBody != "" {
+		res.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	return c.Validate(req, res)
+}
+
+func TestContractValid(t *testing.T) {
+	t.Parallel()
+
+	c, err := openapi.NewContract([]byte(contractDoc))
+	require.Nil(t, err)
+
+	tt := []struct {
+		name                 string
+		method, target, body string
+		status               int
+		response             string
+	}{
+		{"list", http.MethodGet, "/todos?limit=10", "", 200, `[{"id":1,"description":"a","due":null}]`},
+		{"create", http.MethodPost, "/todos", `{"id":1,"description":"a"}`, 201, `{"id":1,"description":"a","due":"2019-05-01T10:00:00Z"}`},
+		{"range status", http.MethodPost, "/todos", `{"id":1,"description":"a"}`, 422, `{"message":"invalid"}`},
+		{"path param", http.MethodDelete, "/todos/1", "", 204, ""},
+		{"literal over param", http.MethodDelete, "/todos/done/", "", 204, ""},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Nil(t, validate(c, tc.method, tc.target, tc.body, tc.status, tc.response))
+		})
+	}
+}
+
+func TestContractMismatches(t *testing.T) {
+	t.Parallel()
+
+	c, err := openapi.NewContract([]byte(contractDoc))
+	require.Nil(t, err)
+
+	tt := []struct {
+		name                 string
+		method, target, body string
+		status               int
+		response             string
+		expected             string
+	}{
+		{
+			"unknown path",
+			http.MethodGet, "/users", "", 200, "",
+			"GET /users doesn't honor the openapi document:\n  - route: path not found in the document",
+		},
+		{
+			"unknown method",
+			http.MethodPut, "/todos", "", 200, "",
+			"PUT /todos doesn't honor the openapi document:\n  - route: method not found in the document",
+		},
+		{
+			"query param",
+			http.MethodGet, "/todos?limit=100", "", 200, `[]`,
+			"GET /todos doesn't honor the openapi document:\n  - query limit: Must be less than or equal to 50",
+		},
+		{
+			"path param",
+			http.MethodDelete, "/todos/abc", "", 204, "",
+			"DELETE /todos/{id} doesn't honor the openapi document:\n  - path id: Invalid type. Expected: integer, given: string",
+		},
+		{
+			"request body",
+			http.MethodPost, "/todos", `{"id":"1"}`, 201, `{"id":1,"description":"a"}`,
+			"POST /todos doesn't honor the openapi document:\n  - request body: description is required\n  - request body /id: Invalid type. Expected: integer, given: string",
+		},
+		{
+			"missing request body",
+			http.MethodPost, "/todos", "", 201, `{"id":1,"description":"a"}`,
+			"POST /todos doesn't honor the openapi document:\n  - request body: required body is missing",
+		},
+		{
+			"response status",
+			http.MethodDelete, "/todos/1", "", 500, "",
+			"DELETE /todos/{id} doesn't honor the openapi document:\n  - response status: status 500 not found in the document",
+		},
+		{
+			"response body",
+			http.MethodGet, "/todos", "", 200, `[{"id":1,"description":"a"},{"id":2,"description":false}]`,
+			"GET /todos doesn't honor the openapi document:\n  - response body /1/description: Invalid type. Expected: string, given: boolean",
+		},
+		{
+			"undocumented response body",
+			http.MethodDelete, "/todos/1", "", 204, `{}`,
+			"DELETE /todos/{id} doesn't honor the openapi document:\n  - response body: body not found in the document",
+		},
+		{
+			"invalid json",
+			http.MethodGet, "/todos", "", 200, `[{`,
+			"GET /todos doesn't honor the openapi document:\n  - response body: invalid JSON: unexpected EOF",
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := validate(c, tc.method, tc.target, tc.body, tc.status, tc.response)
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestContractMissingHeader(t *testing.T) {
+	t.Parallel()
+
+	c, err := openapi.NewContract([]byte(contractDoc))
+	require.Nil(t, err)
+	req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+	res := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"text/plain"}}, Body: ioutil.NopCloser(strings.NewReader("[]"))}
+	err = c.Validate(req, res)
+	if assert.IsType(t, &openapi.ContractError{}, err) {
+		cerr := err.(*openapi.ContractError)
+		assert.Equal(t, []openapi.Mismatch{
+			{In: "header", Pointer: "X-Tenant", Message: "required param is missing"},
+			{In: "response body", Message: "content type text/plain not found in the document"},
+		}, cerr.Mismatches)
+	}
+}
+
+func TestContractFromGeneratedDocument(t *testing.T) {
+	t.Parallel()
+
+	doc, err := openapi.Generate(router(), openapi.Info{Title: "todos", Version: "1.0.0"})
+	require.Nil(t, err)
+	b, err := doc.JSON()
+	require.Nil(t, err)
+	c, err := openapi.NewContract(b)
+	require.Nil(t, err)
+
+	assert.Nil(t, validate(c, http.MethodGet, "/todos?sort=oldest&done=true", "", 200, `[{"id":1,"created_at":"2019-05-01T10:00:00Z","description":"a"}]`))
+	assert.EqualError(t,
+		validate(c, http.MethodGet, "/todos?sort=random", "", 200, `[]`),
+		"GET /todos doesn't honor the openapi document:\n  - query sort: sort must be one of the following: \"newest\", \"oldest\"",
+	)
+}
+
+type note struct {
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+	Owner *user    `json:"owner"`
+}
+
+func TestContractNullableFieldsRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	r := chi.NewRouter()
+	r.Method(http.MethodGet, "/notes", openapi.Describe(noop, openapi.Operation{
+		Responses: map[int]interface{}{http.StatusOK: note{}},
+	}))
+	doc, err := openapi.Generate(r, openapi.Info{Title: "notes", Version: "1.0.0"})
+	require.Nil(t, err)
+	b, err := doc.JSON()
+	require.Nil(t, err)
+	c, err := openapi.NewContract(b)
+	require.Nil(t, err)
+
+	assert.Nil(t, validate(c, http.MethodGet, "/notes", "", 200, `{"title":"a","tags":null,"owner":null}`))
+	assert.Nil(t, validate(c, http.MethodGet, "/notes", "", 200, `{"title":"a","tags":["x"],"owner":{"name":"b"}}`))
+	assert.Nil(t, validate(c, http.MethodGet, "/notes", "", 200, `{"title":"a"}`))
+	assert.Error(t, validate(c, http.MethodGet, "/notes", "", 200, `{"title":"a","tags":null,"owner":"b"}`))
+}
+
+func TestLoadContractErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := openapi.LoadContract("testdata/missing.yaml")
+	assert.Contains(t, err.Error(), "reading openapi document")
+	_, err = openapi.NewContract([]byte("paths: ["))
+	assert.Contains(t, err.Error(), "decoding openapi document")
+}
@@ -0,0 +1,264 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"github.com/ifreddyrondon/bastion/middleware/listing"
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+const jsonContentType = "application/json"
+
+var paramRE = regexp.MustCompile(`\{([^}:]+)(?::([^}]+))?\}`)
+
+// Operation is the metadata of a route used to describe it in the OpenAPI document.
+type Operation struct {
+	// OperationID unique string used to identify the operation.
+	OperationID string
+	// Summary short summary of what the operation does.
+	Summary string
+	// Description verbose explanation of the operation behavior.
+	Description string
+	// Tags used to group the operations.
+	Tags []string
+	// Deprecated marks the operation as deprecated.
+	Deprecated bool
+	// Request is a value of the type of the request body, ie. Todo{}. Nil means the operation has no body.
+	Request interface{}
+	// Responses maps the status codes to a value of the type of the response body. A nil value means
+	// no body for the 1xx, 2xx and 3xx status codes and the ErrorBody, default render.HTTPError, for the
+	// error status codes. Default a 200 response without body.
+	Responses map[int]interface{}
+}
+
+// Describe annotates the handler with the operation metadata. Register the returned handler with the
+// Method or Handle functions of the router, ie. r.Method(http.MethodGet, "/{id}", openapi.Describe(h, op))
+func Describe(h http.HandlerFunc, op Operation) http.Handler {
+	return &describedHandler{HandlerFunc: h, op: op}
+}
+
+type describedHandler struct {
+	http.HandlerFunc
+	op Operation
+}
+
+// listingDescriber is implemented by the handlers returned by the middleware.Listing middleware.
+type listingDescriber interface {
+	ListingDefaults() (listing.Listing, error)
+}
+
+// GenerateOpt helper type to create functional options for Generate.
+type GenerateOpt func(*generator)
+
+// ErrorBody set the media type and the body of the error responses documented without body, ie.
+// "application/problem+json" and render.Problem{} for the render.ProblemJSON errors. Default
+// "application/json" and render.HTTPError{}.
+func ErrorBody(mediaType string, body interface{}) GenerateOpt {
+	return func(g *generator) {
+		g.errMediaType = mediaType
+		g.errBody = body
+	}
+}
+
+// Generate walks the routes and returns the OpenAPI document describing them. The routes with a
+// wildcard, ie. mounted file servers, are skipped.
+func Generate(routes chi.Routes, info Info, opts ...GenerateOpt) (*Document, error) {
+	g := &generator{schemas: newSchemas(), errMediaType: jsonContentType, errBody: render.HTTPError{}}
+	for _, opt := range opts {
+		opt(g)
+	}
+	doc := &Document{OpenAPI: Version, Info: info, Paths: make(map[string]*PathItem)}
+
+	walkFn := func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = strings.Replace(route, "/*/", "/", -1)
+		if strings.Contains(route, "*") {
+			return nil
+		}
+		p, params := pathParams(route)
+		op, err := g.operation(handler, params, middlewares)
+		if err != nil {
+			return errors.Wrapf(err, "describing %v %v", method, route)
+		}
+		item, ok := doc.Paths[p]
+		if !ok {
+			item = &PathItem{}
+			doc.Paths[p] = item
+		}
+		(*item)[strings.ToLower(method)] = op
+		return nil
+	}
+	if err := chi.Walk(routes, walkFn); err != nil {
+		return nil, err
+	}
+
+	if len(g.schemas.components) > 0 {
+		doc.Components = &Components{Schemas: g.schemas.components}
+	}
+	return doc, nil
+}
+
+type generator struct {
+	schemas      *schemas
+	errMediaType string
+	errBody      interface{}
+}
+
+func (g *generator) operation(handler http.Handler, params []*Parameter, middlewares []func(http.Handler) http.Handler) (*OperationObject, error) {
+	var op Operation
+	if d, ok := handler.(*describedHandler); ok {
+		op = d.op
+	}
+	obj := &OperationObject{
+		OperationID: op.OperationID,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Deprecated:  op.Deprecated,
+		Parameters:  params,
+		Responses:   make(map[string]*Response),
+	}
+
+	if op.Request != nil {
+		schema, err := g.schemas.of(op.Request)
+		if err != nil {
+			return nil, err
+		}
+		obj.RequestBody = &RequestBody{Required: true, Content: content(jsonContentType, schema)}
+	}
+
+	responses := op.Responses
+	if len(responses) == 0 {
+		responses = map[int]interface{}{http.StatusOK: nil}
+	}
+	for status, body := range responses {
+		res, err := g.response(status, body)
+		if err != nil {
+			return nil, err
+		}
+		obj.Responses[strconv.Itoa(status)] = res
+	}
+
+	listingParams, err := g.listing(middlewares)
+	if err != nil {
+		return nil, err
+	}
+	if listingParams != nil {
+		obj.Parameters = append(obj.Parameters, listingParams...)
+		if _, ok := obj.Responses[strconv.Itoa(http.StatusBadRequest)]; !ok {
+			res, err := g.response(http.StatusBadRequest, nil)
+			if err != nil {
+				return nil, err
+			}
+			obj.Responses[strconv.Itoa(http.StatusBadRequest)] = res
+		}
+	}
+	return obj, nil
+}
+
+func (g *generator) response(status int, body interface{}) (*Response, error) {
+	res := &Response{Description: http.StatusText(status)}
+	if res.Description == "" {
+		res.Description = strconv.Itoa(status)
+	}
+	mediaType := jsonContentType
+	if body == nil && status >= http.StatusBadRequest {
+		mediaType, body = g.errMediaType, g.errBody
+	}
+	if body == nil {
+		return res, nil
+	}
+	schema, err := g.schemas.of(body)
+	if err != nil {
+		return nil, err
+	}
+	res.Content = content(mediaType, schema)
+	return res, nil
+}
+
+// listing returns the query params of the listing middleware of the route, or nil if there is none.
+func (g *generator) listing(middlewares []func(http.Handler) http.Handler) ([]*Parameter, error) {
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	for _, mw := range middlewares {
+		d, ok := mw(noop).(listingDescriber)
+		if !ok {
+			continue
+		}
+		l, err := d.ListingDefaults()
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding listing defaults")
+		}
+		return listingParams(l), nil
+	}
+	return nil, nil
+}
+
+func listingParams(l listing.Listing) []*Parameter {
+	zero, max := float64(0), float64(l.Paging.MaxAllowedLimit)
+	params := []*Parameter{
+		{
+			Name:        "limit",
+			In:          "query",
+			Description: "Maximum number of items to return.",
+			Schema:      &Schema{Type: "integer", Default: l.Paging.Limit, Minimum: &zero, Maximum: &max},
+		},
+		{
+			Name:        "offset",
+			In:          "query",
+			Description: "Number of items to skip.",
+			Schema:      &Schema{Type: "integer", Default: l.Paging.Offset, Minimum: &zero},
+		},
+	}
+
+	if l.Sorting != nil && len(l.Sorting.Available) > 0 {
+		schema := &Schema{Type: "string"}
+		desc := make([]string, len(l.Sorting.Available))
+		for i, s := range l.Sorting.Available {
+			schema.Enum = append(schema.Enum, s.ID)
+			desc[i] = fmt.Sprintf("`%s`: %s", s.ID, s.Description)
+		}
+		if l.Sorting.Sort != nil {
+			schema.Default = l.Sorting.Sort.ID
+		}
+		params = append(params, &Parameter{
+			Name:        "sort",
+			In:          "query",
+			Description: "Sort criteria. " + strings.Join(desc, ", "),
+			Schema:      schema,
+		})
+	}
+
+	if l.Filtering != nil {
+		for _, f := range l.Filtering.Available {
+			schema := &Schema{Type: "string"}
+			for _, v := range f.Values {
+				schema.Enum = append(schema.Enum, v.ID)
+			}
+			params = append(params, &Parameter{Name: f.ID, In: "query", Description: f.Description, Schema: schema})
+		}
+	}
+	return params
+}
+
+// pathParams converts a chi pattern into an OpenAPI path and returns its path params.
+func pathParams(route string) (string, []*Parameter) {
+	var params []*Parameter
+	for _, m := range paramRE.FindAllStringSubmatch(route, -1) {
+		schema := &Schema{Type: "string"}
+		if m[2] != "" {
+			schema.Pattern = m[2]
+		}
+		params = append(params, &Parameter{Name: m[1], In: "path", Required: true, Schema: schema})
+	}
+	return paramRE.ReplaceAllString(route, "{$1}"), params
+}
+
+func content(mediaType string, schema *Schema) map[string]*MediaType {
+	return map[string]*MediaType{mediaType: {Schema: schema}}
+}
@@ -0,0 +1,123 @@
+// Package openapi generates OpenAPI 3 documents from chi routes. The handlers are annotated with Describe,
+// the schemas are derived from the Go types of the request and response bodies and the listing parameters
+// from the middleware.Listing configuration of the route. A Contract validates requests and responses
+// against a document.
+package openapi
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Version of the OpenAPI specification of the generated documents.
+const Version = "3.0.3"
+
+// Document is the root object of an OpenAPI document.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components,omitempty"`
+}
+
+// Info provides metadata about the API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem describes the operations available on a single path by lowercase HTTP method.
+type PathItem map[string]*OperationObject
+
+// OperationObject describes a single API operation on a path.
+type OperationObject struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Deprecated  bool                 `json:"deprecated,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter describes a single operation parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes a single request body.
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+// Response describes a single response from an API operation.
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType provides the schema for a media type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the reusable schemas referenced from the operations.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Schema describes a data type, it's a subset of the OpenAPI Schema Object.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+// JSON returns the indented JSON encoding of the document.
+func (d *Document) JSON() ([]byte, error) {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding openapi document to json")
+	}
+	return b, nil
+}
+
+// YAML returns the YAML encoding of the document keeping the order of the JSON encoding.
+func (d *Document) YAML() ([]byte, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding openapi document to json")
+	}
+	// JSON is valid YAML, decoding it into a MapSlice keeps the keys order
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, errors.Wrap(err, "decoding openapi document")
+	}
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding openapi document to yaml")
+	}
+	return out, nil
+}
@@ -0,0 +1,203 @@
+package openapi_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ifreddyrondon/bastion/middleware"
+	"github.com/ifreddyrondon/bastion/middleware/listing/filtering"
+	"github.com/ifreddyrondon/bastion/middleware/listing/sorting"
+	"github.com/ifreddyrondon/bastion/openapi"
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+type base struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type todo struct {
+	base
+	Description string            `json:"description" description:"what to do"`
+	Done        bool              `json:"done,omitempty"`
+	Owner       *user             `json:"owner,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Subtasks    []todo            `json:"subtasks,omitempty"`
+	internal    string
+	Ignored     string `json:"-"`
+}
+
+type user struct {
+	Name string `json:"name"`
+}
+
+func noop(w http.ResponseWriter, r *http.Request) {}
+
+func router() chi.Router {
+	r := chi.NewRouter()
+	r.With(middleware.Listing(
+		middleware.Limit(20),
+		middleware.MaxAllowedLimit(50),
+		middleware.Sort(sorting.NewSort("newest", "created_at DESC", "Newest first"), sorting.NewSort("oldest", "created_at ASC", "Oldest first")),
+		middleware.Filter(filtering.NewBoolean("done", "filter by done", "done", "pending")),
+	)).Method(http.MethodGet, "/todos", openapi.Describe(noop, openapi.Operation{
+		OperationID: "listTodos",
+		Summary:     "list todos",
+		Tags:        []string{"todos"},
+		Responses:   map[int]interface{}{http.StatusOK: []todo{}},
+	}))
+	r.Method(http.MethodPost, "/todos", openapi.Describe(noop, openapi.Operation{
+		Summary:   "create todo",
+		Request:   todo{},
+		Responses: map[int]interface{}{http.StatusCreated: todo{}, http.StatusUnprocessableEntity: nil},
+	}))
+	r.Route("/todos/{id:[0-9]+}", func(r chi.Router) {
+		r.Delete("/", noop)
+	})
+	r.Mount("/static", http.FileServer(http.Dir(".")))
+	return r
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	doc, err := openapi.Generate(router(), openapi.Info{Title: "todos", Version: "1.0.0"})
+	require.Nil(t, err)
+	b, err := doc.JSON()
+	require.Nil(t, err)
+
+	expected := `{
+  "openapi": "3.0.3",
+  "info": {"title": "todos", "version": "1.0.0"},
+  "paths": {
+    "/todos": {
+      "get": {
+        "operationId": "listTodos",
+        "summary": "list todos",
+        "tags": ["todos"],
+        "parameters": [
+          {"name": "limit", "in": "query", "description": "Maximum number of items to return.", "schema": {"type": "integer", "default": 20, "minimum": 0, "maximum": 50}},
+          {"name": "offset", "in": "query", "description": "Number of items to skip.", "schema": {"type": "integer", "default": 0, "minimum": 0}},
+          {"name": "sort", "in": "query", "description": "Sort criteria. ` + "`newest`: Newest first, `oldest`: Oldest first" + `", "schema": {"type": "string", "enum": ["newest", "oldest"], "default": "newest"}},
+          {"name": "done", "in": "query", "description": "filter by done", "schema": {"type": "string", "enum": ["true", "false"]}}
+        ],
+        "responses": {
+          "200": {"description": "OK", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/todo"}}}}},
+          "400": {"description": "Bad Request", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/HTTPError"}}}}
+        }
+      },
+      "post": {
+        "summary": "create todo",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/todo"}}}},
+        "responses": {
+          "201": {"description": "Created", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/todo"}}}},
+          "422": {"description": "Unprocessable Entity", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/HTTPError"}}}}
+        }
+      }
+    },
+    "/todos/{id}/": {
+      "delete": {
+        "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string", "pattern": "[0-9]+"}}],
+        "responses": {"200": {"description": "OK"}}
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "HTTPError": {
+        "type": "object",
+        "properties": {
+          "error": {"type": "string"},
+          "message": {"type": "string"},
+          "status": {"type": "integer", "format": "int64"},
+          "code": {"type": "string"},
+          "details": {}
+        }
+      },
+      "todo": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "created_at": {"type": "string", "format": "date-time"},
+          "description": {"type": "string", "description": "what to do"},
+          "done": {"type": "boolean"},
+          "owner": {"allOf": [{"$ref": "#/components/schemas/user"}], "nullable": true},
+          "labels": {"type": "object", "additionalProperties": {"type": "string"}, "nullable": true},
+          "subtasks": {"type": "array", "items": {"$ref": "#/components/schemas/todo"}, "nullable": true}
+        },
+        "required": ["id", "created_at", "description"]
+      },
+      "user": {
+        "type": "object",
+        "properties": {"name": {"type": "string"}},
+        "required": ["name"]
+      }
+    }
+  }
+}`
+	assert.JSONEq(t, expected, string(b))
+}
+
+func TestGenerateErrorBody(t *testing.T) {
+	t.Parallel()
+
+	doc, err := openapi.Generate(router(), openapi.Info{Title: "todos", Version: "1.0.0"},
+		openapi.ErrorBody("application/problem+json", render.Problem{}))
+	require.Nil(t, err)
+	res := (*doc.Paths["/todos"])["post"].Responses["422"]
+	assert.Equal(t, map[string]*openapi.MediaType{
+		"application/problem+json": {Schema: &openapi.Schema{Ref: "#/components/schemas/Problem"}},
+	}, res.Content)
+	problem := doc.Components.Schemas["Problem"]
+	assert.Equal(t, "object", problem.Type)
+	assert.Equal(t, &openapi.Schema{Type: "string", Format: "uri-reference"}, problem.Properties["type"])
+	assert.Equal(t, &openapi.Schema{Type: "integer", Format: "int32"}, problem.Properties["status"])
+	// the created response keeps the JSON body
+	assert.Contains(t, (*doc.Paths["/todos"])["post"].Responses["201"].Content, "application/json")
+}
+
+func TestDocumentYAML(t *testing.T) {
+	t.Parallel()
+
+	r := chi.NewRouter()
+	r.Get("/ping", noop)
+	doc, err := openapi.Generate(r, openapi.Info{Title: "ping", Version: "1"})
+	require.Nil(t, err)
+	b, err := doc.YAML()
+	require.Nil(t, err)
+	expected := `openapi: 3.0.3
+info:
+  title: ping
+  version: "1"
+paths:
+  /ping:
+    get:
+      responses:
+        "200":
+          description: OK
+`
+	assert.Equal(t, expected, string(b))
+}
+
+func TestGenerateUnsupportedType(t *testing.T) {
+	t.Parallel()
+
+	r := chi.NewRouter()
+	r.Method(http.MethodPost, "/events", openapi.Describe(noop, openapi.Operation{Request: make(chan int)}))
+	_, err := openapi.Generate(r, openapi.Info{})
+	assert.EqualError(t, err, "describing POST /events: openapi unsupported type chan int")
+}
+
+func TestDescribedHandlerServes(t *testing.T) {
+	t.Parallel()
+
+	called := false
+	h := openapi.Describe(func(w http.ResponseWriter, r *http.Request) { called = true }, openapi.Operation{})
+	h.ServeHTTP(nil, nil)
+	assert.True(t, called)
+}
@@ -0,0 +1,221 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	problemType     = reflect.TypeOf(render.Problem{})
+	rawMessageType  = reflect.TypeOf(json.RawMessage{})
+	unsafeNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+)
+
+// schemas derives the schemas from Go types, the named structs are stored as components and referenced.
+type schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: make(map[string]*Schema), names: make(map[reflect.Type]string)}
+}
+
+// of returns the schema of the type of v.
+func (s *schemas) of(v interface{}) (*Schema, error) {
+	return s.schema(reflect.TypeOf(v))
+}
+
+func (s *schemas) schema(t reflect.Type) (*Schema, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}, nil
+	case rawMessageType:
+		return &Schema{}, nil
+	case problemType:
+		return s.problem(), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}, nil
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}, nil
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}, nil
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}, nil
+		}
+		items, err := s.nullable(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("openapi unsupported map key of type %v", t)
+		}
+		values, err := s.nullable(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: values}, nil
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return s.ref(t)
+	}
+	return nil, fmt.Errorf("openapi unsupported type %v", t)
+}
+
+// nullable returns the schema of a field or an element, marked as nullable when its zero value is encoded as
+// null: the pointers, slices and maps. The siblings of a $ref are ignored, so the references are wrapped in allOf.
+func (s *schemas) nullable(t reflect.Type) (*Schema, error) {
+	schema, err := s.schema(t)
+	if err != nil {
+		return nil, err
+	}
+	if !encodesNull(t) {
+		return schema, nil
+	}
+	if schema.Ref != "" {
+		schema = &Schema{AllOf: []*Schema{schema}}
+	}
+	schema.Nullable = true
+	return schema, nil
+}
+
+func encodesNull(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// ref stores the schema of a named struct as a component and returns a reference to it.
+func (s *schemas) ref(t reflect.Type) (*Schema, error) {
+	name, ok := s.names[t]
+	if !ok {
+		name = s.componentName(t)
+		// reserve the name before building the schema for recursive types
+		s.names[t] = name
+		s.components[name] = nil
+		obj, err := s.object(t)
+		if err != nil {
+			return nil, err
+		}
+		s.components[name] = obj
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}, nil
+}
+
+// problem stores the RFC 7807 problem details schema as a component, render.Problem encodes its standard and
+// extension members in a single object.
+func (s *schemas) problem() *Schema {
+	name, ok := s.names[problemType]
+	if !ok {
+		name = s.componentName(problemType)
+		s.names[problemType] = name
+		s.components[name] = &Schema{Type: "object", Properties: map[string]*Schema{
+			"type":     {Type: "string", Format: "uri-reference"},
+			"title":    {Type: "string"},
+			"status":   {Type: "integer", Format: "int32"},
+			"detail":   {Type: "string"},
+			"instance": {Type: "string", Format: "uri-reference"},
+		}}
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// componentName returns the type name, prefixed with its package when the name is taken by another type.
+func (s *schemas) componentName(t reflect.Type) string {
+	name := unsafeNameChars.ReplaceAllString(t.Name(), "_")
+	if _, taken := s.components[name]; taken {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	return name
+}
+
+func (s *schemas) object(t reflect.Type) (*Schema, error) {
+	obj := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	if err := s.fields(t, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// fields adds the properties of the exported fields following the encoding/json rules.
+func (s *schemas) fields(t reflect.Type, obj *Schema) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			if err := s.fields(ft, obj); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop, err := s.nullable(f.Type)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(opts, "string") && prop.Type != "" && prop.Type != "string" {
+			prop = &Schema{Type: "string"}
+		}
+		// the siblings of a $ref are ignored, the description is only added to inline schemas
+		if desc := f.Tag.Get("description"); desc != "" && prop.Ref == "" {
+			prop.Description = desc
+		}
+		obj.Properties[name] = prop
+		// the nil pointers, slices and maps can be omitted by the clients
+		if !strings.Contains(opts, "omitempty") && !encodesNull(f.Type) {
+			obj.Required = append(obj.Required, name)
+		}
+	}
+	return nil
+}
+
+func parseTag(tag string) (string, string) {
+	if i := strings.Index(tag, ","); i != -1 {
+		return tag[:i], tag[i+1:]
+	}
+	return tag, ""
+}
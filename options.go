@@ -1,11 +1,22 @@
 package bastion
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
+
+	"github.com/ifreddyrondon/bastion/logsink"
+	"github.com/ifreddyrondon/bastion/openapi"
+	"github.com/ifreddyrondon/bastion/redact"
+	"github.com/ifreddyrondon/bastion/render"
+	"github.com/ifreddyrondon/bastion/tracing"
 )
 
 const (
@@ -22,33 +33,50 @@ const (
 )
 
 const (
-	DebugMode      = "debug"
-	ProductionMode = "production"
-)
-
-type codeMode uint8
-
-const (
-	debugCode codeMode = iota
-	productionCode
+	defaultLoggerFileMaxSize     = 100 << 20
+	defaultLoggerAsyncBufferSize = 1024
+	defaultProfilerRoutePrefix   = "/debug"
+	defaultHealthRoutePrefix     = "/health"
+	defaultMetricsRoute          = "/metrics"
 )
 
-func (mode codeMode) String() string {
-	return [...]string{DebugMode, ProductionMode}[mode]
-}
-
-const defaultProfilerRoutePrefix = "/debug"
-
 // Options are used to define how the application should run.
 type Options struct {
 	// InternalErrMsg message returned to the user when catch a 500 status error.
 	InternalErrMsg string
+	// ErrorMapper renders the errors returned by the HandlerFunc handlers. Default DefaultErrorMapper
+	// rendering with the ErrorRenderer and the InternalErrMsg for the unexpected errors.
+	ErrorMapper ErrorMapper
+	// ErrorRenderer renders the errors of the app, the not found and method not allowed responses, the
+	// internal error and recovery middleware responses and the DefaultErrorMapper ones. Default render.JSON,
+	// use render.ProblemJSON or render.ProblemXML for RFC 7807 problem details or render.Negotiate to render
+	// them by the Accept header of the request.
+	ErrorRenderer render.APIRenderer
 	// DisableInternalErrorMiddleware boolean flag to disable the internal error middleware.
 	DisableInternalErrorMiddleware bool
 	// DisableRecoveryMiddleware boolean flag to disable the recovery middleware.
 	DisableRecoveryMiddleware bool
 	// DisablePingRouter boolean flag to disable the ping router.
 	DisablePingRouter bool
+	// DisableHealthRouter boolean flag to disable the liveness and readiness routes.
+	DisableHealthRouter bool
+	// HealthRoutePrefix is an optional path prefix for the health subrouter. If left unspecified, `/health`
+	// is used as the default path prefix.
+	HealthRoutePrefix string
+	// DisableMetrics boolean flag to disable the metrics middleware and route.
+	DisableMetrics bool
+	// MetricsRoute is an optional path where the metrics are served in Prometheus text format. If left
+	// unspecified, `/metrics` is used as the default path.
+	MetricsRoute string
+	// AdminOnlyMetrics boolean flag to serve the metrics route only on the AdminAddr listener, without it the
+	// metrics are recorded but not served and a warning is logged. Default false, the metrics are served
+	// on the main listener when there's no AdminAddr.
+	AdminOnlyMetrics bool
+	// EnableTracing boolean flag to enable the tracing middleware, it propagates the W3C trace context and
+	// adds the trace_id and span_id to the request logger.
+	EnableTracing bool
+	// TracingExporter optional exporter of the request spans when the tracing is enabled.
+	TracingExporter tracing.Exporter
 	// DisableLoggerMiddleware boolean flag to disable the logger middleware.
 	DisableLoggerMiddleware bool
 	// DisablePrettyLogging don't output a colored human readable version on the out writer.
@@ -58,45 +86,128 @@ type Options struct {
 	// LoggerLevel defines log levels. Default "debug".
 	LoggerLevel string
 	level       zerolog.Level
-	// Mode in which the App is running. Default is "debug".
+	// LoggerLevelToken bearer token required by the logger level endpoint at ProfilerRoutePrefix + "/loglevel",
+	// which changes the logger level at runtime. Default empty, the endpoint isn't served.
+	LoggerLevelToken string `config:",secret"`
+	// LoggerLevelTTL time after which the logger levels changed at runtime revert to LoggerLevel. Default 0,
+	// they don't revert.
+	LoggerLevelTTL time.Duration
+	// LoggerLevelSignals boolean flag to change the logger level with the SIGUSR1 and SIGUSR2 signals.
+	// Default false, the signals aren't trapped.
+	LoggerLevelSignals bool
+	// LoggerFile optional path of a file where the logs are written instead of LoggerOutput. The file is
+	// rotated by size and time and the pretty logging is disabled.
+	LoggerFile string
+	// LoggerFileMaxSize size in bytes after which the logger file is rotated. Default 100 MB.
+	LoggerFileMaxSize int64
+	// LoggerFileRotateEvery time after which the logger file is rotated. Default 0, no time based rotation.
+	LoggerFileRotateEvery time.Duration
+	// LoggerFileMaxBackups number of rotated logger files to keep. Default 0, all are kept.
+	LoggerFileMaxBackups int
+	// LoggerFileMaxAge time to keep the rotated logger files. Default 0, all are kept.
+	LoggerFileMaxAge time.Duration
+	// LoggerAsync boolean flag to write the logs from a goroutine through a buffer, so a slow output never
+	// blocks the requests. The entries are dropped when the buffer is full.
+	LoggerAsync bool
+	// LoggerAsyncBufferSize number of log entries buffered by the async logger. Default 1024.
+	LoggerAsyncBufferSize int
+	// LoggerAsyncDropPolicy entry dropped when the async logger buffer is full, "newest" or "oldest".
+	// Default "newest".
+	LoggerAsyncDropPolicy logsink.DropPolicy
+	// AccessLogSampler optional sampler of the logger middleware entries, ie. a zerolog.LevelSampler.
+	AccessLogSampler zerolog.Sampler
+	// Redaction policy of the sensitive data in the logs of the logger, recovery and internal error
+	// middleware. The headers default to redact.DefaultHeaders.
+	Redaction redact.Policy
+	redactor  *redact.Redactor
+	// Mode in which the App is running, one of the built-in or registered with RegisterMode. Default is "debug".
 	Mode string
-	codeMode
+	mode ModeConfig
 	// ProfilerRoutePrefix is an optional path prefix for profiler subrouter. If left unspecified, `/debug/`
 	// is used as the default path prefix.
 	ProfilerRoutePrefix string
-	// EnableProfiler boolean flag to enable the profiler router in production mode.
+	// EnableProfiler boolean flag to enable the profiler router in non debug modes.
 	EnableProfiler bool
+	// TLSCertFile path to the PEM encoded certificate. When it's set along with TLSKeyFile the app is served with TLS.
+	// The certificate is reloaded from disk when the file changes or a SIGHUP signal is received.
+	TLSCertFile string
+	// TLSKeyFile path to the PEM encoded private key that matches TLSCertFile.
+	TLSKeyFile string
+	// TLSClientCAFile optional path to a PEM encoded CA bundle used to require and verify client certificates.
+	TLSClientCAFile string
+	// TLSMinVersion minimum TLS version accepted. Default tls.VersionTLS12.
+	TLSMinVersion uint16
+	// TLSCipherSuites list of supported cipher suites for TLS versions up to 1.2. Default the crypto/tls ones.
+	TLSCipherSuites []uint16
+	// ShutdownTimeout maximum time to drain the in-flight requests in the graceful shutdown, after it the
+	// remaining connections are forcibly closed. The shutdown hooks have the same time to run. Default 30s.
+	ShutdownTimeout time.Duration
+	// ShutdownDelay time to wait in the graceful shutdown before stop accepting connections. Meanwhile the
+	// ping route reports the app as unavailable to let the load balancers remove it. Default 0.
+	ShutdownDelay time.Duration
+	// ReadTimeout maximum duration for reading the entire request, including the body. It can be set with
+	// the READ_TIMEOUT env. Default 30s in production mode, no timeout in debug mode. A negative value means no timeout.
+	ReadTimeout time.Duration
+	// ReadHeaderTimeout amount of time allowed to read request headers. It can be set with the READ_HEADER_TIMEOUT env.
+	// Default 5s in production mode, 10s in debug mode. A negative value means no timeout.
+	ReadHeaderTimeout time.Duration
+	// WriteTimeout maximum duration before timing out writes of the response. It can be set with the WRITE_TIMEOUT env.
+	// Default 60s in production mode, no timeout in debug mode. A negative value means no timeout.
+	WriteTimeout time.Duration
+	// IdleTimeout maximum amount of time to wait for the next request when keep-alives are enabled. It can be set
+	// with the IDLE_TIMEOUT env. Default 120s. A negative value means no timeout.
+	IdleTimeout time.Duration
+	// MaxHeaderBytes maximum number of bytes the server will read parsing the request header's keys and values,
+	// including the request line. It can be set with the MAX_HEADER_BYTES env. Default 1 MB.
+	MaxHeaderBytes int
+	// AdminAddr optional address of a second server for the operational routes (ping, health, profiler,
+	// routes listing, metrics and OpenAPI document), they are no longer served by the app address. It can be set with the
+	// ADMIN_ADDR env and accepts unix domain sockets with the "unix:" prefix.
+	AdminAddr string
+	// OpenAPIRoute optional path where the OpenAPI document of the app routes is served, in JSON at the path
+	// and at the path with the .json extension, and in YAML at the path with the .yaml extension. Default empty,
+	// the document is not served.
+	OpenAPIRoute string `config:"openapi_route"`
+	// OpenAPIInfo metadata of the API in the OpenAPI document.
+	OpenAPIInfo openapi.Info `config:"openapi_info"`
+	// H2C boolean flag to serve HTTP/2 over cleartext along with HTTP/1.1 on the same listener, both with
+	// prior knowledge and with the "Upgrade: h2c" header. It can't be used with TLS.
+	H2C bool `config:"h2c"`
 }
 
-// IsDebug check if app is running in debug mode
+// IsDebug check if app is running in a debug mode
 func (opts Options) IsDebug() bool {
-	return opts.codeMode == debugCode
+	return opts.mode.Debug
+}
+
+// IsTLS check if app is going to be served with TLS.
+func (opts Options) IsTLS() bool {
+	return opts.TLSCertFile != "" || opts.TLSKeyFile != ""
 }
 
-func resolveMode(opts *Options) codeMode {
-	modeEnv := defaultString(os.Getenv("GO_ENV"), "")
-	if modeEnv == "" {
-		modeEnv = defaultString(os.Getenv("GO_ENVIRONMENT"), "")
+// OptionsError is returned when the options are invalid, it holds every problem found.
+type OptionsError struct {
+	Problems []string
+}
+
+func (e *OptionsError) Error() string {
+	if len(e.Problems) == 1 {
+		return e.Problems[0]
 	}
-	mode := defaultString(opts.Mode, modeEnv)
-	return findMode(mode)
+	return "bastion invalid options:\n  - " + strings.Join(e.Problems, "\n  - ")
 }
 
-func findMode(value string) codeMode {
-	var codeMode = debugCode
-	switch value {
-	case DebugMode, "":
-		codeMode = debugCode
-	case ProductionMode:
-		codeMode = productionCode
-	default:
-		panic("bastion mode unknown: " + value)
+// problems collects the problems found resolving the options.
+type problems []string
+
+func (p *problems) check(err error) {
+	if err != nil {
+		*p = append(*p, err.Error())
 	}
-	return codeMode
 }
 
-func resolveLoggerLvl(opts *Options) zerolog.Level {
-	lvl := defaultString(opts.LoggerLevel, "")
+func resolveLoggerLvl(opts *Options) (zerolog.Level, error) {
+	lvl := defaultString(opts.LoggerLevel, opts.mode.LoggerLevel)
 	if lvl == "" && !opts.IsDebug() {
 		lvl = ErrorLevel
 	} else if lvl == "" {
@@ -105,43 +216,184 @@ func resolveLoggerLvl(opts *Options) zerolog.Level {
 	return findLvl(lvl)
 }
 
-func findLvl(value string) zerolog.Level {
+func findLvl(value string) (zerolog.Level, error) {
 	lvl, err := zerolog.ParseLevel(value)
 	if err != nil {
-		panic("bastion logger level unknown: " + value)
+		return zerolog.NoLevel, fmt.Errorf("bastion logger level unknown: %v", value)
 	}
-	return lvl
+	return lvl, nil
 }
 
 func resolveDisablePrettyLogging(opts *Options) bool {
 	if !opts.IsDebug() {
 		return true
 	}
-	return opts.DisablePrettyLogging
+	return opts.DisablePrettyLogging || opts.mode.DisablePrettyLogging
+}
+
+func resolveLoggerSinks(opts *Options, p *problems) {
+	if opts.LoggerFile != "" {
+		opts.DisablePrettyLogging = true
+		if opts.LoggerFileMaxSize == 0 {
+			opts.LoggerFileMaxSize = defaultLoggerFileMaxSize
+		}
+	}
+	if opts.LoggerAsync {
+		if opts.LoggerAsyncBufferSize <= 0 {
+			opts.LoggerAsyncBufferSize = defaultLoggerAsyncBufferSize
+		}
+		if opts.LoggerAsyncDropPolicy == "" {
+			opts.LoggerAsyncDropPolicy = logsink.DropNewest
+		}
+		if opts.LoggerAsyncDropPolicy != logsink.DropNewest && opts.LoggerAsyncDropPolicy != logsink.DropOldest {
+			p.check(fmt.Errorf("bastion logger async drop policy unknown: %v", opts.LoggerAsyncDropPolicy))
+		}
+	}
+}
+
+func resolveRedaction(opts *Options, p *problems) {
+	if opts.Redaction.Headers == nil {
+		opts.Redaction.Headers = redact.DefaultHeaders
+	}
+	redactor, err := redact.New(opts.Redaction)
+	if err != nil {
+		p.check(fmt.Errorf("bastion %v", err))
+		return
+	}
+	opts.redactor = redactor
 }
 
 func resolveEnableProfiler(opts *Options) bool {
-	if opts.EnableProfiler {
-		return opts.EnableProfiler
+	return opts.EnableProfiler || opts.mode.EnableProfiler
+}
+
+// resolveModeToggles applies the middleware and routes toggles of the mode.
+func resolveModeToggles(opts *Options) {
+	opts.DisablePingRouter = opts.DisablePingRouter || opts.mode.DisablePingRouter
+	opts.DisableLoggerMiddleware = opts.DisableLoggerMiddleware || opts.mode.DisableLoggerMiddleware
+	opts.DisableRecoveryMiddleware = opts.DisableRecoveryMiddleware || opts.mode.DisableRecoveryMiddleware
+	opts.DisableInternalErrorMiddleware = opts.DisableInternalErrorMiddleware || opts.mode.DisableInternalErrorMiddleware
+	opts.AdminOnlyMetrics = opts.AdminOnlyMetrics || opts.mode.AdminOnlyMetrics
+}
+
+func resolveTLS(opts *Options, p *problems) {
+	if !opts.IsTLS() {
+		return
 	}
-	if opts.IsDebug() {
-		return true
+	if opts.TLSCertFile == "" || opts.TLSKeyFile == "" {
+		p.check(errors.New("bastion tls requires both cert and key files"))
+	}
+	if opts.H2C {
+		p.check(errors.New("bastion h2c can't be used with tls"))
+	}
+	if opts.TLSMinVersion == 0 {
+		opts.TLSMinVersion = tls.VersionTLS12
+	}
+}
+
+// serverLimits holds the http.Server timeouts and limits defaults per mode.
+type serverLimits struct {
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+}
+
+// serverLimitsDefaults by debug or non debug mode.
+var serverLimitsDefaults = map[bool]serverLimits{
+	true: {
+		readHeaderTimeout: 10 * time.Second,
+		idleTimeout:       120 * time.Second,
+		maxHeaderBytes:    1 << 20,
+	},
+	false: {
+		readTimeout:       30 * time.Second,
+		readHeaderTimeout: 5 * time.Second,
+		writeTimeout:      60 * time.Second,
+		idleTimeout:       120 * time.Second,
+		maxHeaderBytes:    1 << 20,
+	},
+}
+
+func resolveDuration(value time.Duration, env string, def time.Duration, p *problems) time.Duration {
+	if value != 0 {
+		return value
+	}
+	if v := os.Getenv(env); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			p.check(fmt.Errorf("bastion %v env invalid: %v", env, v))
+			return def
+		}
+		return d
 	}
-	return false
+	return def
 }
 
-func setDefaultsOpts(opts *Options) {
-	opts.codeMode = resolveMode(opts)
-	opts.Mode = opts.codeMode.String()
-	opts.level = resolveLoggerLvl(opts)
+func resolveServerLimits(opts *Options, p *problems) {
+	def := serverLimitsDefaults[opts.IsDebug()]
+	opts.ReadTimeout = resolveDuration(opts.ReadTimeout, "READ_TIMEOUT", def.readTimeout, p)
+	opts.ReadHeaderTimeout = resolveDuration(opts.ReadHeaderTimeout, "READ_HEADER_TIMEOUT", def.readHeaderTimeout, p)
+	opts.WriteTimeout = resolveDuration(opts.WriteTimeout, "WRITE_TIMEOUT", def.writeTimeout, p)
+	opts.IdleTimeout = resolveDuration(opts.IdleTimeout, "IDLE_TIMEOUT", def.idleTimeout, p)
+	if opts.MaxHeaderBytes == 0 {
+		opts.MaxHeaderBytes = def.maxHeaderBytes
+		if v := os.Getenv("MAX_HEADER_BYTES"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				p.check(fmt.Errorf("bastion MAX_HEADER_BYTES env invalid: %v", v))
+			} else {
+				opts.MaxHeaderBytes = n
+			}
+		}
+	}
+	if opts.MaxHeaderBytes < 0 {
+		p.check(fmt.Errorf("bastion max header bytes can't be negative: %v", opts.MaxHeaderBytes))
+	}
+}
+
+// setDefaultsOpts validates the options and fills the missing ones with the defaults of the mode.
+// The invalid options are collected into p.
+func setDefaultsOpts(opts *Options, p *problems) {
+	opts.Mode = resolveMode(opts)
+	mode, err := findMode(opts.Mode)
+	p.check(err)
+	opts.mode = mode
+	level, err := resolveLoggerLvl(opts)
+	p.check(err)
+	opts.level = level
 	opts.DisablePrettyLogging = resolveDisablePrettyLogging(opts)
+	resolveLoggerSinks(opts, p)
+	resolveRedaction(opts, p)
 	opts.LoggerLevel = opts.level.String()
+	if opts.LoggerLevelTTL < 0 {
+		p.check(fmt.Errorf("bastion logger level ttl can't be negative: %v", opts.LoggerLevelTTL))
+	}
 	opts.InternalErrMsg = defaultString(opts.InternalErrMsg, defaultInternalErrMsg)
+	if opts.ErrorRenderer == nil {
+		opts.ErrorRenderer = render.JSON
+	}
+	if opts.ErrorMapper == nil {
+		opts.ErrorMapper = DefaultErrorMapper(opts.ErrorRenderer, opts.InternalErrMsg)
+	}
 	opts.ProfilerRoutePrefix = defaultString(opts.ProfilerRoutePrefix, defaultProfilerRoutePrefix)
 	opts.EnableProfiler = resolveEnableProfiler(opts)
+	resolveModeToggles(opts)
+	opts.HealthRoutePrefix = defaultString(opts.HealthRoutePrefix, defaultHealthRoutePrefix)
+	opts.MetricsRoute = defaultString(opts.MetricsRoute, defaultMetricsRoute)
 	if opts.LoggerOutput == nil {
 		opts.LoggerOutput = os.Stdout
 	}
+	resolveTLS(opts, p)
+	if opts.ShutdownDelay < 0 {
+		p.check(fmt.Errorf("bastion shutdown delay can't be negative: %v", opts.ShutdownDelay))
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = defaultShutdownTimeout
+	}
+	resolveServerLimits(opts, p)
+	opts.AdminAddr = defaultString(opts.AdminAddr, os.Getenv("ADMIN_ADDR"))
 }
 
 func defaultString(s1, s2 string) string {
@@ -154,6 +406,22 @@ func defaultString(s1, s2 string) string {
 // Opt helper type to create functional options
 type Opt func(*Bastion)
 
+// MapErrors set the ErrorMapper of the HandlerFunc handlers, it can be overridden per router with the
+// UseErrorMapper middleware.
+func MapErrors(mapper ErrorMapper) Opt {
+	return func(app *Bastion) {
+		app.ErrorMapper = mapper
+	}
+}
+
+// ErrorRenderer set the renderer of the app errors, ie. render.ProblemJSON to respond RFC 7807 problem details.
+// A *render.Negotiator, ie. render.Negotiate, is negotiated per request with render.ForRequest.
+func ErrorRenderer(renderer render.APIRenderer) Opt {
+	return func(app *Bastion) {
+		app.ErrorRenderer = renderer
+	}
+}
+
 // InternalErrMsg set the message returned to the user when catch a 500 status error.
 func InternalErrMsg(msg string) Opt {
 	return func(app *Bastion) {
@@ -182,6 +450,58 @@ func DisablePingRouter() Opt {
 	}
 }
 
+// DisableHealthRouter turn off the liveness and readiness routes.
+func DisableHealthRouter() Opt {
+	return func(app *Bastion) {
+		app.DisableHealthRouter = true
+	}
+}
+
+// HealthRoutePrefix set the prefix path for the health router.
+func HealthRoutePrefix(prefix string) Opt {
+	return func(app *Bastion) {
+		if !strings.HasPrefix(prefix, "/") {
+			app.HealthRoutePrefix = "/" + prefix
+		} else {
+			app.HealthRoutePrefix = prefix
+		}
+	}
+}
+
+// DisableMetrics turn off the metrics middleware and route.
+func DisableMetrics() Opt {
+	return func(app *Bastion) {
+		app.DisableMetrics = true
+	}
+}
+
+// MetricsRoute set the path for the metrics route.
+func MetricsRoute(path string) Opt {
+	return func(app *Bastion) {
+		if !strings.HasPrefix(path, "/") {
+			app.MetricsRoute = "/" + path
+		} else {
+			app.MetricsRoute = path
+		}
+	}
+}
+
+// AdminOnlyMetrics serve the metrics route only on the AdminAddr listener.
+func AdminOnlyMetrics() Opt {
+	return func(app *Bastion) {
+		app.AdminOnlyMetrics = true
+	}
+}
+
+// Tracing turn on the tracing middleware shipping the request spans through the exporter. A nil exporter
+// only propagates the trace context.
+func Tracing(exporter tracing.Exporter) Opt {
+	return func(app *Bastion) {
+		app.EnableTracing = true
+		app.TracingExporter = exporter
+	}
+}
+
 func DisableLoggerMiddleware() Opt {
 	return func(app *Bastion) {
 		app.DisableLoggerMiddleware = true
@@ -202,6 +522,23 @@ func LoggerLevel(lvl string) Opt {
 	}
 }
 
+// LoggerLevelControl serves the logger level endpoint at ProfilerRoutePrefix + "/loglevel" authenticated with
+// the bearer token. The levels changed at runtime revert after the ttl when it's greater than zero.
+func LoggerLevelControl(token string, ttl time.Duration) Opt {
+	return func(app *Bastion) {
+		app.LoggerLevelToken = token
+		app.LoggerLevelTTL = ttl
+	}
+}
+
+// LoggerLevelSignals lowers the logger level one step on SIGUSR1 and reverts every level on SIGUSR2, the
+// changes revert after LoggerLevelTTL when it's greater than zero.
+func LoggerLevelSignals() Opt {
+	return func(app *Bastion) {
+		app.LoggerLevelSignals = true
+	}
+}
+
 // LoggerOutput set the logger output writer
 func LoggerOutput(w io.Writer) Opt {
 	return func(app *Bastion) {
@@ -209,7 +546,50 @@ func LoggerOutput(w io.Writer) Opt {
 	}
 }
 
-// Mode set the mode in which the App is running.
+// LoggerFile writes the logs into a file, rotated after maxSize bytes or every period when they are
+// greater than zero. A zero maxSize means 100 MB.
+func LoggerFile(path string, maxSize int64, every time.Duration) Opt {
+	return func(app *Bastion) {
+		app.LoggerFile = path
+		app.LoggerFileMaxSize = maxSize
+		app.LoggerFileRotateEvery = every
+	}
+}
+
+// LoggerFileRetention set the number of rotated logger files to keep and for how long, zero values keep all.
+func LoggerFileRetention(maxBackups int, maxAge time.Duration) Opt {
+	return func(app *Bastion) {
+		app.LoggerFileMaxBackups = maxBackups
+		app.LoggerFileMaxAge = maxAge
+	}
+}
+
+// LoggerAsync writes the logs from a goroutine through a buffer of bufferSize entries, the policy decides
+// the entry dropped when the buffer is full. A zero bufferSize means 1024 and an empty policy "newest".
+func LoggerAsync(bufferSize int, policy logsink.DropPolicy) Opt {
+	return func(app *Bastion) {
+		app.LoggerAsync = true
+		app.LoggerAsyncBufferSize = bufferSize
+		app.LoggerAsyncDropPolicy = policy
+	}
+}
+
+// AccessLogSampling set the sampler of the logger middleware entries, the logs of the handlers aren't sampled.
+func AccessLogSampling(sampler zerolog.Sampler) Opt {
+	return func(app *Bastion) {
+		app.AccessLogSampler = sampler
+	}
+}
+
+// Redaction set the policy of the sensitive data masked in the logs of the logger, recovery and internal
+// error middleware.
+func Redaction(policy redact.Policy) Opt {
+	return func(app *Bastion) {
+		app.Redaction = policy
+	}
+}
+
+// Mode set the mode in which the App is running, one of the built-in modes or registered with RegisterMode.
 func Mode(mode string) Opt {
 	return func(app *Bastion) {
 		app.Mode = mode
@@ -233,3 +613,106 @@ func EnableProfiler() Opt {
 		app.EnableProfiler = true
 	}
 }
+
+// TLS set the certificate and key files used to serve the app with TLS.
+func TLS(certFile, keyFile string) Opt {
+	return func(app *Bastion) {
+		app.TLSCertFile = certFile
+		app.TLSKeyFile = keyFile
+	}
+}
+
+// TLSClientCA set the CA bundle file used to require and verify client certificates.
+func TLSClientCA(caFile string) Opt {
+	return func(app *Bastion) {
+		app.TLSClientCAFile = caFile
+	}
+}
+
+// TLSMinVersion set the minimum TLS version accepted.
+func TLSMinVersion(version uint16) Opt {
+	return func(app *Bastion) {
+		app.TLSMinVersion = version
+	}
+}
+
+// TLSCipherSuites set the supported cipher suites.
+func TLSCipherSuites(suites ...uint16) Opt {
+	return func(app *Bastion) {
+		app.TLSCipherSuites = suites
+	}
+}
+
+// ShutdownTimeout set the maximum time to drain the in-flight requests in the graceful shutdown.
+func ShutdownTimeout(d time.Duration) Opt {
+	return func(app *Bastion) {
+		app.ShutdownTimeout = d
+	}
+}
+
+// ShutdownDelay set the time to wait in the graceful shutdown before stop accepting connections.
+func ShutdownDelay(d time.Duration) Opt {
+	return func(app *Bastion) {
+		app.ShutdownDelay = d
+	}
+}
+
+// ReadTimeout set the maximum duration for reading the entire request, including the body.
+func ReadTimeout(d time.Duration) Opt {
+	return func(app *Bastion) {
+		app.ReadTimeout = d
+	}
+}
+
+// ReadHeaderTimeout set the amount of time allowed to read request headers.
+func ReadHeaderTimeout(d time.Duration) Opt {
+	return func(app *Bastion) {
+		app.ReadHeaderTimeout = d
+	}
+}
+
+// WriteTimeout set the maximum duration before timing out writes of the response.
+func WriteTimeout(d time.Duration) Opt {
+	return func(app *Bastion) {
+		app.WriteTimeout = d
+	}
+}
+
+// IdleTimeout set the maximum amount of time to wait for the next request when keep-alives are enabled.
+func IdleTimeout(d time.Duration) Opt {
+	return func(app *Bastion) {
+		app.IdleTimeout = d
+	}
+}
+
+// MaxHeaderBytes set the maximum number of bytes the server will read parsing the request header.
+func MaxHeaderBytes(n int) Opt {
+	return func(app *Bastion) {
+		app.MaxHeaderBytes = n
+	}
+}
+
+// AdminAddr set the address of the server for the operational routes.
+func AdminAddr(addr string) Opt {
+	return func(app *Bastion) {
+		app.AdminAddr = addr
+	}
+}
+
+// H2C turn on serving HTTP/2 over cleartext along with HTTP/1.1.
+func H2C() Opt {
+	return func(app *Bastion) {
+		app.H2C = true
+	}
+}
+
+// OpenAPI serves the OpenAPI document of the app routes at the route.
+func OpenAPI(route string, info openapi.Info) Opt {
+	return func(app *Bastion) {
+		if !strings.HasPrefix(route, "/") {
+			route = "/" + route
+		}
+		app.OpenAPIRoute = route
+		app.OpenAPIInfo = info
+	}
+}
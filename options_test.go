@@ -1,8 +1,10 @@
 package bastion_test
 
 import (
+	"crypto/tls"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -23,6 +25,8 @@ func TestNewOptions(t *testing.T) {
 	assert.Equal(t, "debug", opts.Mode)
 	assert.Equal(t, "/debug", opts.ProfilerRoutePrefix)
 	assert.True(t, opts.EnableProfiler)
+	assert.False(t, opts.DisableHealthRouter)
+	assert.Equal(t, "/health", opts.HealthRoutePrefix)
 }
 
 func TestOptionsLoggerLevel(t *testing.T) {
@@ -57,6 +61,7 @@ func TestBooleanFunctionalOptions(t *testing.T) {
 	assert.True(t, bastion.New(bastion.DisableInternalErrorMiddleware()).Options.DisableInternalErrorMiddleware)
 	assert.True(t, bastion.New(bastion.DisableRecoveryMiddleware()).Options.DisableRecoveryMiddleware)
 	assert.True(t, bastion.New(bastion.DisablePingRouter()).Options.DisablePingRouter)
+	assert.True(t, bastion.New(bastion.DisableHealthRouter()).Options.DisableHealthRouter)
 	assert.True(t, bastion.New(bastion.DisableLoggerMiddleware()).Options.DisableLoggerMiddleware)
 	assert.True(t, bastion.New(bastion.DisablePrettyLogging()).Options.DisablePrettyLogging)
 	assert.True(t, bastion.New(bastion.EnableProfiler()).Options.EnableProfiler)
@@ -110,6 +115,58 @@ func TestModeWithOptionBadArg(t *testing.T) {
 	assert.PanicsWithValue(t, "bastion mode unknown: bad", f)
 }
 
+func TestTestMode(t *testing.T) {
+	t.Parallel()
+	app := bastion.New(bastion.Mode(bastion.TestMode))
+	assert.Equal(t, "test", app.Options.Mode)
+	assert.True(t, app.IsDebug())
+	assert.Equal(t, bastion.ErrorLevel, app.Options.LoggerLevel)
+	assert.False(t, app.Options.EnableProfiler)
+}
+
+func TestRegisterMode(t *testing.T) {
+	bastion.RegisterMode("staging", bastion.ModeConfig{
+		LoggerLevel:               bastion.InfoLevel,
+		EnableProfiler:            true,
+		DisablePingRouter:         true,
+		DisableRecoveryMiddleware: true,
+	})
+	defer bastion.UnregisterMode("staging")
+
+	tempADDR := os.Getenv("GO_ENV")
+	os.Setenv("GO_ENV", "staging")
+	defer os.Setenv("GO_ENV", tempADDR)
+	app := bastion.New()
+	assert.Equal(t, "staging", app.Options.Mode)
+	assert.False(t, app.IsDebug())
+	assert.Equal(t, bastion.InfoLevel, app.Options.LoggerLevel)
+	assert.True(t, app.Options.DisablePrettyLogging)
+	assert.True(t, app.Options.EnableProfiler)
+	assert.True(t, app.Options.DisablePingRouter)
+	assert.True(t, app.Options.DisableRecoveryMiddleware)
+	assert.False(t, app.Options.DisableLoggerMiddleware)
+	assert.Equal(t, 30*time.Second, app.Options.ReadTimeout)
+
+	// the logger level option takes precedence over the mode default, the toggles are combined
+	app = bastion.New(bastion.LoggerLevel(bastion.WarnLevel), bastion.DisableLoggerMiddleware())
+	assert.Equal(t, bastion.WarnLevel, app.Options.LoggerLevel)
+	assert.True(t, app.Options.DisablePingRouter)
+	assert.True(t, app.Options.DisableLoggerMiddleware)
+}
+
+func TestRegisterModeBadArgs(t *testing.T) {
+	t.Parallel()
+	assert.PanicsWithValue(t, "bastion mode name can't be empty", func() {
+		bastion.RegisterMode("", bastion.ModeConfig{})
+	})
+	assert.PanicsWithValue(t, "bastion mode already registered: production", func() {
+		bastion.RegisterMode(bastion.ProductionMode, bastion.ModeConfig{})
+	})
+	assert.PanicsWithValue(t, "bastion logger level unknown: loud", func() {
+		bastion.RegisterMode("loud", bastion.ModeConfig{LoggerLevel: "loud"})
+	})
+}
+
 func TestOptionsProfilerRoutePrefixWhenMissingTrailingSlash(t *testing.T) {
 	t.Parallel()
 	opts := bastion.New(bastion.ProfilerRoutePrefix("dbg")).Options
@@ -122,6 +179,13 @@ func TestOptionsProfilerRoutePrefix(t *testing.T) {
 	assert.Equal(t, "/abc", opts.ProfilerRoutePrefix)
 }
 
+func TestAdminOnlyMetricsDefault(t *testing.T) {
+	t.Parallel()
+	assert.False(t, bastion.New().Options.AdminOnlyMetrics)
+	assert.False(t, bastion.New(bastion.Mode(bastion.ProductionMode)).Options.AdminOnlyMetrics)
+	assert.True(t, bastion.New(bastion.AdminOnlyMetrics()).Options.AdminOnlyMetrics)
+}
+
 func TestEnableProfilerShouldBeFalseForProd(t *testing.T) {
 	t.Parallel()
 	opts := bastion.New(bastion.Mode(bastion.ProductionMode)).Options
@@ -133,3 +197,165 @@ func TestEnableProfilerShouldBeTrueWhenOptionForProd(t *testing.T) {
 	opts := bastion.New(bastion.Mode(bastion.ProductionMode), bastion.EnableProfiler()).Options
 	assert.True(t, opts.EnableProfiler)
 }
+
+func TestOptionsTLS(t *testing.T) {
+	t.Parallel()
+	opts := bastion.New(
+		bastion.TLS("cert.pem", "key.pem"),
+		bastion.TLSClientCA("ca.pem"),
+		bastion.TLSMinVersion(tls.VersionTLS11),
+		bastion.TLSCipherSuites(tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384),
+	).Options
+	assert.True(t, opts.IsTLS())
+	assert.Equal(t, "cert.pem", opts.TLSCertFile)
+	assert.Equal(t, "key.pem", opts.TLSKeyFile)
+	assert.Equal(t, "ca.pem", opts.TLSClientCAFile)
+	assert.Equal(t, uint16(tls.VersionTLS11), opts.TLSMinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}, opts.TLSCipherSuites)
+}
+
+func TestOptionsTLSDefaultMinVersion(t *testing.T) {
+	t.Parallel()
+	opts := bastion.New(bastion.TLS("cert.pem", "key.pem")).Options
+	assert.Equal(t, uint16(tls.VersionTLS12), opts.TLSMinVersion)
+	assert.False(t, bastion.New().Options.IsTLS())
+}
+
+func TestOptionsTLSMissingKey(t *testing.T) {
+	t.Parallel()
+	f := func() {
+		bastion.New(bastion.TLS("cert.pem", ""))
+	}
+	assert.PanicsWithValue(t, "bastion tls requires both cert and key files", f)
+}
+
+func TestOptionsShutdown(t *testing.T) {
+	t.Parallel()
+	opts := bastion.New().Options
+	assert.Equal(t, 30*time.Second, opts.ShutdownTimeout)
+	assert.Equal(t, time.Duration(0), opts.ShutdownDelay)
+
+	opts = bastion.New(bastion.ShutdownTimeout(time.Second), bastion.ShutdownDelay(5*time.Second)).Options
+	assert.Equal(t, time.Second, opts.ShutdownTimeout)
+	assert.Equal(t, 5*time.Second, opts.ShutdownDelay)
+}
+
+func TestOptionsHealthRoutePrefix(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "/status", bastion.New(bastion.HealthRoutePrefix("status")).Options.HealthRoutePrefix)
+	assert.Equal(t, "/status", bastion.New(bastion.HealthRoutePrefix("/status")).Options.HealthRoutePrefix)
+}
+
+func TestOptionsServerLimitsDefaults(t *testing.T) {
+	t.Parallel()
+	opts := bastion.New().Options
+	assert.Equal(t, time.Duration(0), opts.ReadTimeout)
+	assert.Equal(t, 10*time.Second, opts.ReadHeaderTimeout)
+	assert.Equal(t, time.Duration(0), opts.WriteTimeout)
+	assert.Equal(t, 120*time.Second, opts.IdleTimeout)
+	assert.Equal(t, 1<<20, opts.MaxHeaderBytes)
+
+	opts = bastion.New(bastion.Mode(bastion.ProductionMode)).Options
+	assert.Equal(t, 30*time.Second, opts.ReadTimeout)
+	assert.Equal(t, 5*time.Second, opts.ReadHeaderTimeout)
+	assert.Equal(t, 60*time.Second, opts.WriteTimeout)
+	assert.Equal(t, 120*time.Second, opts.IdleTimeout)
+	assert.Equal(t, 1<<20, opts.MaxHeaderBytes)
+}
+
+func TestOptionsServerLimits(t *testing.T) {
+	t.Parallel()
+	opts := bastion.New(
+		bastion.ReadTimeout(time.Second),
+		bastion.ReadHeaderTimeout(2*time.Second),
+		bastion.WriteTimeout(3*time.Second),
+		bastion.IdleTimeout(-1),
+		bastion.MaxHeaderBytes(4096),
+	).Options
+	assert.Equal(t, time.Second, opts.ReadTimeout)
+	assert.Equal(t, 2*time.Second, opts.ReadHeaderTimeout)
+	assert.Equal(t, 3*time.Second, opts.WriteTimeout)
+	assert.Equal(t, time.Duration(-1), opts.IdleTimeout)
+	assert.Equal(t, 4096, opts.MaxHeaderBytes)
+}
+
+func TestOptionsServerLimitsWithEnv(t *testing.T) {
+	envs := map[string]string{
+		"READ_TIMEOUT":        "1s",
+		"READ_HEADER_TIMEOUT": "2s",
+		"WRITE_TIMEOUT":       "3s",
+		"IDLE_TIMEOUT":        "4s",
+		"MAX_HEADER_BYTES":    "2048",
+	}
+	for k, v := range envs {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	opts := bastion.New(bastion.WriteTimeout(time.Minute)).Options
+	assert.Equal(t, time.Second, opts.ReadTimeout)
+	assert.Equal(t, 2*time.Second, opts.ReadHeaderTimeout)
+	assert.Equal(t, time.Minute, opts.WriteTimeout)
+	assert.Equal(t, 4*time.Second, opts.IdleTimeout)
+	assert.Equal(t, 2048, opts.MaxHeaderBytes)
+}
+
+func TestOptionsServerLimitsBadEnv(t *testing.T) {
+	os.Setenv("READ_TIMEOUT", "bad")
+	defer os.Unsetenv("READ_TIMEOUT")
+	f := func() {
+		bastion.New()
+	}
+	assert.PanicsWithValue(t, "bastion READ_TIMEOUT env invalid: bad", f)
+}
+
+func TestBuild(t *testing.T) {
+	t.Parallel()
+	app, err := bastion.Build(bastion.Mode(bastion.ProductionMode))
+	assert.Nil(t, err)
+	assert.Equal(t, "production", app.Options.Mode)
+}
+
+func TestBuildAggregatesProblems(t *testing.T) {
+	os.Setenv("WRITE_TIMEOUT", "soon")
+	defer os.Unsetenv("WRITE_TIMEOUT")
+	app, err := bastion.Build(
+		bastion.Mode("staging-eu"),
+		bastion.LoggerLevel("verbose"),
+		bastion.TLS("cert.pem", ""),
+		bastion.H2C(),
+		bastion.ShutdownDelay(-time.Second),
+	)
+	assert.Nil(t, app)
+	expected := &bastion.OptionsError{Problems: []string{
+		"bastion mode unknown: staging-eu",
+		"bastion logger level unknown: verbose",
+		"bastion tls requires both cert and key files",
+		"bastion h2c can't be used with tls",
+		"bastion shutdown delay can't be negative: -1s",
+		"bastion WRITE_TIMEOUT env invalid: soon",
+	}}
+	assert.Equal(t, expected, err)
+	assert.EqualError(t, err, `bastion invalid options:
+  - bastion mode unknown: staging-eu
+  - bastion logger level unknown: verbose
+  - bastion tls requires both cert and key files
+  - bastion h2c can't be used with tls
+  - bastion shutdown delay can't be negative: -1s
+  - bastion WRITE_TIMEOUT env invalid: soon`)
+}
+
+func TestOptionsLoggerLevelControl(t *testing.T) {
+	t.Parallel()
+	app := bastion.New(bastion.LoggerLevelControl("s3cr3t", time.Minute))
+	assert.Equal(t, "s3cr3t", app.LoggerLevelToken)
+	assert.Equal(t, time.Minute, app.LoggerLevelTTL)
+
+	_, err := bastion.Build(bastion.LoggerLevelControl("s3cr3t", -time.Minute))
+	assert.EqualError(t, err, "bastion logger level ttl can't be negative: -1m0s")
+}
+
+func TestOptionsLoggerLevelSignals(t *testing.T) {
+	t.Parallel()
+	assert.False(t, bastion.New().LoggerLevelSignals)
+	assert.True(t, bastion.New(bastion.LoggerLevelSignals()).LoggerLevelSignals)
+}
@@ -3,11 +3,19 @@ package bastion
 import (
 	"net/http"
 
+	"github.com/ifreddyrondon/bastion/middleware"
 	"github.com/ifreddyrondon/bastion/render"
 )
 
 // Ping endpoint is useful for load balancers or uptime testing
 // external services can make a request before hitting any routes.
-func pingHandler(w http.ResponseWriter, _ *http.Request) {
+// It responds 503 when the app is shutting down, so the load balancers
+// can stop sending traffic before the server stops accepting connections.
+func (app *Bastion) pingHandler(w http.ResponseWriter, r *http.Request) {
+	if app.isDraining() {
+		middleware.SkipInternalError(r)
+		render.Text.Response(w, http.StatusServiceUnavailable, "shutting down")
+		return
+	}
 	render.Text.Response(w, http.StatusOK, "pong")
 }
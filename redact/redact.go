@@ -0,0 +1,193 @@
+// Package redact masks the sensitive data of the requests and responses before they are logged.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Mask replaces the redacted values.
+const Mask = "[REDACTED]"
+
+// DefaultHeaders are the headers carrying credentials.
+var DefaultHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Policy describes the data to redact. The names are case insensitive.
+type Policy struct {
+	// Headers names of the headers whose values are masked.
+	Headers []string
+	// Fields paths of the JSON body fields whose values are masked, ie. "password" or "user.card.number".
+	// The arrays are traversed and "*" matches any field name.
+	Fields []string
+	// Query names of the query params whose values are masked.
+	Query []string
+	// Patterns regular expressions whose matches are masked in the urls, headers and bodies.
+	Patterns []string
+}
+
+// Redactor applies a Policy. A nil Redactor returns the values unchanged.
+type Redactor struct {
+	headers  map[string]bool
+	fields   [][]string
+	query    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// New returns a Redactor of the policy, it fails when a pattern doesn't compile.
+func New(p Policy) (*Redactor, error) {
+	r := &Redactor{headers: map[string]bool{}, query: map[string]bool{}}
+	for _, name := range p.Headers {
+		r.headers[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, path := range p.Fields {
+		r.fields = append(r.fields, strings.Split(strings.ToLower(path), "."))
+	}
+	for _, name := range p.Query {
+		r.query[strings.ToLower(name)] = true
+	}
+	for _, pattern := range p.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "redact pattern %q", pattern)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// String masks the matches of the patterns.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllLiteralString(s, Mask)
+	}
+	return s
+}
+
+// Header returns the value of the header masked when its name is redacted, otherwise with the matches
+// of the patterns masked. The Referer header is masked like a URL.
+func (r *Redactor) Header(name, value string) string {
+	if r == nil {
+		return value
+	}
+	key := http.CanonicalHeaderKey(name)
+	if r.headers[key] {
+		return Mask
+	}
+	if key == "Referer" {
+		return r.Referer(value)
+	}
+	return r.String(value)
+}
+
+// Referer returns the referer url with the values of the redacted query params masked, like URL does
+// with the request uri.
+func (r *Redactor) Referer(referer string) string {
+	if r == nil {
+		return referer
+	}
+	i := strings.IndexByte(referer, '?')
+	if i == -1 || len(r.query) == 0 {
+		return r.String(referer)
+	}
+	query, fragment := referer[i+1:], ""
+	if j := strings.IndexByte(query, '#'); j != -1 {
+		query, fragment = query[:j], query[j:]
+	}
+	return r.String(referer[:i+1] + r.maskQuery(query) + fragment)
+}
+
+// URL returns the request uri of u with the values of the redacted query params masked. The order and
+// encoding of the query params is kept.
+func (r *Redactor) URL(u *url.URL) string {
+	if r == nil {
+		return u.RequestURI()
+	}
+	if u.RawQuery == "" || len(r.query) == 0 {
+		return r.String(u.RequestURI())
+	}
+	masked := *u
+	masked.RawQuery = ""
+	return r.String(masked.RequestURI() + "?" + r.maskQuery(u.RawQuery))
+}
+
+// maskQuery masks the values of the redacted params of the raw query.
+func (r *Redactor) maskQuery(rawQuery string) string {
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		key := param
+		if j := strings.Index(param, "="); j != -1 {
+			key = param[:j]
+		}
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if r.query[strings.ToLower(name)] {
+			params[i] = key + "=" + Mask
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// Body returns b with the redacted fields masked when it's a JSON document and the matches of the
+// patterns masked. The masked JSON documents are compacted with sorted keys. When there are redacted
+// fields and b isn't a single JSON document, ie. a truncated one, the whole body is masked.
+func (r *Redactor) Body(b []byte) []byte {
+	if r == nil || len(b) == 0 {
+		return b
+	}
+	if len(r.fields) > 0 {
+		b = r.jsonBody(b)
+	}
+	if len(r.patterns) == 0 {
+		return b
+	}
+	return []byte(r.String(string(b)))
+}
+
+func (r *Redactor) jsonBody(b []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil || dec.More() {
+		return []byte(Mask)
+	}
+	for _, path := range r.fields {
+		doc = maskPath(doc, path)
+	}
+	masked, err := json.Marshal(doc)
+	if err != nil {
+		return []byte(Mask)
+	}
+	return masked
+}
+
+func maskPath(v interface{}, path []string) interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		for i := range t {
+			t[i] = maskPath(t[i], path)
+		}
+	case map[string]interface{}:
+		for k := range t {
+			if path[0] != "*" && path[0] != strings.ToLower(k) {
+				continue
+			}
+			if len(path) == 1 {
+				t[k] = Mask
+				continue
+			}
+			t[k] = maskPath(t[k], path[1:])
+		}
+	}
+	return v
+}
@@ -0,0 +1,162 @@
+package redact_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ifreddyrondon/bastion/redact"
+)
+
+func TestNilRedactor(t *testing.T) {
+	t.Parallel()
+
+	var r *redact.Redactor
+	u, _ := url.Parse("/login?token=abc")
+	assert.Equal(t, "secret", r.String("secret"))
+	assert.Equal(t, "Bearer abc", r.Header("Authorization", "Bearer abc"))
+	assert.Equal(t, "/login?token=abc", r.URL(u))
+	assert.Equal(t, `{"password":"abc"}`, string(r.Body([]byte(`{"password":"abc"}`))))
+}
+
+func TestHeader(t *testing.T) {
+	t.Parallel()
+
+	r, err := redact.New(redact.Policy{
+		Headers:  []string{"authorization", "X-API-KEY"},
+		Patterns: []string{`\d{4}-\d{4}-\d{4}-\d{4}`},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, redact.Mask, r.Header("Authorization", "Bearer abc"))
+	assert.Equal(t, redact.Mask, r.Header("x-api-key", "abc"))
+	assert.Equal(t, "application/json", r.Header("Accept", "application/json"))
+	assert.Equal(t, "card [REDACTED]", r.Header("X-Card", "card 4111-1111-1111-1111"))
+}
+
+func TestURL(t *testing.T) {
+	t.Parallel()
+
+	r, err := redact.New(redact.Policy{
+		Query:    []string{"token", "api key"},
+		Patterns: []string{`secret-\w+`},
+	})
+	require.Nil(t, err)
+
+	tt := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"no query", "/users/secret-id", "/users/[REDACTED]"},
+		{"redacted param", "/login?user=bob&TOKEN=abc", "/login?user=bob&TOKEN=[REDACTED]"},
+		{"escaped param name", "/login?api+key=abc&page=1", "/login?api+key=[REDACTED]&page=1"},
+		{"param without value", "/login?token", "/login?token=[REDACTED]"},
+		{"pattern in query", "/search?q=secret-abc", "/search?q=[REDACTED]"},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			u, err := url.Parse(tc.url)
+			require.Nil(t, err)
+			assert.Equal(t, tc.expected, r.URL(u))
+		})
+	}
+}
+
+func TestBody(t *testing.T) {
+	t.Parallel()
+
+	r, err := redact.New(redact.Policy{
+		Fields:   []string{"password", "user.card.number", "tokens.*"},
+		Patterns: []string{`\w+@example\.com`},
+	})
+	require.Nil(t, err)
+
+	tt := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			"top level field",
+			`{"Password": "abc", "name": "bob"}`,
+			`{"Password":"[REDACTED]","name":"bob"}`,
+		},
+		{
+			"nested field through arrays",
+			`{"user": [{"card": {"number": 4111, "exp": "12/30"}}], "password": {"old": "a"}}`,
+			`{"password":"[REDACTED]","user":[{"card":{"exp":"12/30","number":"[REDACTED]"}}]}`,
+		},
+		{
+			"wildcard",
+			`{"tokens": {"access": "a", "refresh": "b"}, "count": 1.50}`,
+			`{"count":1.50,"tokens":{"access":"[REDACTED]","refresh":"[REDACTED]"}}`,
+		},
+		{
+			"top level array",
+			`[{"password": "a"}, {"password": "b"}]`,
+			`[{"password":"[REDACTED]"},{"password":"[REDACTED]"}]`,
+		},
+		{
+			"patterns",
+			`{"email": "bob@example.com"}`,
+			`{"email":"[REDACTED]"}`,
+		},
+		{
+			"not json",
+			`password=abc&email=bob@example.com`,
+			`[REDACTED]`,
+		},
+		{
+			"truncated json",
+			`{"name": "bob", "password": "ab`,
+			`[REDACTED]`,
+		},
+		{
+			"several json documents",
+			`{"password": "a"} {"password": "b"}`,
+			`[REDACTED]`,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, string(r.Body([]byte(tc.body))))
+		})
+	}
+}
+
+func TestBodyWithoutFields(t *testing.T) {
+	t.Parallel()
+
+	r, err := redact.New(redact.Policy{Patterns: []string{`\w+@example\.com`}})
+	require.Nil(t, err)
+	assert.Equal(t, `password=abc&email=[REDACTED]`, string(r.Body([]byte(`password=abc&email=bob@example.com`))))
+}
+
+func TestReferer(t *testing.T) {
+	t.Parallel()
+
+	r, err := redact.New(redact.Policy{
+		Query:    []string{"token"},
+		Patterns: []string{`secret-\w+`},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, "https://example.com/login?user=bob&token=[REDACTED]#top",
+		r.Header("referer", "https://example.com/login?user=bob&token=abc#top"))
+	assert.Equal(t, "https://example.com/[REDACTED]", r.Referer("https://example.com/secret-page"))
+	assert.Equal(t, "https://example.com/?q=[REDACTED]", r.Referer("https://example.com/?q=secret-abc"))
+}
+
+func TestNewBadPattern(t *testing.T) {
+	t.Parallel()
+
+	_, err := redact.New(redact.Policy{Patterns: []string{"("}})
+	assert.EqualError(t, err, "redact pattern \"(\": error parsing regexp: missing closing ): `(`")
+}
@@ -0,0 +1,293 @@
+package render
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Negotiate is the default Negotiator, it offers JSON, XML, YAML and plain text in that order.
+var Negotiate = NewNegotiator(
+	Offer("application/json", JSON),
+	Offer("application/xml", XML),
+	Offer("application/yaml", YAML),
+	Offer("text/plain", PlainText),
+)
+
+// Offer registers the renderer of the media type, ie. "application/vnd.api+json". The order of the offers
+// is the server preference when the Accept header ranks them equally, the first one is the default.
+func Offer(mediaType string, renderer APIRenderer) func(*Negotiator) {
+	return func(n *Negotiator) {
+		n.offers = append(n.offers, offer{mediaType: strings.ToLower(mediaType), renderer: renderer})
+	}
+}
+
+type offer struct {
+	mediaType string
+	renderer  APIRenderer
+}
+
+// Negotiator selects the renderer of a request by its Accept header, with q-values and wildcards. It
+// implements the APIRenderer interface rendering with the default offer, use For or ForRequest to
+// negotiate the renderer of a request.
+type Negotiator struct {
+	offers []offer
+}
+
+// NewNegotiator returns a new Negotiator instance with the offers.
+func NewNegotiator(opts ...func(*Negotiator)) *Negotiator {
+	n := &Negotiator{}
+	for _, o := range opts {
+		o(n)
+	}
+	return n
+}
+
+// MediaTypes returns the offered media types in order.
+func (n *Negotiator) MediaTypes() []string {
+	types := make([]string, len(n.offers))
+	for i, o := range n.offers {
+		types[i] = o.mediaType
+	}
+	return types
+}
+
+// For returns the APIRenderer of the request. It renders with the offer ranked highest by the Accept
+// header, or the default one when the header is missing, and sets "Vary: Accept". When no offer is
+// acceptable it responds 406 with the supported media types, rendered by the default offer.
+//
+//	render.Negotiate.For(r).Send(w, todo)
+func (n *Negotiator) For(r *http.Request) APIRenderer {
+	accept := strings.Join(r.Header["Accept"], ",")
+	return &negotiated{negotiator: n, renderer: n.match(accept)}
+}
+
+// match returns the renderer of the best offer for the accept header or nil when none is acceptable.
+func (n *Negotiator) match(accept string) APIRenderer {
+	if strings.TrimSpace(accept) == "" {
+		return n.fallback()
+	}
+	ranges := parseAccept(accept)
+	var best APIRenderer
+	var bestQ float64
+	for _, o := range n.offers {
+		if q := quality(ranges, o.mediaType); q > bestQ {
+			best, bestQ = o.renderer, q
+		}
+	}
+	return best
+}
+
+// ForRequest returns the renderer of the errors of a request, ie. the ErrorRenderer of the app. When the
+// renderer is a *Negotiator it's negotiated by the Accept header like For and sets "Vary: Accept", but the
+// errors keep their status, so the default offer is used when no offer is acceptable instead of responding
+// 406. Any other renderer is returned as is.
+func ForRequest(renderer APIRenderer, r *http.Request) APIRenderer {
+	n, ok := renderer.(*Negotiator)
+	if !ok {
+		return renderer
+	}
+	selected := n.match(strings.Join(r.Header["Accept"], ","))
+	if selected == nil {
+		selected = n.fallback()
+	}
+	return &negotiated{negotiator: n, renderer: selected}
+}
+
+// Selected returns the renderer negotiated by For or ForRequest, nil when no offer is acceptable. Any
+// other renderer is returned as is.
+func Selected(renderer APIRenderer) APIRenderer {
+	if n, ok := renderer.(*negotiated); ok {
+		return n.renderer
+	}
+	return renderer
+}
+
+func (n *Negotiator) fallback() APIRenderer {
+	if len(n.offers) == 0 {
+		return JSON
+	}
+	return n.offers[0].renderer
+}
+
+func (n *Negotiator) notAcceptable(w http.ResponseWriter) {
+	s := http.StatusNotAcceptable
+	types := n.MediaTypes()
+	res := NewHTTPError(fmt.Sprintf("supported media types: %v", strings.Join(types, ", ")), http.StatusText(s), s)
+	res.Details = types
+	n.fallback().Response(w, s, res)
+}
+
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept returns the media ranges of the accept header, the ones with an invalid q-value are ignored.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mt := strings.ToLower(strings.TrimSpace(params[0]))
+		if mt == "*" {
+			mt = "*/*"
+		}
+		slash := strings.IndexByte(mt, '/')
+		if slash == -1 {
+			continue
+		}
+		mr := mediaRange{typ: mt[:slash], subtype: mt[slash+1:], q: 1}
+		valid := true
+		for _, param := range params[1:] {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 || strings.ToLower(strings.TrimSpace(kv[0])) != "q" {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+			if err != nil || q < 0 || q > 1 {
+				valid = false
+				break
+			}
+			mr.q = q
+		}
+		if valid {
+			ranges = append(ranges, mr)
+		}
+	}
+	return ranges
+}
+
+// quality returns the q-value of the most specific range that matches the media type, 0 when none does.
+func quality(ranges []mediaRange, mediaType string) float64 {
+	slash := strings.IndexByte(mediaType, '/')
+	if slash == -1 {
+		return 0
+	}
+	typ, subtype := mediaType[:slash], mediaType[slash+1:]
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*" && r.subtype == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
+
+// negotiated renders with the renderer selected for a request or responds 406 when it's nil.
+type negotiated struct {
+	negotiator *Negotiator
+	renderer   APIRenderer
+}
+
+// render labels the response with the negotiated content type, even if the handler had set another one.
+func (n *negotiated) render(w http.ResponseWriter, fn func(APIRenderer)) {
+	addVary(w, "Accept")
+	w.Header().Del("Content-Type")
+	if n.renderer == nil {
+		n.negotiator.notAcceptable(w)
+		return
+	}
+	fn(n.renderer)
+}
+
+func addVary(w http.ResponseWriter, value string) {
+	for _, v := range w.Header()["Vary"] {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) {
+				return
+			}
+		}
+	}
+	w.Header().Add("Vary", value)
+}
+
+// Response sends v with the negotiated renderer and the HTTP status code.
+func (n *negotiated) Response(w http.ResponseWriter, code int, v interface{}) {
+	n.render(w, func(r APIRenderer) { r.Response(w, code, v) })
+}
+
+// Send sends v with the negotiated renderer and the 200 status code.
+func (n *negotiated) Send(w http.ResponseWriter, v interface{}) {
+	n.render(w, func(r APIRenderer) { r.Send(w, v) })
+}
+
+// Created sends v with the negotiated renderer and the 201 status code.
+func (n *negotiated) Created(w http.ResponseWriter, v interface{}) {
+	n.render(w, func(r APIRenderer) { r.Created(w, v) })
+}
+
+// NoContent sends the 204 status code, it's never not acceptable.
+func (n *negotiated) NoContent(w http.ResponseWriter) {
+	addVary(w, "Accept")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BadRequest sends the error with the negotiated renderer and the 400 status code.
+func (n *negotiated) BadRequest(w http.ResponseWriter, err error) {
+	n.render(w, func(r APIRenderer) { r.BadRequest(w, err) })
+}
+
+// NotFound sends the error with the negotiated renderer and the 404 status code.
+func (n *negotiated) NotFound(w http.ResponseWriter, err error) {
+	n.render(w, func(r APIRenderer) { r.NotFound(w, err) })
+}
+
+// MethodNotAllowed sends the error with the negotiated renderer and the 405 status code.
+func (n *negotiated) MethodNotAllowed(w http.ResponseWriter, err error) {
+	n.render(w, func(r APIRenderer) { r.MethodNotAllowed(w, err) })
+}
+
+// InternalServerError sends the error with the negotiated renderer and the 500 status code.
+func (n *negotiated) InternalServerError(w http.ResponseWriter, err error) {
+	n.render(w, func(r APIRenderer) { r.InternalServerError(w, err) })
+}
+
+// Response sends v with the default offer and the HTTP status code.
+func (n *Negotiator) Response(w http.ResponseWriter, code int, v interface{}) {
+	n.fallback().Response(w, code, v)
+}
+
+// Send sends v with the default offer and the 200 status code.
+func (n *Negotiator) Send(w http.ResponseWriter, v interface{}) {
+	n.fallback().Send(w, v)
+}
+
+// Created sends v with the default offer and the 201 status code.
+func (n *Negotiator) Created(w http.ResponseWriter, v interface{}) {
+	n.fallback().Created(w, v)
+}
+
+// NoContent sends the 204 status code.
+func (n *Negotiator) NoContent(w http.ResponseWriter) {
+	n.fallback().NoContent(w)
+}
+
+// BadRequest sends the error with the default offer and the 400 status code.
+func (n *Negotiator) BadRequest(w http.ResponseWriter, err error) {
+	n.fallback().BadRequest(w, err)
+}
+
+// NotFound sends the error with the default offer and the 404 status code.
+func (n *Negotiator) NotFound(w http.ResponseWriter, err error) {
+	n.fallback().NotFound(w, err)
+}
+
+// MethodNotAllowed sends the error with the default offer and the 405 status code.
+func (n *Negotiator) MethodNotAllowed(w http.ResponseWriter, err error) {
+	n.fallback().MethodNotAllowed(w, err)
+}
+
+// InternalServerError sends the error with the default offer and the 500 status code.
+func (n *Negotiator) InternalServerError(w http.ResponseWriter, err error) {
+	n.fallback().InternalServerError(w, err)
+}
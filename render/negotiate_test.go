@@ -0,0 +1,212 @@
+package render_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gavv/httpexpect.v1"
+
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+type greeting struct {
+	Hello string `json:"hello" xml:"hello" yaml:"hello"`
+}
+
+func TestNegotiate(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		accept      []string
+		contentType string
+	}{
+		{"missing accept uses the default", nil, "application/json"},
+		{"exact match", []string{"application/xml"}, "application/xml"},
+		{"case insensitive", []string{"Application/YAML"}, "application/yaml"},
+		{"highest q-value", []string{"application/json;q=0.5, text/plain;q=0.9"}, "text/plain"},
+		{"server preference on ties", []string{"text/plain, application/xml"}, "application/xml"},
+		{"type wildcard", []string{"text/*"}, "text/plain"},
+		{"any wildcard", []string{"*/*"}, "application/json"},
+		{"any wildcard without subtype", []string{"*"}, "application/json"},
+		{"specific range excludes with q=0", []string{"application/json;q=0, */*;q=0.1"}, "application/xml"},
+		{"several accept headers", []string{"text/html", "application/yaml"}, "application/yaml"},
+		{"params besides q", []string{"application/xml; charset=utf-8; q=0.8, application/json; q=0.7"}, "application/xml"},
+		{"invalid q-value ignored", []string{"application/json;q=2, application/yaml;q=0.1"}, "application/yaml"},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, accept := range tc.accept {
+				req.Header.Add("Accept", accept)
+			}
+			rr := httptest.NewRecorder()
+			render.Negotiate.For(req).Send(rr, greeting{Hello: "world"})
+			httpexpect.NewResponse(t, rr.Result()).
+				Status(http.StatusOK).
+				ContentType(tc.contentType, "utf-8").
+				Header("Vary").Equal("Accept")
+		})
+	}
+}
+
+func TestNegotiateNotAcceptable(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/html, application/json;q=0")
+	rr := httptest.NewRecorder()
+	render.Negotiate.For(req).Send(rr, greeting{Hello: "world"})
+	httpexpect.NewResponse(t, rr.Result()).
+		Status(http.StatusNotAcceptable).
+		ContentType("application/json", "utf-8").
+		JSON().Object().Equal(map[string]interface{}{
+		"message": "supported media types: application/json, application/xml, application/yaml, text/plain",
+		"error":   "Not Acceptable",
+		"status":  406,
+		"details": []string{"application/json", "application/xml", "application/yaml", "text/plain"},
+	})
+
+	rr = httptest.NewRecorder()
+	render.Negotiate.For(req).NoContent(rr)
+	httpexpect.NewResponse(t, rr.Result()).Status(http.StatusNoContent).Header("Vary").Equal("Accept")
+}
+
+func TestNegotiateCustomOffers(t *testing.T) {
+	t.Parallel()
+
+	n := render.NewNegotiator(
+		render.Offer("application/problem+json", render.ProblemJSON),
+		render.Offer("application/problem+xml", render.ProblemXML),
+	)
+	assert.Equal(t, []string{"application/problem+json", "application/problem+xml"}, n.MediaTypes())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/problem+xml")
+	rr := httptest.NewRecorder()
+	rr.Header().Set("Vary", "Origin, accept")
+	n.For(req).NotFound(rr, errors.New("todo not found"))
+	res := httpexpect.NewResponse(t, rr.Result())
+	res.Status(http.StatusNotFound).ContentType("application/problem+xml", "utf-8").
+		Body().Contains("<detail>todo not found</detail>")
+	res.Header("Vary").Equal("Origin, accept")
+
+	req.Header.Set("Accept", "application/json")
+	rr = httptest.NewRecorder()
+	n.For(req).Send(rr, "hello")
+	httpexpect.NewResponse(t, rr.Result()).
+		Status(http.StatusNotAcceptable).
+		ContentType("application/problem+json", "utf-8").
+		Body().Contains(`"detail":"supported media types: application/problem+json, application/problem+xml"`)
+}
+
+func TestNegotiateErrors(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/plain")
+	renderer := render.Negotiate.For(req)
+
+	tt := []struct {
+		name   string
+		render func(http.ResponseWriter)
+		status int
+	}{
+		{"bad request", func(w http.ResponseWriter) { renderer.BadRequest(w, errors.New("failed")) }, http.StatusBadRequest},
+		{"not found", func(w http.ResponseWriter) { renderer.NotFound(w, errors.New("failed")) }, http.StatusNotFound},
+		{"method not allowed", func(w http.ResponseWriter) { renderer.MethodNotAllowed(w, errors.New("failed")) }, http.StatusMethodNotAllowed},
+		{"internal server error", func(w http.ResponseWriter) { renderer.InternalServerError(w, errors.New("failed")) }, http.StatusInternalServerError},
+		{"created", func(w http.ResponseWriter) { renderer.Created(w, "failed") }, http.StatusCreated},
+		{"response", func(w http.ResponseWriter) { renderer.Response(w, http.StatusAccepted, "failed") }, http.StatusAccepted},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			rr := httptest.NewRecorder()
+			tc.render(rr)
+			httpexpect.NewResponse(t, rr.Result()).
+				Status(tc.status).
+				ContentType("text/plain", "utf-8").
+				Text().Equal("failed")
+		})
+	}
+}
+
+func TestNegotiatorRendersDefaultOffer(t *testing.T) {
+	t.Parallel()
+
+	var renderer render.APIRenderer = render.Negotiate
+	rr := httptest.NewRecorder()
+	renderer.NotFound(rr, errors.New("todo not found"))
+	httpexpect.NewResponse(t, rr.Result()).
+		Status(http.StatusNotFound).
+		ContentType("application/json", "utf-8").
+		JSON().Object().ValueEqual("message", "todo not found")
+}
+
+func TestSelected(t *testing.T) {
+	t.Parallel()
+
+	n := render.NewNegotiator(render.Offer("application/problem+json", render.ProblemJSON), render.Offer("application/json", render.JSON))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/json")
+	assert.Equal(t, render.JSON, render.Selected(n.For(req)))
+	assert.Equal(t, render.ProblemJSON, render.Selected(render.ForRequest(n, httptest.NewRequest(http.MethodGet, "/", nil))))
+	req.Header.Set("Accept", "text/csv")
+	assert.Nil(t, render.Selected(n.For(req)))
+	assert.Equal(t, render.XML, render.Selected(render.XML))
+}
+
+func TestForRequest(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		renderer    render.APIRenderer
+		accept      string
+		contentType string
+		vary        string
+	}{
+		{"negotiated", render.Negotiate, "application/xml", "application/xml", "Accept"},
+		{"not acceptable uses the default", render.Negotiate, "text/csv", "application/json", "Accept"},
+		{"other renderers as is", render.XML, "application/json", "application/xml", ""},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", tc.accept)
+			rr := httptest.NewRecorder()
+			render.ForRequest(tc.renderer, req).NotFound(rr, errors.New("todo not found"))
+			httpexpect.NewResponse(t, rr.Result()).
+				Status(http.StatusNotFound).
+				ContentType(tc.contentType, "utf-8").
+				Header("Vary").Equal(tc.vary)
+		})
+	}
+}
+
+func TestNegotiateOverridesContentType(t *testing.T) {
+	t.Parallel()
+
+	for _, accept := range []string{"application/xml", "application/yaml"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		rr.Header().Set("Content-Type", "application/json")
+		render.ForRequest(render.Negotiate, req).InternalServerError(rr, errors.New("failed"))
+		httpexpect.NewResponse(t, rr.Result()).
+			Status(http.StatusInternalServerError).
+			ContentType(accept, "utf-8")
+	}
+}
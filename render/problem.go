@@ -0,0 +1,261 @@
+package render
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	problemJSONContentType = "application/problem+json; charset=utf-8"
+	problemXMLContentType  = "application/problem+xml; charset=utf-8"
+	// ProblemXMLNamespace is the namespace of the problem details XML documents.
+	ProblemXMLNamespace = "urn:ietf:rfc:7807"
+	// ProblemDefaultType is the type of the problems without a more specific semantic than the status code.
+	ProblemDefaultType = "about:blank"
+)
+
+// Problem is a problem details object as defined by RFC 7807 (https://tools.ietf.org/html/rfc7807).
+type Problem struct {
+	// Type is an URI reference that identifies the problem type. Default "about:blank".
+	Type string
+	// Title is a short summary of the problem type. Default the status text.
+	Title string
+	// Status is the HTTP status code.
+	Status int
+	// Detail is an explanation specific to this occurrence of the problem.
+	Detail string
+	// Instance is an URI reference that identifies this occurrence of the problem, ie. the request path.
+	Instance string
+	// Extensions are additional members of the problem. The members named as the standard ones are ignored.
+	Extensions map[string]interface{}
+}
+
+// NewProblem returns a Problem with the status, the detail and the default type and title.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Type:   ProblemDefaultType,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// With set the extension member name.
+func (p *Problem) With(name string, value interface{}) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = map[string]interface{}{}
+	}
+	p.Extensions[name] = value
+	return p
+}
+
+func (p *Problem) members() map[string]interface{} {
+	m := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	for k := range problemStandardMembers {
+		delete(m, k)
+	}
+	m["type"] = ProblemDefaultType
+	if p.Type != "" {
+		m["type"] = p.Type
+	}
+	if p.Title != "" {
+		m["title"] = p.Title
+	}
+	if p.Status != 0 {
+		m["status"] = p.Status
+	}
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return m
+}
+
+// MarshalJSON encodes the standard and the extension members in a single object.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.members())
+}
+
+// MarshalXML encodes the problem as defined in the RFC 7807 appendix A, the members are elements of the
+// problem element and the arrays items are "i" elements.
+func (p *Problem) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	start := xml.StartElement{Name: xml.Name{Local: "problem"}, Attr: []xml.Attr{
+		{Name: xml.Name{Local: "xmlns"}, Value: ProblemXMLNamespace},
+	}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	members := p.members()
+	for _, name := range problemMemberNames(members) {
+		if err := encodeXMLMember(e, name, members[name]); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+var problemStandardMembers = map[string]int{"type": 0, "title": 1, "status": 2, "detail": 3, "instance": 4}
+
+// problemMemberNames returns the standard members first and then the extensions sorted by name.
+func problemMemberNames(members map[string]interface{}) []string {
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		oi, iStandard := problemStandardMembers[names[i]]
+		oj, jStandard := problemStandardMembers[names[j]]
+		if iStandard != jStandard {
+			return iStandard
+		}
+		if iStandard {
+			return oi < oj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func encodeXMLMember(e *xml.Encoder, name string, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("render problem member %v: unsupported map key %v", name, rv.Type().Key())
+		}
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := make([]string, 0, rv.Len())
+		for _, k := range rv.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := encodeXMLMember(e, k, rv.MapIndex(reflect.ValueOf(k).Convert(rv.Type().Key())).Interface()); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return e.EncodeElement(v, start)
+		}
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := encodeXMLMember(e, "i", rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	default:
+		return e.EncodeElement(v, start)
+	}
+}
+
+// NewProblemJSON returns a ProblemRenderer of "application/problem+json" errors, the other responses are
+// rendered by a JSONRender with the options.
+func NewProblemJSON(opts ...func(*JSONRender)) *ProblemRenderer {
+	return &ProblemRenderer{renderer: NewJSON(opts...), contentType: problemJSONContentType}
+}
+
+// NewProblemXML returns a ProblemRenderer of "application/problem+xml" errors, the other responses are
+// rendered by a XMLRenderer with the options.
+func NewProblemXML(opts ...func(*XMLRenderer)) *ProblemRenderer {
+	return &ProblemRenderer{renderer: NewXML(opts...), contentType: problemXMLContentType}
+}
+
+// ProblemJSON is the default problem+json renderer.
+var ProblemJSON = NewProblemJSON()
+
+// ProblemXML is the default problem+xml renderer.
+var ProblemXML = NewProblemXML()
+
+// ProblemRenderer renders the errors as RFC 7807 problem details and implements the APIRenderer interface.
+// The *Problem and *HTTPError responses are rendered as problems, the code and details of the HTTPError
+// are extension members.
+type ProblemRenderer struct {
+	renderer    Renderer
+	contentType string
+}
+
+// Response sends v in the body of a request with the HTTP status code.
+func (p *ProblemRenderer) Response(w http.ResponseWriter, code int, v interface{}) {
+	// a problem is always labelled as such, even if the handler set another content type
+	switch t := v.(type) {
+	case *Problem:
+		w.Header().Set("Content-Type", p.contentType)
+	case *HTTPError:
+		v = problemFromHTTPError(t)
+		w.Header().Set("Content-Type", p.contentType)
+	}
+	p.renderer.Response(w, code, v)
+}
+
+func problemFromHTTPError(e *HTTPError) *Problem {
+	problem := NewProblem(e.Status, e.Message)
+	problem.Title = e.Error
+	if e.Code != "" {
+		problem.With("code", e.Code)
+	}
+	if e.Details != nil {
+		problem.With("details", e.Details)
+	}
+	return problem
+}
+
+// MediaType returns the media type of the problems, ie. "application/problem+json".
+func (p *ProblemRenderer) MediaType() string {
+	return strings.TrimSuffix(p.contentType, "; charset=utf-8")
+}
+
+// Send sends v in the body of a request with the 200 status code.
+func (p *ProblemRenderer) Send(w http.ResponseWriter, v interface{}) {
+	p.Response(w, http.StatusOK, v)
+}
+
+// Created sends v in the body of a request with the 201 status code.
+func (p *ProblemRenderer) Created(w http.ResponseWriter, v interface{}) {
+	p.Response(w, http.StatusCreated, v)
+}
+
+// NoContent sends a v without no content with the 204 status code.
+func (p *ProblemRenderer) NoContent(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BadRequest sends a problem with the 400 status code and the error as detail.
+func (p *ProblemRenderer) BadRequest(w http.ResponseWriter, err error) {
+	p.Response(w, http.StatusBadRequest, NewProblem(http.StatusBadRequest, err.Error()))
+}
+
+// NotFound sends a problem with the 404 status code and the error as detail.
+func (p *ProblemRenderer) NotFound(w http.ResponseWriter, err error) {
+	p.Response(w, http.StatusNotFound, NewProblem(http.StatusNotFound, err.Error()))
+}
+
+// MethodNotAllowed sends a problem with the 405 status code and the error as detail.
+func (p *ProblemRenderer) MethodNotAllowed(w http.ResponseWriter, err error) {
+	p.Response(w, http.StatusMethodNotAllowed, NewProblem(http.StatusMethodNotAllowed, err.Error()))
+}
+
+// InternalServerError sends a problem with the 500 status code and the error as detail.
+func (p *ProblemRenderer) InternalServerError(w http.ResponseWriter, err error) {
+	p.Response(w, http.StatusInternalServerError, NewProblem(http.StatusInternalServerError, err.Error()))
+}
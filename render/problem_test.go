@@ -0,0 +1,246 @@
+package render_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/gavv/httpexpect.v1"
+
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+func TestProblemMarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name     string
+		problem  *render.Problem
+		expected string
+	}{
+		{
+			"default members",
+			render.NewProblem(http.StatusNotFound, "todo 1 not found"),
+			`{"type":"about:blank","title":"Not Found","status":404,"detail":"todo 1 not found"}`,
+		},
+		{
+			"every member with extensions",
+			&render.Problem{
+				Type:     "https://example.com/probs/out-of-credit",
+				Title:    "You do not have enough credit.",
+				Status:   http.StatusForbidden,
+				Detail:   "Your current balance is 30, but that costs 50.",
+				Instance: "/account/12345/msgs/abc",
+				Extensions: map[string]interface{}{
+					"balance":  30,
+					"accounts": []string{"/account/12345", "/account/67890"},
+				},
+			},
+			`{
+				"type": "https://example.com/probs/out-of-credit",
+				"title": "You do not have enough credit.",
+				"status": 403,
+				"detail": "Your current balance is 30, but that costs 50.",
+				"instance": "/account/12345/msgs/abc",
+				"balance": 30,
+				"accounts": ["/account/12345", "/account/67890"]
+			}`,
+		},
+		{
+			"extensions don't override standard members",
+			render.NewProblem(http.StatusBadRequest, "").With("status", 200).With("type", "other"),
+			`{"type":"about:blank","title":"Bad Request","status":400}`,
+		},
+		{
+			"empty type",
+			&render.Problem{Status: http.StatusConflict},
+			`{"type":"about:blank","status":409}`,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			b, err := json.Marshal(tc.problem)
+			require.Nil(t, err)
+			assert.JSONEq(t, tc.expected, string(b))
+		})
+	}
+}
+
+func TestProblemJSONResponse(t *testing.T) {
+	t.Parallel()
+
+	rr := httptest.NewRecorder()
+	p := render.NewProblem(http.StatusForbidden, "not the owner")
+	p.Instance = "/todos/1"
+	render.ProblemJSON.Response(rr, http.StatusForbidden, p.With("owner", "bob"))
+	body := httpexpect.NewResponse(t, rr.Result()).
+		Status(http.StatusForbidden).
+		ContentType("application/problem+json", "utf-8").
+		Body().Raw()
+	assert.JSONEq(t, `{
+		"type": "about:blank",
+		"title": "Forbidden",
+		"status": 403,
+		"detail": "not the owner",
+		"instance": "/todos/1",
+		"owner": "bob"
+	}`, body)
+}
+
+func TestProblemJSONErrors(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name     string
+		render   func(http.ResponseWriter)
+		status   int
+		expected string
+	}{
+		{
+			"bad request",
+			func(w http.ResponseWriter) { render.ProblemJSON.BadRequest(w, errors.New("invalid todo")) },
+			http.StatusBadRequest,
+			`{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid todo"}`,
+		},
+		{
+			"not found",
+			func(w http.ResponseWriter) { render.ProblemJSON.NotFound(w, errors.New("todo not found")) },
+			http.StatusNotFound,
+			`{"type":"about:blank","title":"Not Found","status":404,"detail":"todo not found"}`,
+		},
+		{
+			"method not allowed",
+			func(w http.ResponseWriter) { render.ProblemJSON.MethodNotAllowed(w, errors.New("POST not allowed")) },
+			http.StatusMethodNotAllowed,
+			`{"type":"about:blank","title":"Method Not Allowed","status":405,"detail":"POST not allowed"}`,
+		},
+		{
+			"internal server error",
+			func(w http.ResponseWriter) { render.ProblemJSON.InternalServerError(w, errors.New("boom")) },
+			http.StatusInternalServerError,
+			`{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"boom"}`,
+		},
+		{
+			"http error with code and details",
+			func(w http.ResponseWriter) {
+				e := render.NewHTTPError("invalid todo", "Bad Request", http.StatusBadRequest)
+				e.Code = "invalid_todo"
+				e.Details = map[string]string{"description": "required"}
+				render.ProblemJSON.Response(w, http.StatusBadRequest, e)
+			},
+			http.StatusBadRequest,
+			`{
+				"type": "about:blank",
+				"title": "Bad Request",
+				"status": 400,
+				"detail": "invalid todo",
+				"code": "invalid_todo",
+				"details": {"description": "required"}
+			}`,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			rr := httptest.NewRecorder()
+			tc.render(rr)
+			body := httpexpect.NewResponse(t, rr.Result()).
+				Status(tc.status).
+				ContentType("application/problem+json", "utf-8").
+				Body().Raw()
+			assert.JSONEq(t, tc.expected, body)
+		})
+	}
+}
+
+func TestProblemJSONSuccess(t *testing.T) {
+	t.Parallel()
+
+	rr := httptest.NewRecorder()
+	render.NewProblemJSON(render.PrettyPrintJSON()).Created(rr, map[string]string{"id": "1"})
+	httpexpect.NewResponse(t, rr.Result()).
+		Status(http.StatusCreated).
+		ContentType("application/json", "utf-8").
+		Body().Equal("{\n  \"id\": \"1\"\n}\n")
+
+	rr = httptest.NewRecorder()
+	render.ProblemJSON.NoContent(rr)
+	httpexpect.NewResponse(t, rr.Result()).Status(http.StatusNoContent).NoContent()
+}
+
+func TestProblemXMLResponse(t *testing.T) {
+	t.Parallel()
+
+	rr := httptest.NewRecorder()
+	p := &render.Problem{
+		Type:     "https://example.com/probs/out-of-credit",
+		Title:    "You do not have enough credit.",
+		Status:   http.StatusForbidden,
+		Instance: "/account/12345/msgs/abc",
+		Extensions: map[string]interface{}{
+			"balance":  30,
+			"accounts": []string{"/account/12345", "/account/67890"},
+			"limits":   map[string]int{"monthly": 100},
+		},
+	}
+	render.ProblemXML.Response(rr, http.StatusForbidden, p)
+	httpexpect.NewResponse(t, rr.Result()).
+		Status(http.StatusForbidden).
+		ContentType("application/problem+xml", "utf-8").
+		Body().
+		Equal(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+			`<problem xmlns="urn:ietf:rfc:7807">` +
+			`<type>https://example.com/probs/out-of-credit</type>` +
+			`<title>You do not have enough credit.</title>` +
+			`<status>403</status>` +
+			`<instance>/account/12345/msgs/abc</instance>` +
+			`<accounts><i>/account/12345</i><i>/account/67890</i></accounts>` +
+			`<balance>30</balance>` +
+			`<limits><monthly>100</monthly></limits>` +
+			`</problem>`)
+}
+
+func TestProblemXMLHTTPError(t *testing.T) {
+	t.Parallel()
+
+	rr := httptest.NewRecorder()
+	e := render.NewHTTPError("todo not found", "Not Found", http.StatusNotFound)
+	e.Code = "todo_not_found"
+	render.ProblemXML.Response(rr, http.StatusNotFound, e)
+	httpexpect.NewResponse(t, rr.Result()).
+		Status(http.StatusNotFound).
+		ContentType("application/problem+xml", "utf-8").
+		Body().
+		Contains(`<detail>todo not found</detail><code>todo_not_found</code></problem>`)
+}
+
+func TestProblemXMLUnsupportedMember(t *testing.T) {
+	t.Parallel()
+
+	rr := httptest.NewRecorder()
+	render.ProblemXML.Response(rr, http.StatusBadRequest,
+		render.NewProblem(http.StatusBadRequest, "").With("ids", map[int]string{1: "a"}))
+	httpexpect.NewResponse(t, rr.Result()).
+		Status(http.StatusInternalServerError).
+		Body().Contains("unsupported map key int")
+}
+
+func TestProblemJSONOverridesContentType(t *testing.T) {
+	t.Parallel()
+
+	rr := httptest.NewRecorder()
+	rr.Header().Set("Content-Type", "application/json")
+	render.ProblemJSON.NotFound(rr, errors.New("todo not found"))
+	httpexpect.NewResponse(t, rr.Result()).
+		Status(http.StatusNotFound).
+		ContentType("application/problem+json", "utf-8")
+}
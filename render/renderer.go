@@ -1,6 +1,10 @@
 package render
 
-import "net/http"
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+)
 
 // StringRenderer interface manage string responses.
 type StringRenderer interface {
@@ -49,9 +53,48 @@ type ServerErrRenderer interface {
 
 // HTTPError represents an error that occurred while handling a request.
 type HTTPError struct {
-	Message string `json:"message,omitempty" xml:"message,attr,omitempty"`
-	Error   string `json:"error,omitempty" xml:"error,attr,omitempty"`
-	Status  int    `json:"status,omitempty" xml:"status,attr,omitempty"`
+	Message string `json:"message,omitempty" xml:"message,attr,omitempty" yaml:"message,omitempty"`
+	Error   string `json:"error,omitempty" xml:"error,attr,omitempty" yaml:"error,omitempty"`
+	Status  int    `json:"status,omitempty" xml:"status,attr,omitempty" yaml:"status,omitempty"`
+	// Code is an optional machine readable identifier of the error.
+	Code string `json:"code,omitempty" xml:"code,attr,omitempty" yaml:"code,omitempty"`
+	// Details are optional data about the error, ie. the invalid fields. In XML they are the details
+	// element, the arrays items are "i" elements.
+	Details interface{} `json:"details,omitempty" xml:"-" yaml:"details,omitempty"`
+}
+
+// MarshalXML encodes the message, error, status and code as attributes and the details as child elements.
+func (e *HTTPError) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	if start.Name.Local == "" {
+		start.Name.Local = "HTTPError"
+	}
+	attr := func(name, value string) {
+		if value != "" {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+		}
+	}
+	attr("message", e.Message)
+	attr("error", e.Error)
+	if e.Status != 0 {
+		attr("status", strconv.Itoa(e.Status))
+	}
+	attr("code", e.Code)
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := encodeXMLMember(enc, "details", e.Details); err != nil {
+		return err
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// UnsupportedMediaType sends the error with the 415 status code and the supported media types as details,
+// ie. for the *binder.UnsupportedMediaTypeError.
+func UnsupportedMediaType(r Renderer, w http.ResponseWriter, err error, supported []string) {
+	s := http.StatusUnsupportedMediaType
+	res := NewHTTPError(err.Error(), http.StatusText(s), s)
+	res.Details = supported
+	r.Response(w, s, res)
 }
 
 // NewHTTPError returns a new HTTPError instance.
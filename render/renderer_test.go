@@ -0,0 +1,66 @@
+package render_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/gavv/httpexpect.v1"
+
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+func TestUnsupportedMediaType(t *testing.T) {
+	t.Parallel()
+
+	err := errors.New(`unsupported media type "text/plain"`)
+	supported := []string{"application/json", "application/xml"}
+
+	tt := []struct {
+		name        string
+		renderer    render.Renderer
+		contentType string
+		expected    string
+	}{
+		{
+			"json",
+			render.JSON,
+			"application/json",
+			`{"message":"unsupported media type \"text/plain\"","error":"Unsupported Media Type","status":415,"details":["application/json","application/xml"]}` + "\n",
+		},
+		{
+			"xml",
+			render.XML,
+			"application/xml",
+			"<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<HTTPError message=\"unsupported media type &#34;text/plain&#34;\" error=\"Unsupported Media Type\" status=\"415\">" +
+				"<details><i>application/json</i><i>application/xml</i></details></HTTPError>",
+		},
+		{
+			"problem json",
+			render.ProblemJSON,
+			"application/problem+json",
+			`{"detail":"unsupported media type \"text/plain\"","details":["application/json","application/xml"],"status":415,"title":"Unsupported Media Type","type":"about:blank"}` + "\n",
+		},
+		{
+			"problem xml",
+			render.ProblemXML,
+			"application/problem+xml",
+			"<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<problem xmlns=\"urn:ietf:rfc:7807\"><type>about:blank</type><title>Unsupported Media Type</title>" +
+				"<status>415</status><detail>unsupported media type &#34;text/plain&#34;</detail>" +
+				"<details><i>application/json</i><i>application/xml</i></details></problem>",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			render.UnsupportedMediaType(tc.renderer, rr, err, supported)
+			httpexpect.NewResponse(t, rr.Result()).
+				Status(http.StatusUnsupportedMediaType).
+				ContentType(tc.contentType, "utf-8").
+				Body().
+				Equal(tc.expected)
+		})
+	}
+}
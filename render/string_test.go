@@ -1,6 +1,7 @@
 package render_test
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -24,3 +25,40 @@ func TestHTMLResponse(t *testing.T) {
 	httpexpect.NewResponse(t, rr.Result()).
 		Status(http.StatusOK).ContentType("text/html", "utf-8")
 }
+
+func TestPlainTextAPIResponse(t *testing.T) {
+	tt := []struct {
+		name     string
+		render   func(http.ResponseWriter)
+		status   int
+		expected string
+	}{
+		{"string", func(w http.ResponseWriter) { render.PlainText.Send(w, "test") }, http.StatusOK, "test"},
+		{"bytes", func(w http.ResponseWriter) { render.PlainText.Created(w, []byte("created")) }, http.StatusCreated, "created"},
+		{"any value", func(w http.ResponseWriter) { render.PlainText.Send(w, []int{1, 2}) }, http.StatusOK, "[1 2]"},
+		{
+			"http error",
+			func(w http.ResponseWriter) {
+				render.PlainText.Response(w, http.StatusConflict, render.NewHTTPError("todo exists", "Conflict", 409))
+			},
+			http.StatusConflict,
+			"todo exists",
+		},
+		{
+			"bad request",
+			func(w http.ResponseWriter) { render.PlainText.BadRequest(w, errors.New("invalid todo")) },
+			http.StatusBadRequest,
+			"invalid todo",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tc.render(rr)
+			httpexpect.NewResponse(t, rr.Result()).
+				Status(tc.status).ContentType("text/plain", "utf-8").
+				Text().Equal(tc.expected)
+		})
+	}
+}
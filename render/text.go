@@ -0,0 +1,65 @@
+package render
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// PlainText is the default text renderer of API responses.
+var PlainText = &TextRenderer{}
+
+// TextRenderer encode the response as "text/plain" content type, the strings, []byte and fmt.Stringer
+// as they are, the *HTTPError as its message and any other value with its default format.
+// It implements the Renderer and APIRenderer interface.
+type TextRenderer struct{}
+
+// Response sends v as text in the body of a request with the HTTP status code.
+func (t *TextRenderer) Response(w http.ResponseWriter, code int, v interface{}) {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case *HTTPError:
+		s = v.Message
+	default:
+		s = fmt.Sprint(v)
+	}
+	Text.Response(w, code, s)
+}
+
+// Send sends v as text in the body of a request with the 200 status code.
+func (t *TextRenderer) Send(w http.ResponseWriter, v interface{}) {
+	t.Response(w, http.StatusOK, v)
+}
+
+// Created sends v as text in the body of a request with the 201 status code.
+func (t *TextRenderer) Created(w http.ResponseWriter, v interface{}) {
+	t.Response(w, http.StatusCreated, v)
+}
+
+// NoContent sends a v without no content with the 204 status code.
+func (t *TextRenderer) NoContent(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BadRequest sends the error message in the body of a request with the 400 status code.
+func (t *TextRenderer) BadRequest(w http.ResponseWriter, err error) {
+	t.Response(w, http.StatusBadRequest, err.Error())
+}
+
+// NotFound sends the error message in the body of a request with the 404 status code.
+func (t *TextRenderer) NotFound(w http.ResponseWriter, err error) {
+	t.Response(w, http.StatusNotFound, err.Error())
+}
+
+// MethodNotAllowed sends the error message in the body of a request with the 405 status code.
+func (t *TextRenderer) MethodNotAllowed(w http.ResponseWriter, err error) {
+	t.Response(w, http.StatusMethodNotAllowed, err.Error())
+}
+
+// InternalServerError sends the error message in the body of a request with the 500 status code.
+func (t *TextRenderer) InternalServerError(w http.ResponseWriter, err error) {
+	t.Response(w, http.StatusInternalServerError, err.Error())
+}
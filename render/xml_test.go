@@ -157,3 +157,20 @@ func TestXMLInternalServerError(t *testing.T) {
 		Body().
 		Equal(expected)
 }
+
+func TestXMLHTTPErrorDetails(t *testing.T) {
+	t.Parallel()
+
+	e := render.NewHTTPError("invalid todo", "Bad Request", http.StatusBadRequest)
+	e.Code = "invalid_todo"
+	e.Details = map[string]interface{}{"fields": []string{"title", "due"}, "max": 10}
+	expected := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<HTTPError message=\"invalid todo\" error=\"Bad Request\" status=\"400\" code=\"invalid_todo\">" +
+		"<details><fields><i>title</i><i>due</i></fields><max>10</max></details></HTTPError>"
+
+	rr := httptest.NewRecorder()
+	render.XML.Response(rr, http.StatusBadRequest, e)
+	httpexpect.NewResponse(t, rr.Result()).
+		Status(http.StatusBadRequest).
+		Body().
+		Equal(expected)
+}
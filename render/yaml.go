@@ -0,0 +1,72 @@
+package render
+
+import (
+	"net/http"
+
+	"gopkg.in/yaml.v2"
+)
+
+const yamlContentType = "application/yaml; charset=utf-8"
+
+// YAML is the default YAML renderer
+var YAML = NewYAML()
+
+// YAMLRenderer encode the response as "application/yaml" content type
+// It implements the Renderer and APIRenderer interface.
+type YAMLRenderer struct{}
+
+// NewYAML returns a new YAMLRenderer responder instance.
+func NewYAML() *YAMLRenderer {
+	return &YAMLRenderer{}
+}
+
+// Response sends a YAML-encoded v in the body of a request with the HTTP status code.
+func (y *YAMLRenderer) Response(w http.ResponseWriter, code int, v interface{}) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeContentType(w, yamlContentType)
+	write(w, code, b)
+}
+
+// Send sends a YAML-encoded v in the body of a request with the 200 status code.
+func (y *YAMLRenderer) Send(w http.ResponseWriter, v interface{}) {
+	y.Response(w, http.StatusOK, v)
+}
+
+// Created sends a YAML-encoded v in the body of a request with the 201 status code.
+func (y *YAMLRenderer) Created(w http.ResponseWriter, v interface{}) {
+	y.Response(w, http.StatusCreated, v)
+}
+
+// NoContent sends a v without no content with the 204 status code.
+func (y *YAMLRenderer) NoContent(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BadRequest sends a YAML-encoded error response in the body of a request with the 400 status code.
+func (y *YAMLRenderer) BadRequest(w http.ResponseWriter, err error) {
+	y.error(w, http.StatusBadRequest, err)
+}
+
+// NotFound sends a YAML-encoded error response in the body of a request with the 404 status code.
+func (y *YAMLRenderer) NotFound(w http.ResponseWriter, err error) {
+	y.error(w, http.StatusNotFound, err)
+}
+
+// MethodNotAllowed sends a YAML-encoded error response in the body of a request with the 405 status code.
+func (y *YAMLRenderer) MethodNotAllowed(w http.ResponseWriter, err error) {
+	y.error(w, http.StatusMethodNotAllowed, err)
+}
+
+// InternalServerError sends a YAML-encoded error response in the body of a request with the 500 status code.
+func (y *YAMLRenderer) InternalServerError(w http.ResponseWriter, err error) {
+	y.error(w, http.StatusInternalServerError, err)
+}
+
+func (y *YAMLRenderer) error(w http.ResponseWriter, status int, err error) {
+	y.Response(w, status, NewHTTPError(err.Error(), http.StatusText(status), status))
+}
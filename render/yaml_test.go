@@ -0,0 +1,34 @@
+package render_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/gavv/httpexpect.v1"
+
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+func TestYAMLResponse(t *testing.T) {
+	t.Parallel()
+
+	rr := httptest.NewRecorder()
+	render.YAML.Created(rr, map[string]interface{}{"address": "test address", "lat": 1})
+	httpexpect.NewResponse(t, rr.Result()).
+		Status(http.StatusCreated).
+		ContentType("application/yaml", "utf-8").
+		Body().Equal("address: test address\nlat: 1\n")
+}
+
+func TestYAMLErrors(t *testing.T) {
+	t.Parallel()
+
+	rr := httptest.NewRecorder()
+	render.YAML.NotFound(rr, errors.New("todo not found"))
+	httpexpect.NewResponse(t, rr.Result()).
+		Status(http.StatusNotFound).
+		ContentType("application/yaml", "utf-8").
+		Body().Equal("message: todo not found\nerror: Not Found\nstatus: 404\n")
+}
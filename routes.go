@@ -0,0 +1,85 @@
+package bastion
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi"
+
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+// RouteInfo describes a route mounted in the app.
+type RouteInfo struct {
+	// Method is the HTTP method of the route.
+	Method string `json:"method"`
+	// Pattern is the full route pattern, ie. /todos/{id}/
+	Pattern string `json:"pattern"`
+	// Handler is the name of the endpoint handler.
+	Handler string `json:"handler"`
+	// Middlewares are the names of the middleware chain applied to the route in order of execution.
+	Middlewares []string `json:"middlewares"`
+}
+
+// Routes returns the routes mounted in the app sorted by pattern and method.
+func (app *Bastion) Routes() ([]RouteInfo, error) {
+	return walkRoutes(app.r)
+}
+
+func walkRoutes(mux chi.Routes) ([]RouteInfo, error) {
+	routes := []RouteInfo{}
+	walkFunc := func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		info := RouteInfo{
+			Method:      method,
+			Pattern:     strings.Replace(route, "/*/", "/", -1),
+			Handler:     handlerName(handler),
+			Middlewares: make([]string, len(middlewares)),
+		}
+		for i, m := range middlewares {
+			info.Middlewares[i] = funcName(m)
+		}
+		routes = append(routes, info)
+		return nil
+	}
+
+	if err := chi.Walk(mux, walkFunc); err != nil {
+		return nil, err
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern == routes[j].Pattern {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Pattern < routes[j].Pattern
+	})
+	return routes, nil
+}
+
+func handlerName(h http.Handler) string {
+	if f, ok := h.(http.HandlerFunc); ok {
+		return funcName(f)
+	}
+	return fmt.Sprintf("%T", h)
+}
+
+// funcName returns the name of the function with the package base name, ie. middleware.Logger.func1
+func funcName(f interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return fmt.Sprintf("%T", f)
+	}
+	return strings.TrimSuffix(path.Base(fn.Name()), "-fm")
+}
+
+func (app *Bastion) routesHandler(w http.ResponseWriter, _ *http.Request) {
+	routes, err := app.Routes()
+	if err != nil {
+		render.JSON.InternalServerError(w, err)
+		return
+	}
+	render.JSON.Send(w, routes)
+}
@@ -0,0 +1,84 @@
+package bastion_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ifreddyrondon/bastion"
+)
+
+func list(w http.ResponseWriter, r *http.Request) {}
+
+func get(w http.ResponseWriter, r *http.Request) {}
+
+func noop(next http.Handler) http.Handler { return next }
+
+func findRoute(routes []bastion.RouteInfo, method, pattern string) *bastion.RouteInfo {
+	for i := range routes {
+		if routes[i].Method == method && routes[i].Pattern == pattern {
+			return &routes[i]
+		}
+	}
+	return nil
+}
+
+func TestRoutes(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New()
+	app.Get("/todos", list)
+	app.Route("/todos/{id}", func(r chi.Router) {
+		r.With(noop).Get("/", get)
+	})
+
+	routes, err := app.Routes()
+	require.Nil(t, err)
+
+	route := findRoute(routes, http.MethodGet, "/todos")
+	require.NotNil(t, route)
+	assert.Equal(t, "bastion_test.list", route.Handler)
+	assert.Contains(t, route.Middlewares[0], "middleware.Logger")
+
+	route = findRoute(routes, http.MethodGet, "/todos/{id}/")
+	require.NotNil(t, route)
+	assert.Equal(t, "bastion_test.get", route.Handler)
+	assert.Equal(t, "bastion_test.noop", route.Middlewares[len(route.Middlewares)-1])
+
+	route = findRoute(routes, http.MethodGet, "/ping")
+	require.NotNil(t, route)
+	assert.Equal(t, "bastion.(*Bastion).pingHandler", route.Handler)
+}
+
+func TestRoutesEndpoint(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New()
+	app.Get("/todos", list)
+
+	e := bastion.Tester(t, app)
+	arr := e.GET("/debug/routes").Expect().
+		Status(http.StatusOK).
+		JSON().Array()
+	arr.NotEmpty()
+	found := false
+	for _, v := range arr.Iter() {
+		obj := v.Object()
+		if obj.Value("pattern").String().Raw() == "/todos" {
+			obj.ValueEqual("method", "GET").ValueEqual("handler", "bastion_test.list")
+			found = true
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestRoutesEndpointDisabledWithProfiler(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New(bastion.Mode(bastion.ProductionMode))
+	e := bastion.Tester(t, app)
+	e.GET("/debug/routes").Expect().Status(http.StatusNotFound)
+}
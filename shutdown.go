@@ -0,0 +1,101 @@
+package bastion
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+// ShutdownHook is a function to be implemented when is necessary to release resources in the
+// graceful shutdown, after the in-flight requests were drained or the remaining connections closed. The ctx
+// expires after its own shutdown timeout.
+type ShutdownHook func(ctx context.Context) error
+
+// shutdownHook is a ShutdownHook with the number of start hooks registered before it.
+type shutdownHook struct {
+	fn     ShutdownHook
+	starts int
+}
+
+// OnShutdown registers functions to call in the graceful shutdown after the server stops accepting
+// requests. They run sequentially in reverse order of registration, like deferred calls, and their
+// errors are logged. When a start hook fails they only run if the start hooks registered before them
+// succeeded, so register them after the start hook that acquires what they release.
+func (app *Bastion) OnShutdown(hooks ...ShutdownHook) {
+	for _, hook := range hooks {
+		app.shutdownHooks = append(app.shutdownHooks, shutdownHook{fn: hook, starts: len(app.startHooks)})
+	}
+}
+
+// Shutdown starts the graceful shutdown of a running app as if a SIGTERM signal was received.
+// It doesn't wait for the shutdown to complete, Serve returns when it's done.
+func (app *Bastion) Shutdown() {
+	app.quitOnce.Do(func() {
+		close(app.quit)
+	})
+}
+
+func (app *Bastion) isDraining() bool {
+	return atomic.LoadInt32(&app.draining) == 1
+}
+
+// graceful shutdown the server in phases:
+//  1. the ping and readiness routes report the app as unavailable during the ShutdownDelay.
+//  2. the server stops accepting connections and waits for the in-flight requests until the ShutdownTimeout.
+//  3. the remaining connections are forcibly closed if the drain timed out.
+//  4. the shutdown hooks run in reverse order of registration with their own ShutdownTimeout.
+func (app *Bastion) graceful() {
+	logger := app.logger.With().Str("component", "graceful").Logger()
+	logger.Info().Msg("preparing for shutdown")
+	atomic.StoreInt32(&app.draining, 1)
+	app.health.SetReady(false)
+
+	if app.ShutdownDelay > 0 {
+		logger.Info().Msgf("waiting %v before stop accepting connections", app.ShutdownDelay)
+		time.Sleep(app.ShutdownDelay)
+	}
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), app.ShutdownTimeout)
+	defer cancelDrain()
+
+	logger.Info().Msgf("draining connections with a timeout of %v", app.ShutdownTimeout)
+	drainErr := app.server.Shutdown(drainCtx)
+	// the admin server keeps answering the probes until the app is drained
+	if app.adminServer != nil {
+		if err := app.adminServer.Shutdown(drainCtx); err != nil {
+			logger.Error().Err(err).Msg("draining admin connections")
+			app.adminServer.Close()
+		}
+	}
+	// the hooks release the resources used by the handlers, so no request can be running
+	if drainErr != nil {
+		logger.Error().Err(drainErr).Msg("draining connections, forcing close")
+		if err := app.server.Close(); err != nil {
+			logger.Error().Err(err).Msg("closing server")
+		}
+	}
+
+	app.stop(&logger, len(app.startHooks))
+	if drainErr == nil {
+		logger.Info().Msg("gracefully stopped")
+	}
+}
+
+// stop runs in reverse order of registration, with their own ShutdownTimeout, the shutdown hooks
+// registered after the first started start hooks.
+func (app *Bastion) stop(logger *zerolog.Logger, started int) {
+	ctx, cancel := context.WithTimeout(context.Background(), app.ShutdownTimeout)
+	defer cancel()
+	for i := len(app.shutdownHooks) - 1; i >= 0; i-- {
+		if app.shutdownHooks[i].starts > started {
+			continue
+		}
+		if err := app.shutdownHooks[i].fn(ctx); err != nil {
+			logger.Error().Err(err).Msgf("shutdown hook %v failed", i)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package bastion
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGracefulShutdownPhases(t *testing.T) {
+	t.Parallel()
+
+	out := &syncWriter{w: &bytes.Buffer{}}
+	app := New(DisablePrettyLogging(), LoggerOutput(out), ShutdownDelay(200*time.Millisecond))
+	var mu sync.Mutex
+	var calls []string
+	hook := func(name string, err error) ShutdownHook {
+		return func(ctx context.Context) error {
+			_, hasDeadline := ctx.Deadline()
+			assert.True(t, hasDeadline)
+			mu.Lock()
+			calls = append(calls, name)
+			mu.Unlock()
+			return err
+		}
+	}
+	app.OnShutdown(hook("first", nil), hook("second", errors.New("closing db")))
+	app.OnShutdown(hook("third", nil))
+
+	ln, err := listen("127.0.0.1:0")
+	require.Nil(t, err)
+	url := "http://" + ln.Addr().String() + "/ping"
+	done := make(chan error, 1)
+	go func() { done <- app.ServeListener(ln) }()
+
+	res, err := http.Get(url)
+	require.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	app.Shutdown()
+	// wait to be in the shutdown delay
+	for !app.isDraining() {
+		time.Sleep(time.Millisecond)
+	}
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	res, err = client.Get(url)
+	require.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	res, err = client.Get("http://" + ln.Addr().String() + "/health/ready")
+	require.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	assert.Equal(t, http.ErrServerClosed, <-done)
+	assert.Equal(t, []string{"third", "second", "first"}, calls)
+	assert.Contains(t, out.String(), `"message":"shutdown hook 1 failed"`)
+	assert.Contains(t, out.String(), `"error":"closing db"`)
+	assert.Contains(t, out.String(), `"message":"gracefully stopped"`)
+}
+
+func TestGracefulShutdownWaitInFlightRequests(t *testing.T) {
+	t.Parallel()
+
+	app := New(ShutdownTimeout(time.Second))
+	started := make(chan struct{})
+	app.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	ln, err := listen("127.0.0.1:0")
+	require.Nil(t, err)
+	done := make(chan error, 1)
+	go func() { done <- app.ServeListener(ln) }()
+
+	resCh := make(chan int, 1)
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			resCh <- 0
+			return
+		}
+		res.Body.Close()
+		resCh <- res.StatusCode
+	}()
+	<-started
+	app.Shutdown()
+	assert.Equal(t, http.StatusOK, <-resCh)
+	assert.Equal(t, http.ErrServerClosed, <-done)
+}
+
+func TestGracefulShutdownForceClose(t *testing.T) {
+	t.Parallel()
+
+	out := &syncWriter{w: &bytes.Buffer{}}
+	app := New(DisablePrettyLogging(), LoggerOutput(out), ShutdownTimeout(50*time.Millisecond))
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	app.Get("/stuck", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	clientErr := make(chan error, 1)
+	var hookStartErr, hookClientErr, hookErr error
+	app.OnShutdown(func(ctx context.Context) error {
+		// the hooks have their own deadline and run once the stuck connection is closed
+		hookStartErr = ctx.Err()
+		select {
+		case hookClientErr = <-clientErr:
+		case <-ctx.Done():
+		}
+		<-ctx.Done()
+		hookErr = ctx.Err()
+		return nil
+	})
+	ln, err := listen("127.0.0.1:0")
+	require.Nil(t, err)
+	done := make(chan error, 1)
+	go func() { done <- app.ServeListener(ln) }()
+
+	go func() {
+		_, err := http.Get("http://" + ln.Addr().String() + "/stuck")
+		clientErr <- err
+	}()
+	<-started
+	app.Shutdown()
+	assert.Equal(t, http.ErrServerClosed, <-done)
+	assert.Nil(t, hookStartErr)
+	assert.NotNil(t, hookClientErr)
+	assert.Equal(t, context.DeadlineExceeded, hookErr)
+	assert.Contains(t, out.String(), `"message":"draining connections, forcing close"`)
+}
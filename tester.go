@@ -1,27 +1,218 @@
 package bastion
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"golang.org/x/net/http2"
 	"gopkg.in/gavv/httpexpect.v1"
+
+	"github.com/ifreddyrondon/bastion/openapi"
 )
 
+// TesterReporter set the reporter of the failures. Default an assert reporter of the testing.T, ie. non fatal.
+func TesterReporter(reporter httpexpect.Reporter) TesterOpt {
+	return func(cfg *testerCfg) {
+		cfg.reporter = reporter
+	}
+}
+
+// TesterPrinters set the printers of the requests and responses, without printers nothing is printed.
+// Default a verbose debug printer.
+func TesterPrinters(printers ...httpexpect.Printer) TesterOpt {
+	return func(cfg *testerCfg) {
+		cfg.printers = printers
+	}
+}
+
+// TesterServer runs the requests against a real httptest.Server instead of calling the handler in memory.
+// It needs StartTester, the server is closed with the returned func.
+func TesterServer() TesterOpt {
+	return func(cfg *testerCfg) {
+		cfg.server = true
+	}
+}
+
+// TesterTLS runs the requests against a real httptest.Server with TLS. It needs StartTester.
+func TesterTLS() TesterOpt {
+	return func(cfg *testerCfg) {
+		cfg.server = true
+		cfg.tls = true
+	}
+}
+
+// TesterHTTP2 runs the requests against a real httptest.Server with TLS and HTTP/2. It needs StartTester.
+func TesterHTTP2() TesterOpt {
+	return func(cfg *testerCfg) {
+		cfg.server = true
+		cfg.tls = true
+		cfg.http2 = true
+	}
+}
+
+// TesterLogs copies the app logs into w while the requests of the Tester run, or until the server of
+// StartTester is closed, ie. to assert on the entries of the internal error and recovery middleware.
+// The logs keep being written into the app LoggerOutput.
+func TesterLogs(w io.Writer) TesterOpt {
+	return func(cfg *testerCfg) {
+		cfg.logs = w
+	}
+}
+
+// TesterContract validates every request made through the Tester and its response against the OpenAPI
+// document of the contract, ie. loaded with openapi.LoadContract. The route, params, request body and
+// response status and body are validated, the mismatches are reported as failures.
+func TesterContract(contract *openapi.Contract) TesterOpt {
+	return func(cfg *testerCfg) {
+		cfg.contract = contract
+	}
+}
+
+// TesterOpt helper type to create functional options for Tester.
+type TesterOpt func(*testerCfg)
+
+type testerCfg struct {
+	reporter httpexpect.Reporter
+	printers []httpexpect.Printer
+	server   bool
+	tls      bool
+	http2    bool
+	logs     io.Writer
+	contract *openapi.Contract
+}
+
 // Tester is an end-to-end testing helper for bastion handlers.
-// It receives a reporter testing.T and http.Handler as params.
-func Tester(t *testing.T, bastion *Bastion) *httpexpect.Expect {
-	return httpexpect.WithConfig(httpexpect.Config{
-		Client: &http.Client{
-			Transport: httpexpect.NewBinder(bastion.r),
-			Jar:       httpexpect.NewJar(),
-		},
+// It receives a reporter testing.T and http.Handler as params. The handler is called in memory,
+// the options allow to set the reporter, printers and capture the logs. The real server options
+// need StartTester.
+func Tester(t *testing.T, bastion *Bastion, opts ...TesterOpt) *httpexpect.Expect {
+	cfg := newTesterCfg(t, opts)
+	if cfg.server {
+		t.Fatal("bastion: the TesterServer, TesterTLS and TesterHTTP2 options need StartTester")
+	}
+	var transport http.RoundTripper = httpexpect.NewBinder(bastion.r)
+	if cfg.logs != nil {
+		transport = &logsTransport{next: transport, output: bastion.logOutput, w: cfg.logs}
+	}
+	return newExpect(cfg, "", &http.Client{Transport: transport})
+}
 
-		// use fatal failures
-		Reporter: httpexpect.NewAssertReporter(t),
+// StartTester is like Tester but it also returns a func to close the real server of the TesterServer,
+// TesterTLS and TesterHTTP2 options, call it when the test finishes.
+//
+//	e, closeServer := bastion.StartTester(t, app, bastion.TesterHTTP2())
+//	defer closeServer()
+func StartTester(t *testing.T, bastion *Bastion, opts ...TesterOpt) (*httpexpect.Expect, func()) {
+	cfg := newTesterCfg(t, opts)
+	if !cfg.server {
+		return Tester(t, bastion, opts...), func() {}
+	}
 
+	untap := func() {}
+	if cfg.logs != nil {
+		untap = bastion.logOutput.tap(cfg.logs)
+	}
+	server := httptest.NewUnstartedServer(bastion.r)
+	if cfg.http2 {
+		if err := http2.ConfigureServer(server.Config, nil); err != nil {
+			t.Fatal(err)
+		}
+		server.TLS = server.Config.TLSConfig
+	}
+	if cfg.tls {
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+	client := server.Client()
+	if cfg.http2 {
+		if err := http2.ConfigureTransport(client.Transport.(*http.Transport)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	closeServer := func() {
+		// Close waits for the outstanding requests, so their logs are copied
+		server.Close()
+		untap()
+	}
+	return newExpect(cfg, server.URL, client), closeServer
+}
+
+func newTesterCfg(t *testing.T, opts []TesterOpt) *testerCfg {
+	cfg := &testerCfg{
+		// use non fatal failures
+		reporter: httpexpect.NewAssertReporter(t),
 		// use verbose logging
-		Printers: []httpexpect.Printer{
-			httpexpect.NewDebugPrinter(t, true),
-		},
+		printers: []httpexpect.Printer{httpexpect.NewDebugPrinter(t, true)},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+func newExpect(cfg *testerCfg, baseURL string, client *http.Client) *httpexpect.Expect {
+	client.Jar = httpexpect.NewJar()
+	if cfg.contract != nil {
+		client.Transport = &contractTransport{next: client.Transport, contract: cfg.contract, reporter: cfg.reporter}
+	}
+	return httpexpect.WithConfig(httpexpect.Config{
+		BaseURL:  baseURL,
+		Client:   client,
+		Reporter: cfg.reporter,
+		Printers: cfg.printers,
 	})
 }
+
+// logsTransport copies the app logs into w while the in memory requests run.
+type logsTransport struct {
+	next   http.RoundTripper
+	output *logOutput
+	w      io.Writer
+}
+
+func (t *logsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	untap := t.output.tap(t.w)
+	defer untap()
+	return t.next.RoundTrip(req)
+}
+
+// contractTransport validates the requests and responses against the contract.
+type contractTransport struct {
+	next     http.RoundTripper
+	contract *openapi.Contract
+	reporter httpexpect.Reporter
+}
+
+func (t *contractTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the request body is consumed by the round trip, keep a copy to validate it
+	var body []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	res, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := t.contract.Validate(req, res); err != nil {
+		t.reporter.Errorf("%v", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,126 @@
+package bastion_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ifreddyrondon/bastion"
+	"github.com/ifreddyrondon/bastion/openapi"
+	"github.com/ifreddyrondon/bastion/render"
+)
+
+type recordReporter struct {
+	mu       sync.Mutex
+	failures []string
+}
+
+func (r *recordReporter) Errorf(message string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, fmt.Sprintf(message, args...))
+}
+
+func protoApp() *bastion.Bastion {
+	app := bastion.New(bastion.DisablePrettyLogging(), bastion.LoggerOutput(ioutil.Discard))
+	app.Get("/proto", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	app.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	return app
+}
+
+func TestTesterReporter(t *testing.T) {
+	t.Parallel()
+
+	reporter := &recordReporter{}
+	e := bastion.Tester(t, protoApp(), bastion.TesterReporter(reporter), bastion.TesterPrinters())
+	e.GET("/proto").Expect().Status(http.StatusTeapot)
+	assert.Len(t, reporter.failures, 1)
+	assert.Contains(t, reporter.failures[0], "418")
+}
+
+func TestTesterServer(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name  string
+		opt   bastion.TesterOpt
+		proto string
+	}{
+		{"server", bastion.TesterServer(), "HTTP/1.1"},
+		{"tls", bastion.TesterTLS(), "HTTP/1.1"},
+		{"http2", bastion.TesterHTTP2(), "HTTP/2.0"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			e, closeServer := bastion.StartTester(t, protoApp(), tc.opt, bastion.TesterPrinters())
+			defer closeServer()
+			e.GET("/proto").Expect().Status(http.StatusOK).Body().Equal(tc.proto)
+		})
+	}
+}
+
+func TestTesterLogs(t *testing.T) {
+	t.Parallel()
+
+	logs := &bytes.Buffer{}
+	e := bastion.Tester(t, protoApp(), bastion.TesterLogs(logs), bastion.TesterPrinters())
+	e.GET("/panic").Expect().Status(http.StatusInternalServerError)
+	assert.Contains(t, logs.String(), `"component":"recovery middleware","error":"boom"`)
+	assert.Contains(t, logs.String(), `"component":"internal error middleware","status":500`)
+	assert.Contains(t, logs.String(), `"URL":"/panic"`)
+}
+
+func TestStartTesterLogs(t *testing.T) {
+	t.Parallel()
+
+	logs := &bytes.Buffer{}
+	e, closeServer := bastion.StartTester(t, protoApp(), bastion.TesterServer(), bastion.TesterLogs(logs), bastion.TesterPrinters())
+	e.GET("/panic").Expect().Status(http.StatusInternalServerError)
+	closeServer()
+	assert.Contains(t, logs.String(), `"component":"recovery middleware","error":"boom"`)
+	assert.Contains(t, logs.String(), `"component":"internal error middleware","status":500`)
+}
+
+func TestTesterContract(t *testing.T) {
+	t.Parallel()
+
+	app := bastion.New(bastion.DisablePrettyLogging(), bastion.LoggerOutput(ioutil.Discard))
+	app.Method(http.MethodPost, "/todos", openapi.Describe(func(w http.ResponseWriter, r *http.Request) {
+		render.JSON.Created(w, map[string]interface{}{"id": "1", "description": "buy milk"})
+	}, openapi.Operation{
+		Request:   todo{},
+		Responses: map[int]interface{}{http.StatusCreated: todo{}},
+	}))
+	doc, err := app.OpenAPIDocument()
+	require.Nil(t, err)
+	b, err := doc.JSON()
+	require.Nil(t, err)
+	contract, err := openapi.NewContract(b)
+	require.Nil(t, err)
+
+	reporter := &recordReporter{}
+	e := bastion.Tester(t, app, bastion.TesterContract(contract), bastion.TesterReporter(reporter), bastion.TesterPrinters())
+	e.POST("/todos").WithJSON(todo{ID: 1, Description: "buy milk"}).Expect().Status(http.StatusCreated)
+	e.GET("/todos").Expect().Status(http.StatusMethodNotAllowed)
+	expected := []string{
+		"POST /todos doesn't honor the openapi document:\n  - response body /id: Invalid type. Expected: integer, given: string",
+		"GET /todos doesn't honor the openapi document:\n  - route: method not found in the document",
+	}
+	assert.Equal(t, expected, reporter.failures)
+}
+
+type todo struct {
+	ID          int64  `json:"id"`
+	Description string `json:"description"`
+}
@@ -0,0 +1,136 @@
+package bastion
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const defaultTLSReloadInterval = 10 * time.Second
+
+// certReloader keeps the server certificate loaded from disk and swaps it when
+// the cert or key files change or a SIGHUP signal is received. The new certificate
+// is only used for new handshakes, established connections are not affected.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func (cr *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "loading tls key pair")
+	}
+	modTime, err := cr.lastModTime()
+	if err != nil {
+		return err
+	}
+	cr.mu.Lock()
+	cr.cert = &cert
+	cr.modTime = modTime
+	cr.mu.Unlock()
+	return nil
+}
+
+func (cr *certReloader) lastModTime() (time.Time, error) {
+	var last time.Time
+	for _, f := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return last, errors.Wrap(err, "checking tls files")
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last, nil
+}
+
+// changed reports if the cert or key files were modified since the last reload.
+func (cr *certReloader) changed() bool {
+	modTime, err := cr.lastModTime()
+	if err != nil {
+		return false
+	}
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return modTime.After(cr.modTime)
+}
+
+// GetCertificate returns the current certificate. It's meant to be used as tls.Config.GetCertificate.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// watch reloads the certificate when the files change or on SIGHUP until ctx is done.
+func (cr *certReloader) watch(ctx context.Context, interval time.Duration, l *zerolog.Logger) {
+	logger := l.With().Str("component", "tls").Logger()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logger.Info().Msg("SIGHUP received, reloading certificate")
+		case <-ticker.C:
+			if !cr.changed() {
+				continue
+			}
+			logger.Info().Msg("certificate files changed, reloading certificate")
+		}
+		if err := cr.reload(); err != nil {
+			logger.Error().Err(err).Msg("reloading certificate, keeping the previous one")
+			continue
+		}
+		logger.Info().Msg("certificate reloaded")
+	}
+}
+
+func tlsConfig(opts Options, cr *certReloader) (*tls.Config, error) {
+	cfg := &tls.Config{
+		GetCertificate: cr.GetCertificate,
+		MinVersion:     opts.TLSMinVersion,
+		CipherSuites:   opts.TLSCipherSuites,
+	}
+	if opts.TLSClientCAFile != "" {
+		pem, err := ioutil.ReadFile(opts.TLSClientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading tls client CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in tls client CA file %s", opts.TLSClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
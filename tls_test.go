@@ -0,0 +1,208 @@
+package bastion
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCert(t *testing.T, dir, cn string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	require.Nil(t, ioutil.WriteFile(certFile, certPEM, 0600))
+	require.Nil(t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+	return certFile, keyFile
+}
+
+func leafCN(t *testing.T, cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.Nil(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloaderReloadWhenFilesChange(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bastion-tls")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, "first")
+	cr, err := newCertReloader(certFile, keyFile)
+	require.Nil(t, err)
+	cert, _ := cr.GetCertificate(nil)
+	assert.Equal(t, "first", leafCN(t, cert))
+	assert.False(t, cr.changed())
+
+	writeCert(t, dir, "second")
+	future := time.Now().Add(time.Minute)
+	require.Nil(t, os.Chtimes(certFile, future, future))
+
+	out := &bytes.Buffer{}
+	app := New(DisablePrettyLogging(), LoggerOutput(out))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cr.watch(ctx, 10*time.Millisecond, &app.logger)
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		cert, _ := cr.GetCertificate(nil)
+		if leafCN(t, cert) == "second" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cert, _ = cr.GetCertificate(nil)
+	assert.Equal(t, "second", leafCN(t, cert))
+	cancel()
+	<-done
+	assert.Contains(t, out.String(), "certificate reloaded")
+}
+
+func TestCertReloaderKeepPreviousWhenInvalid(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bastion-tls")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, "first")
+	cr, err := newCertReloader(certFile, keyFile)
+	require.Nil(t, err)
+
+	require.Nil(t, ioutil.WriteFile(keyFile, []byte("bad key"), 0600))
+	assert.Error(t, cr.reload())
+	cert, _ := cr.GetCertificate(nil)
+	assert.Equal(t, "first", leafCN(t, cert))
+}
+
+func TestNewCertReloaderMissingFiles(t *testing.T) {
+	t.Parallel()
+
+	_, err := newCertReloader("missing-cert.pem", "missing-key.pem")
+	assert.Error(t, err)
+}
+
+func TestTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bastion-tls")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, "server")
+	app := New(TLS(certFile, keyFile), TLSClientCA(certFile), TLSCipherSuites(tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256))
+	cr, err := newCertReloader(certFile, keyFile)
+	require.Nil(t, err)
+	cfg, err := tlsConfig(app.Options, cr)
+	require.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), cfg.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, cfg.CipherSuites)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+	assert.NotNil(t, cfg.ClientCAs)
+
+	app.TLSClientCAFile = keyFile
+	_, err = tlsConfig(app.Options, cr)
+	assert.EqualError(t, err, "no certificates found in tls client CA file "+keyFile)
+}
+
+func TestServeTLS(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bastion-tls")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCert(t, dir, "server")
+
+	tt := []struct {
+		name  string
+		opts  []Opt
+		serve func(app *Bastion, addr string) error
+	}{
+		{
+			"Serve with the TLS option",
+			[]Opt{TLS(certFile, keyFile)},
+			func(app *Bastion, addr string) error { return app.Serve(addr) },
+		},
+		{
+			"ServeTLS",
+			nil,
+			func(app *Bastion, addr string) error { return app.ServeTLS(certFile, keyFile, addr) },
+		},
+	}
+
+	pemCert, err := ioutil.ReadFile(certFile)
+	require.Nil(t, err)
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(pemCert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &syncWriter{w: &bytes.Buffer{}}
+			app := New(append(tc.opts, DisablePrettyLogging(), LoggerOutput(out))...)
+			ready := make(chan string, 1)
+			app.OnReady(func(addr string) { ready <- addr })
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			require.Nil(t, err)
+			addr := ln.Addr().String()
+			ln.Close()
+			done := make(chan error, 1)
+			go func() { done <- tc.serve(app, addr) }()
+			select {
+			case <-ready:
+			case err := <-done:
+				t.Fatalf("serve returned before being ready: %v", err)
+			}
+
+			res, err := client.Get("https://" + addr + "/ping")
+			require.Nil(t, err)
+			body, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, "pong", string(body))
+
+			app.Shutdown()
+			assert.Equal(t, http.ErrServerClosed, <-done)
+		})
+	}
+}
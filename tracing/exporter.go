@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// InMemoryExporter keeps the exported spans in memory, it's meant for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// NewInMemoryExporter returns an empty InMemoryExporter.
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// Export keeps the span.
+func (e *InMemoryExporter) Export(span SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+// Spans returns a copy of the exported spans in order of export.
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	spans := make([]SpanData, len(e.spans))
+	copy(spans, e.spans)
+	return spans
+}
+
+// Reset removes the exported spans.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// JSONExporter writes each span as a JSON line.
+type JSONExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	c   io.Closer
+}
+
+// NewJSONExporter returns a JSONExporter writing into w.
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{enc: json.NewEncoder(w)}
+}
+
+// NewFileExporter returns a JSONExporter appending into the file at path, it's created if it doesn't exist.
+func NewFileExporter(path string) (*JSONExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening spans file")
+	}
+	return &JSONExporter{enc: json.NewEncoder(f), c: f}, nil
+}
+
+// Export writes the span as a JSON line.
+func (e *JSONExporter) Export(span SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(span)
+}
+
+// Close closes the file of an exporter created with NewFileExporter.
+func (e *JSONExporter) Close() error {
+	if e.c == nil {
+		return nil
+	}
+	return e.c.Close()
+}
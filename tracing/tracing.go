@@ -0,0 +1,298 @@
+// Package tracing implements the W3C trace context propagation (https://www.w3.org/TR/trace-context/) and
+// spans shipped through a pluggable Exporter.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// TraceparentHeader is the header with the trace id, the parent span id and the trace flags.
+	TraceparentHeader = "traceparent"
+	// TracestateHeader is the header with the vendor specific trace data.
+	TracestateHeader = "tracestate"
+	// FlagSampled is the trace flag that marks the trace as recorded by the caller.
+	FlagSampled byte = 0x01
+
+	traceparentVersion = "00"
+)
+
+var errInvalidTraceparent = errors.New("invalid traceparent")
+
+// TraceID identifies a trace, all its spans share it.
+type TraceID [16]byte
+
+// IsValid reports if the id is not all zeros.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// String returns the lowercase hex encoding of the id.
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// IsValid reports if the id is not all zeros.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// String returns the lowercase hex encoding of the id.
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext is the part of a span propagated across services.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+}
+
+// IsValid reports if both the trace and span ids are valid.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// IsSampled reports if the sampled flag is set.
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// Traceparent returns the value of the traceparent header.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("%s-%s-%s-%02x", traceparentVersion, sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceparent parses the value of a traceparent header.
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, errInvalidTraceparent
+	}
+	// future versions can append fields, version 00 must have exactly four
+	if parts[0] == traceparentVersion && len(parts) != 4 {
+		return sc, errInvalidTraceparent
+	}
+	if _, err := hex.DecodeString(parts[0]); err != nil {
+		return sc, errInvalidTraceparent
+	}
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return sc, err
+	}
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return sc, err
+	}
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return sc, err
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, errInvalidTraceparent
+	}
+	return sc, nil
+}
+
+func decodeHex(dst []byte, s string) error {
+	// only lowercase hex is allowed
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return errInvalidTraceparent
+	}
+	if _, err := hex.Decode(dst, []byte(s)); err != nil {
+		return errInvalidTraceparent
+	}
+	return nil
+}
+
+// Extract returns the span context propagated in the traceparent and tracestate headers.
+func Extract(h http.Header) (SpanContext, error) {
+	sc, err := ParseTraceparent(h.Get(TraceparentHeader))
+	if err != nil {
+		return sc, err
+	}
+	sc.TraceState = strings.Join(h[http.CanonicalHeaderKey(TracestateHeader)], ",")
+	return sc, nil
+}
+
+// Inject sets the traceparent and tracestate headers of the span in the ctx, ie. in an outgoing request.
+func Inject(ctx context.Context, h http.Header) {
+	span := FromContext(ctx)
+	if span == nil {
+		return
+	}
+	sc := span.Context()
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set(TracestateHeader, sc.TraceState)
+	}
+}
+
+// SpanData is the exported representation of a finished span.
+type SpanData struct {
+	Name         string            `json:"name"`
+	TraceID      string            `json:"trace_id"`
+	SpanID       string            `json:"span_id"`
+	ParentSpanID string            `json:"parent_span_id,omitempty"`
+	TraceState   string            `json:"trace_state,omitempty"`
+	Kind         string            `json:"kind"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Duration     time.Duration     `json:"duration"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// Span is an operation of a trace, ie. the handling of a request.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// Context returns the span context to be propagated.
+func (s *Span) Context() SpanContext {
+	return s.sc
+}
+
+// SetName changes the name of the span.
+func (s *Span) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Name = name
+}
+
+// SetAttribute sets a key value pair describing the span.
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]string)
+	}
+	s.data.Attributes[key] = value
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End finishes the span and exports it when it's sampled. Calling it more than once does nothing.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	s.data.Duration = s.data.End.Sub(s.data.Start)
+	data := s.data
+	s.mu.Unlock()
+
+	if s.sc.IsSampled() && s.tracer.exporter != nil {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+// Exporter ships the finished spans, ie. to a file or a tracing backend.
+type Exporter interface {
+	Export(span SpanData) error
+}
+
+// Tracer creates spans and ships them through its exporter.
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer returns a Tracer that ships the spans through the exporter, a nil exporter only propagates.
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Kinds of span.
+const (
+	KindServer   = "server"
+	KindClient   = "client"
+	KindInternal = "internal"
+)
+
+// Start creates a span child of the span in ctx, or child of the remote parent when it's valid, or the root
+// of a new sampled trace otherwise. It returns a copy of ctx holding the span.
+func (t *Tracer) Start(ctx context.Context, name, kind string, remote SpanContext) (context.Context, *Span) {
+	parent := remote
+	if span := FromContext(ctx); span != nil {
+		parent = span.Context()
+	}
+
+	sc := SpanContext{SpanID: newSpanID(), Flags: FlagSampled}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		sc.TraceID = newTraceID()
+	}
+
+	s := &Span{tracer: t, sc: sc}
+	s.data = SpanData{
+		Name:       name,
+		TraceID:    sc.TraceID.String(),
+		SpanID:     sc.SpanID.String(),
+		TraceState: sc.TraceState,
+		Kind:       kind,
+		Start:      time.Now(),
+	}
+	if parent.IsValid() {
+		s.data.ParentSpanID = parent.SpanID.String()
+	}
+	return ContextWithSpan(ctx, s), s
+}
+
+type ctxKey struct{}
+
+// ContextWithSpan returns a copy of ctx holding the span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, ctxKey{}, span)
+}
+
+// FromContext returns the span stored in ctx or nil if there is none.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(ctxKey{}).(*Span)
+	return span
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		randRead(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		randRead(id[:])
+	}
+	return id
+}
+
+func randRead(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		// fallback to the clock, ids only need to be unique
+		binary.BigEndian.PutUint64(b[len(b)-8:], uint64(time.Now().UnixNano()))
+	}
+}
@@ -0,0 +1,158 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ifreddyrondon/bastion/tracing"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	t.Parallel()
+
+	sc, err := tracing.ParseTraceparent(traceparent)
+	require.Nil(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.IsSampled())
+	assert.Equal(t, traceparent, sc.Traceparent())
+
+	sc, err = tracing.ParseTraceparent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future")
+	require.Nil(t, err)
+	assert.False(t, sc.IsSampled())
+}
+
+func TestParseTraceparentInvalid(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name  string
+		value string
+	}{
+		{"empty", ""},
+		{"forbidden version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{"extra fields in version 00", traceparent + "-01"},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{"short trace id", "00-4bf92f3577b34da6-00f067aa0ba902b7-01"},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{"zero span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{"invalid flags", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-x1"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tracing.ParseTraceparent(tc.value)
+			assert.EqualError(t, err, "invalid traceparent")
+		})
+	}
+}
+
+func TestStartSpan(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracing.NewInMemoryExporter()
+	tracer := tracing.NewTracer(exporter)
+	h := http.Header{}
+	h.Set(tracing.TraceparentHeader, traceparent)
+	h.Add(tracing.TracestateHeader, "a=1")
+	h.Add(tracing.TracestateHeader, "b=2")
+	remote, err := tracing.Extract(h)
+	require.Nil(t, err)
+
+	ctx, server := tracer.Start(context.Background(), "server", tracing.KindServer, remote)
+	_, child := tracer.Start(ctx, "child", tracing.KindInternal, tracing.SpanContext{})
+	assert.Equal(t, server, tracing.FromContext(ctx))
+	assert.Equal(t, remote.TraceID, child.Context().TraceID)
+	assert.Equal(t, "a=1,b=2", child.Context().TraceState)
+	child.End()
+	server.SetAttribute("k", "v")
+	server.End()
+	server.End()
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, server.Context().SpanID.String(), spans[0].ParentSpanID)
+	assert.Equal(t, "server", spans[1].Name)
+	assert.Equal(t, "00f067aa0ba902b7", spans[1].ParentSpanID)
+	assert.Equal(t, map[string]string{"k": "v"}, spans[1].Attributes)
+
+	out := http.Header{}
+	tracing.Inject(ctx, out)
+	assert.Equal(t, server.Context().Traceparent(), out.Get(tracing.TraceparentHeader))
+	assert.Equal(t, "a=1,b=2", out.Get(tracing.TracestateHeader))
+}
+
+func TestStartNewTrace(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracing.NewInMemoryExporter()
+	_, span := tracing.NewTracer(exporter).Start(context.Background(), "root", tracing.KindServer, tracing.SpanContext{})
+	assert.True(t, span.Context().IsValid())
+	assert.True(t, span.Context().IsSampled())
+	span.End()
+	require.Len(t, exporter.Spans(), 1)
+	assert.Empty(t, exporter.Spans()[0].ParentSpanID)
+	exporter.Reset()
+	assert.Empty(t, exporter.Spans())
+}
+
+func TestNotSampledSpanIsNotExported(t *testing.T) {
+	t.Parallel()
+
+	remote, err := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	require.Nil(t, err)
+	exporter := tracing.NewInMemoryExporter()
+	_, span := tracing.NewTracer(exporter).Start(context.Background(), "root", tracing.KindServer, remote)
+	span.End()
+	assert.Empty(t, exporter.Spans())
+}
+
+func TestJSONExporter(t *testing.T) {
+	t.Parallel()
+
+	out := &bytes.Buffer{}
+	_, span := tracing.NewTracer(tracing.NewJSONExporter(out)).Start(context.Background(), "root", tracing.KindServer, tracing.SpanContext{})
+	span.End()
+	var data tracing.SpanData
+	require.Nil(t, json.Unmarshal(out.Bytes(), &data))
+	assert.Equal(t, "root", data.Name)
+	assert.Equal(t, span.Context().TraceID.String(), data.TraceID)
+}
+
+func TestFileExporter(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bastion-tracing")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spans.jsonl")
+
+	exporter, err := tracing.NewFileExporter(path)
+	require.Nil(t, err)
+	tracer := tracing.NewTracer(exporter)
+	for _, name := range []string{"a", "b"} {
+		_, span := tracer.Start(context.Background(), name, tracing.KindServer, tracing.SpanContext{})
+		span.End()
+	}
+	require.Nil(t, exporter.Close())
+
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	assert.Len(t, lines, 2)
+
+	_, err = tracing.NewFileExporter(filepath.Join(dir, "missing", "spans.jsonl"))
+	assert.Contains(t, err.Error(), "opening spans file")
+}